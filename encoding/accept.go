@@ -0,0 +1,50 @@
+package encoding
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+)
+
+// NegotiateAccept picks the mimetype to encode a response in from the entries of a
+// request's Accept header, parsed by mimetype.FromAcceptHeader(), which caches recently
+// seen headers, or by a mimetype.AcceptParser or mimetype.ParseAccept().
+//
+// Each registered encoder is given the quality of the most specific entry which matches
+// it, so "application/json;q=0, */*" accepts anything but json. The mimetype with the
+// highest quality is returned, with ties going to the entry the client sent first, and
+// then to the encoder which was registered first. For the default encoders, json is
+// returned for "*/*" or when entries is empty.
+//
+// If no registered encoder has a quality above 0, ok is false. Negotiation is done by
+// mimetype.NegotiateEntries() with the registered encoders as the supported mimetypes.
+// Encoders for mimetypes left out of SetAllowedMimeTypes() are never picked.
+func (engine *SpanEngine) NegotiateAccept(
+	entries []mimetype.AcceptEntry,
+) (mimeType mimetype.MimeType, ok bool) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	mimeType = mimetype.NegotiateEntries(entries, engine.allowedEncoderOrder())
+	return mimeType, mimeType != mimetype.UNKNOWN
+}
+
+// Returns the mimetypes of all registered encoders allowed by SetAllowedMimeTypes(), in
+// the order they were first registered, which is the order NegotiateAccept() prefers
+// them in.
+func (engine *SpanEngine) EncoderMimeTypes() []mimetype.MimeType {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.allowedEncoderOrder()
+}
+
+// Returns a copy of encoderOrder without the mimetypes SetAllowedMimeTypes() leaves
+// out. The caller must hold registryLock.
+func (engine *SpanEngine) allowedEncoderOrder() []mimetype.MimeType {
+	allowed := make([]mimetype.MimeType, 0, len(engine.encoderOrder))
+	for _, mimeType := range engine.encoderOrder {
+		if engine.allowsMimeType(mimeType) {
+			allowed = append(allowed, mimeType)
+		}
+	}
+	return allowed
+}
@@ -7,9 +7,13 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 	"golang.org/x/xerrors"
 	"io"
 	"reflect"
+	"time"
 )
 
 // BsonListSepString is a delimiter for top-level bson lists, which bson does not not
@@ -21,6 +25,16 @@ const BsonListSepString = "\u241E"
 // BsonListSepBytes is a byte representation of BsonListSepString.
 var BsonListSepBytes = []byte(BsonListSepString)
 
+// BsonScalarWrapKey is the document key top-level scalars are stored under when
+// SpanEngine.SetBsonWrapScalars() is enabled, since bson cannot represent a bare value
+// at the top level: {"value": <scalar>}.
+const BsonScalarWrapKey = "value"
+
+// BsonListWrapKey is the document key top-level lists are stored under when
+// SpanEngine.SetBsonWrapLists() is enabled, for tools which need a single document at
+// the root of a payload: {"items": [...]}.
+const BsonListWrapKey = "items"
+
 // split function used to separate the bson records.
 func splitBsonFunc(data []byte, atEOF bool) (advance int, token []byte, err error) {
 
@@ -53,17 +67,27 @@ type BsonCodecOpts struct {
 	Codec bsoncodec.ValueCodec
 }
 
-var defaultBsonCodecs = []*BsonCodecOpts{
-	{
-		ValueType: reflect.TypeOf(uuid.UUID{}),
-		Codec:     bsonCodecUUID{},
-	},
+// Returns the codecs every SpanEngine is created with. Codecs are bound to engine so
+// they can consult its settings.
+func defaultBsonCodecs(engine *SpanEngine) []*BsonCodecOpts {
+	return []*BsonCodecOpts{
+		{
+			ValueType: reflect.TypeOf(uuid.UUID{}),
+			Codec:     bsonCodecUUID{engine: engine},
+		},
+		{
+			ValueType: reflect.TypeOf(time.Time{}),
+			Codec:     bsonCodecTime{engine: engine},
+		},
+	}
 }
 
 // CODECS
 
 // bsonCodecUUID Handles encoding and decoding of UUID to and from bson.
-type bsonCodecUUID struct{}
+type bsonCodecUUID struct {
+	engine *SpanEngine
+}
 
 // Encodes uuid value to bson.
 func (codec bsonCodecUUID) EncodeValue(
@@ -71,10 +95,14 @@ func (codec bsonCodecUUID) EncodeValue(
 	valueWriter bsonrw.ValueWriter,
 	value reflect.Value,
 ) error {
-	valueUUID, _ := value.Interface().(uuid.UUID)
-	_ = valueWriter.WriteBinaryWithSubtype(valueUUID.Bytes(), 0x3)
+	valueUUID, ok := value.Interface().(uuid.UUID)
+	if !ok {
+		return xerrors.Errorf("bson uuid codec cannot encode %v", value.Type())
+	}
 
-	return nil
+	return valueWriter.WriteBinaryWithSubtype(
+		valueUUID.Bytes(), codec.engine.UUIDBsonSubtype(),
+	)
 }
 
 // Decodes uuid value from bson.
@@ -83,9 +111,15 @@ func (codec bsonCodecUUID) DecodeValue(
 	valueReader bsonrw.ValueReader,
 	value reflect.Value,
 ) error {
-	bytesUUID, _, _ := valueReader.ReadBinary()
-	uuidVal, err := uuid.FromBytes(bytesUUID)
+	bytesUUID, _, err := valueReader.ReadBinary()
+	if err != nil {
+		return xerrors.Errorf("could not read bson uuid: %w", err)
+	}
 
+	uuidVal, err := uuid.FromBytes(bytesUUID)
+	if err != nil {
+		uuidVal, err = codec.engine.malformedUUID(err)
+	}
 	if err != nil {
 		return err
 	}
@@ -95,18 +129,163 @@ func (codec bsonCodecUUID) DecodeValue(
 	return nil
 }
 
+// bsonCodecTime handles encoding and decoding of time.Time to and from bson. Times are
+// written as bson datetimes unless the engine's SetTimeLayout() is a string layout, in
+// which case they are written as strings, like in json.
+type bsonCodecTime struct {
+	engine *SpanEngine
+}
+
+// Encodes time value to bson.
+func (codec bsonCodecTime) EncodeValue(
+	encodeCTX bsoncodec.EncodeContext,
+	valueWriter bsonrw.ValueWriter,
+	value reflect.Value,
+) error {
+	valueTime, ok := value.Interface().(time.Time)
+	if !ok {
+		return xerrors.Errorf("bson time codec cannot encode %v", value.Type())
+	}
+
+	// A bson datetime is itself a count of milliseconds since the unix epoch.
+	layout := codec.engine.TimeLayout()
+	if layout == "" || layout == TimeLayoutEpochMillis {
+		return valueWriter.WriteDateTime(timeToMillis(valueTime))
+	}
+	return valueWriter.WriteString(valueTime.Format(layout))
+}
+
+// Decodes time value from a bson datetime, a string in the engine's time layout, or an
+// int64 count of milliseconds since the unix epoch.
+func (codec bsonCodecTime) DecodeValue(
+	decodeCTX bsoncodec.DecodeContext,
+	valueReader bsonrw.ValueReader,
+	value reflect.Value,
+) error {
+	valueTime, err := codec.readTime(valueReader)
+	if err != nil {
+		return err
+	}
+
+	value.Set(reflect.ValueOf(valueTime))
+	return nil
+}
+
+// Reads a time from whichever bson type valueReader holds.
+func (codec bsonCodecTime) readTime(valueReader bsonrw.ValueReader) (time.Time, error) {
+	switch valueType := valueReader.Type(); valueType {
+	case bsontype.DateTime:
+		millis, err := valueReader.ReadDateTime()
+		return timeFromMillis(millis), err
+	case bsontype.Int64:
+		millis, err := valueReader.ReadInt64()
+		return timeFromMillis(millis), err
+	case bsontype.String:
+		text, err := valueReader.ReadString()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseTimeLayout(codec.engine.TimeLayout(), text)
+	case bsontype.Null:
+		return time.Time{}, valueReader.ReadNull()
+	default:
+		return time.Time{}, xerrors.Errorf("cannot decode bson %v into time", valueType)
+	}
+}
+
+// Returns document with a fresh ObjectID stored under "_id" as its first element, or
+// document unchanged if it already has an "_id".
+func injectBsonID(document bson.Raw) ([]byte, error) {
+	err := document.Validate()
+	if err != nil {
+		return nil, xerrors.Errorf("content is not a single bson document: %w", err)
+	}
+
+	// Validate() does not check for trailing data, which a list of documents has.
+	length, _, _ := bsoncore.ReadLength(document)
+	if int(length) != len(document) {
+		return nil, xerrors.New("content is not a single bson document")
+	}
+
+	if _, err := document.LookupErr("_id"); err == nil {
+		return document, nil
+	}
+
+	index, injected := bsoncore.AppendDocumentStart(nil)
+	injected = bsoncore.AppendObjectIDElement(injected, "_id", primitive.NewObjectID())
+	// Copy the existing elements, skipping the length prefix and null terminator.
+	injected = append(injected, document[4:len(document)-1]...)
+
+	return bsoncore.AppendDocumentEnd(injected, index)
+}
+
+// Whether value will be represented as a bson document on its own, rather than a bare
+// value which bson cannot write at the top level.
+func isBsonDocument(value interface{}) bool {
+	switch value.(type) {
+	case bson.Marshaler, bson.Unmarshaler, bson.Raw, *bson.Raw:
+		return true
+	case bson.ValueMarshaler, bson.ValueUnmarshaler:
+		return false
+	}
+
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+	return kind == reflect.Struct || kind == reflect.Map || kind == reflect.Interface
+}
+
+// Whether value implements one of the bson interfaces for marshalling itself, in which
+// case it should be handled as a single value even if it is a slice or array.
+func isBsonSelfMarshaler(value interface{}) bool {
+	switch value.(type) {
+	case bson.Marshaler, bson.Unmarshaler, bson.ValueMarshaler, bson.ValueUnmarshaler:
+		return true
+	}
+	return false
+}
+
 // BSON Encoder for writing BSON Data to content.
 type bsonEncoder struct{}
 
+// Decodes bson lists into the existing elements of a slice in place. Used by
+// SpanEngine.DecodeManyInto().
+type bsonReuseDecoder struct {
+	bsonEncoder
+}
+
+func (decoder *bsonReuseDecoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	return decoder.decodeMany(engine.(*SpanEngine), reader, contentReceiver, true)
+}
+
+func (encoder *bsonEncoder) FileExtension() string {
+	return ".bson"
+}
+
 func (encoder *bsonEncoder) encodeSingle(
 	spanEngine *SpanEngine, writer io.Writer, content interface{},
 ) error {
 	var bodyBSON bson.Raw
 
+	// Wrap scalars in a document if the engine is set to do so.
+	if spanEngine.bsonWrapScalars && !isBsonDocument(content) {
+		content = bson.D{{Key: BsonScalarWrapKey, Value: content}}
+	}
+
+	// Types which marshal themselves to a bson value rather than a document cannot be
+	// written at the top level.
+	if _, isValue := content.(bson.ValueMarshaler); isValue && !isBsonDocument(content) {
+		return xerrors.Errorf(
+			"%T marshals to a bson value, not a document, and cannot be encoded at "+
+				"the top level: wrap it in a struct or use SetBsonWrapScalars(true)",
+			content,
+		)
+	}
+
 	incomingRaw, isRaw := content.(*bson.Raw)
 
 	if !isRaw {
-		marshalled, err := bson.MarshalWithRegistry(spanEngine.bsonRegistry, content)
+		marshalled, err := bson.MarshalWithRegistry(spanEngine.BSONRegistry(), content)
 		if err != nil {
 			return err
 		}
@@ -151,6 +330,20 @@ func (encoder *bsonEncoder) encodeMany(
 	return nil
 }
 
+// Encodes a list as a single document, under BsonListWrapKey.
+func (encoder *bsonEncoder) encodeWrappedList(
+	spanEngine *SpanEngine, writer io.Writer, content interface{},
+) error {
+	wrapped := bson.D{{Key: BsonListWrapKey, Value: content}}
+	document, err := bson.MarshalWithRegistry(spanEngine.BSONRegistry(), wrapped)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(document)
+	return err
+}
+
 // Detects whether content to encode is a sequence (array or slice)
 func (encoder *bsonEncoder) isSequence(value *reflect.Value) bool {
 	return value.Kind() == reflect.Slice || value.Kind() == reflect.Array
@@ -167,7 +360,11 @@ func (encoder *bsonEncoder) Encode(
 	// Check that it is not a raw document.
 	_, isRaw := content.(*bson.Raw)
 
-	if encoder.isSequence(&contentValue) && !isRaw {
+	isList := encoder.isSequence(&contentValue) && !isRaw && !isBsonSelfMarshaler(content)
+
+	if isList && spanEngine.bsonWrapLists {
+		err = encoder.encodeWrappedList(spanEngine, writer, content)
+	} else if isList {
 		err = encoder.encodeMany(spanEngine, writer, &contentValue)
 	} else {
 		err = encoder.encodeSingle(spanEngine, writer, content)
@@ -185,39 +382,140 @@ func (encoder *bsonEncoder) decodeSingle(
 		return err
 	}
 
+	// Raw receivers capture the document as-is.
+	if rawReceiver, isRaw := contentReceiver.(*bson.Raw); isRaw {
+		*rawReceiver = document
+		return nil
+	}
+
+	// Unwrap scalars from their document if the engine is set to do so.
+	if spanEngine.bsonWrapScalars && !isBsonDocument(contentReceiver) {
+		value, err := document.LookupErr(BsonScalarWrapKey)
+		if err != nil {
+			return xerrors.Errorf(
+				"error unwrapping bson scalar from '%v': %w", BsonScalarWrapKey, err,
+			)
+		}
+		return value.UnmarshalWithRegistry(spanEngine.BSONRegistry(), contentReceiver)
+	}
+
 	return bson.UnmarshalWithRegistry(
-		spanEngine.bsonRegistry, document, contentReceiver,
+		spanEngine.BSONRegistry(), document, contentReceiver,
 	)
 }
 
-// Decodes multiple bson elements.
+// Decodes multiple bson elements. If reuse is true, existing elements of the slice are
+// decoded into in place, further elements are appended, and the slice is truncated to
+// the number of documents decoded. Otherwise all elements are appended.
 func (encoder *bsonEncoder) decodeMany(
-	spanEngine *SpanEngine, reader io.Reader, contentReceiver interface{},
+	spanEngine *SpanEngine,
+	reader io.Reader,
+	contentReceiver interface{},
+	reuse bool,
 ) error {
 	slicePointer := reflect.ValueOf(contentReceiver)
 	if slicePointer.Kind() != reflect.Ptr {
 		return xerrors.New("slice receiver must be pointer")
 	}
+
+	if spanEngine.bsonWrapLists {
+		return encoder.decodeWrappedList(spanEngine, reader, contentReceiver)
+	}
 	sliceValue := slicePointer.Elem()
 
 	// Get the element type for the slice.
 	elementType := reflect.TypeOf(contentReceiver).Elem().Elem()
+
+	// bson cannot decode a top-level document into an empty interface, so for
+	// heterogeneous lists like []interface{} each document is decoded into a bson.M.
+	if elementType.Kind() == reflect.Interface && elementType.NumMethod() == 0 {
+		elementType = reflect.TypeOf(bson.M{})
+	}
+
 	docScanner := bufio.NewScanner(reader)
 	docScanner.Split(splitBsonFunc)
 
+	reuseCount := 0
+	if reuse {
+		reuseCount = sliceValue.Len()
+	}
+
 	// Iterate through documents.
-	for docScanner.Scan() {
-		docBuff := bytes.NewBuffer(docScanner.Bytes())
-		newElement := reflect.New(elementType)
+	count := 0
+	for ; docScanner.Scan(); count++ {
+		if err := spanEngine.checkListLength(count + 1); err != nil {
+			return err
+		}
 
-		err := encoder.decodeSingle(spanEngine, docBuff, newElement.Interface())
+		docBuff := bytes.NewBuffer(docScanner.Bytes())
+		err := encoder.decodeElement(
+			spanEngine, docBuff, sliceValue, elementType, count, count < reuseCount,
+		)
 		if err != nil {
 			return err
 		}
+	}
 
-		sliceValue.Set(reflect.Append(sliceValue, newElement.Elem()))
+	if reuse && count < sliceValue.Len() {
+		sliceValue.SetLen(count)
+	}
+	return nil
+}
+
+// Decodes a list wrapped in a single document under BsonListWrapKey. Existing elements
+// of the receiver are not reused.
+func (encoder *bsonEncoder) decodeWrappedList(
+	spanEngine *SpanEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	document, err := bson.NewFromIOReader(reader)
+	if err != nil {
+		return err
+	}
+
+	value, err := document.LookupErr(BsonListWrapKey)
+	if err != nil {
+		return xerrors.Errorf(
+			"error unwrapping bson list from '%v': %w", BsonListWrapKey, err,
+		)
+	}
+
+	elements, err := bsoncore.Document(value.Value).Values()
+	if err != nil {
+		return xerrors.Errorf("error reading wrapped bson list: %w", err)
+	}
+	if err := spanEngine.checkListLength(len(elements)); err != nil {
+		return err
+	}
+
+	return value.UnmarshalWithRegistry(spanEngine.BSONRegistry(), contentReceiver)
+}
+
+// Decodes a single document of a list into the slice element at index if inPlace is
+// true, or into a new element appended to the slice otherwise.
+func (encoder *bsonEncoder) decodeElement(
+	spanEngine *SpanEngine,
+	reader io.Reader,
+	sliceValue reflect.Value,
+	elementType reflect.Type,
+	index int,
+	inPlace bool,
+) error {
+	if inPlace && elementType == sliceValue.Type().Elem() {
+		receiver := sliceValue.Index(index).Addr().Interface()
+		return encoder.decodeSingle(spanEngine, reader, receiver)
 	}
 
+	newElement := reflect.New(elementType)
+	err := encoder.decodeSingle(spanEngine, reader, newElement.Interface())
+	if err != nil {
+		return err
+	}
+
+	if inPlace {
+		sliceValue.Index(index).Set(newElement.Elem())
+	} else {
+		sliceValue.Set(reflect.Append(sliceValue, newElement.Elem()))
+	}
 	return nil
 }
 
@@ -229,9 +527,13 @@ func (encoder *bsonEncoder) Decode(
 	// Check if the value is a slice or an array.
 	receiverValue := reflect.Indirect(reflect.ValueOf(contentReceiver))
 
+	// Raw documents and self-unmarshalers are slices but decode a single document.
+	_, isRaw := contentReceiver.(*bson.Raw)
+	isSingle := isRaw || isBsonSelfMarshaler(contentReceiver)
+
 	// If the receiver is a slice or array, we need to decode multiple documents.
-	if encoder.isSequence(&receiverValue) {
-		err = encoder.decodeMany(spanEngine, reader, contentReceiver)
+	if encoder.isSequence(&receiverValue) && !isSingle {
+		err = encoder.decodeMany(spanEngine, reader, contentReceiver, false)
 	} else {
 		err = encoder.decodeSingle(spanEngine, reader, contentReceiver)
 	}
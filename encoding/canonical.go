@@ -0,0 +1,185 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"golang.org/x/xerrors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+/*
+EncodeCanonical encodes content to JSON in the RFC 8785 JSON Canonicalization Scheme
+(JCS), so two semantically equal values always produce byte-identical output. Use it
+for payloads which are cryptographically signed or hashed.
+
+Content is first encoded by the engine's JSON encoder, so registered JSON extensions
+still apply, then rewritten canonically:
+
+• Object keys are sorted by their UTF-16 code units.
+
+• Numbers are written as ECMAScript would write the equivalent IEEE 754 double, like
+"1e+30" or "0.002". NaN and Infinity cannot be represented and return an error.
+
+• Strings escape only what JSON requires, and whitespace between tokens is removed.
+*/
+func (engine *SpanEngine) EncodeCanonical(content interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if _, err := engine.Encode(mimetype.JSON, content, buffer); err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	decoder := json.NewDecoder(buffer)
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, xerrors.Errorf("error reading encoded json: %w", err)
+	}
+
+	canonical := &bytes.Buffer{}
+	if err := writeCanonical(canonical, generic); err != nil {
+		return nil, err
+	}
+	return canonical.Bytes(), nil
+}
+
+// Writes a generically decoded JSON value to buffer in canonical form.
+func writeCanonical(buffer *bytes.Buffer, value interface{}) error {
+	switch typed := value.(type) {
+	case nil:
+		buffer.WriteString("null")
+	case bool:
+		buffer.WriteString(strconv.FormatBool(typed))
+	case string:
+		writeCanonicalString(buffer, typed)
+	case json.Number:
+		return writeCanonicalNumber(buffer, typed)
+	case []interface{}:
+		return writeCanonicalArray(buffer, typed)
+	case map[string]interface{}:
+		return writeCanonicalObject(buffer, typed)
+	default:
+		return xerrors.Errorf("unexpected json value type %T", value)
+	}
+	return nil
+}
+
+func writeCanonicalArray(buffer *bytes.Buffer, array []interface{}) error {
+	buffer.WriteByte('[')
+	for i, value := range array {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		if err := writeCanonical(buffer, value); err != nil {
+			return err
+		}
+	}
+	buffer.WriteByte(']')
+	return nil
+}
+
+func writeCanonicalObject(buffer *bytes.Buffer, object map[string]interface{}) error {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessUTF16(keys[i], keys[j])
+	})
+
+	buffer.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		writeCanonicalString(buffer, key)
+		buffer.WriteByte(':')
+		if err := writeCanonical(buffer, object[key]); err != nil {
+			return err
+		}
+	}
+	buffer.WriteByte('}')
+	return nil
+}
+
+// Whether a sorts before b when compared as UTF-16 code units, as JCS requires.
+func lessUTF16(a string, b string) bool {
+	aUnits := utf16.Encode([]rune(a))
+	bUnits := utf16.Encode([]rune(b))
+
+	for i := 0; i < len(aUnits) && i < len(bUnits); i++ {
+		if aUnits[i] != bUnits[i] {
+			return aUnits[i] < bUnits[i]
+		}
+	}
+	return len(aUnits) < len(bUnits)
+}
+
+// Short escapes JCS requires for control characters. Other control characters are
+// written as \u00XX.
+var canonicalEscapes = map[rune]string{
+	'\b': `\b`,
+	'\t': `\t`,
+	'\n': `\n`,
+	'\f': `\f`,
+	'\r': `\r`,
+	'"':  `\"`,
+	'\\': `\\`,
+}
+
+func writeCanonicalString(buffer *bytes.Buffer, value string) {
+	buffer.WriteByte('"')
+	for _, char := range value {
+		if escaped, ok := canonicalEscapes[char]; ok {
+			buffer.WriteString(escaped)
+		} else if char < 0x20 {
+			buffer.WriteString(`\u00`)
+			buffer.WriteString(strconv.FormatInt(int64(char)>>4, 16))
+			buffer.WriteString(strconv.FormatInt(int64(char)&0xF, 16))
+		} else {
+			buffer.WriteRune(char)
+		}
+	}
+	buffer.WriteByte('"')
+}
+
+// Writes number the way ECMAScript's Number.prototype.toString() writes the closest
+// IEEE 754 double.
+func writeCanonicalNumber(buffer *bytes.Buffer, number json.Number) error {
+	value, err := strconv.ParseFloat(string(number), 64)
+	if err != nil {
+		return xerrors.Errorf("number %v cannot be canonicalized: %w", number, err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return xerrors.Errorf("number %v cannot be canonicalized", number)
+	}
+
+	if value == 0 {
+		buffer.WriteByte('0')
+		return nil
+	}
+	if value < 0 {
+		buffer.WriteByte('-')
+		value = -value
+	}
+
+	format := byte('e')
+	if value >= 1e-6 && value < 1e21 {
+		format = 'f'
+	}
+	formatted := strconv.FormatFloat(value, format, -1, 64)
+
+	// Go pads exponents to two digits ("1e+09") where ECMAScript does not ("1e+9").
+	if exponent := strings.IndexByte(formatted, 'e'); exponent > 0 {
+		if formatted[exponent+2] == '0' {
+			formatted = formatted[:exponent+2] + formatted[exponent+3:]
+		}
+	}
+
+	buffer.WriteString(formatted)
+	return nil
+}
@@ -0,0 +1,197 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// FieldDecodeError is returned by SpanEngine.DecodeCollectErrors() for each field which
+// could not be decoded.
+type FieldDecodeError struct {
+	// Dotted path of the field, by JSON name, like "house.points".
+	Field string
+	// Error from the decoder.
+	Err error
+}
+
+func (err *FieldDecodeError) Error() string {
+	return "field " + err.Field + ": " + err.Err.Error()
+}
+
+func (err *FieldDecodeError) Unwrap() error {
+	return err.Err
+}
+
+/*
+DecodeCollectErrors decodes like Decode(), but when decoding JSON into a pointer to a
+struct, decodes each field on its own and returns a *FieldDecodeError for every field
+which fails, rather than stopping at the first. Fields which decode are set, fields
+which fail are left as they were. Nested structs are decoded field by field as well.
+Lists and maps are decoded whole, so only their first error is reported. Object keys
+are matched to fields by their exact JSON name.
+
+Content in other formats or which is not a JSON object, receivers which are not a
+pointer to a struct or which decode themselves, and all content when an envelope is set
+through SetDecodeUnenvelope(), are decoded through Decode(), returning its error, if
+any, as the only element. nil is returned when there are no errors. A mimetype left out
+of SetAllowedMimeTypes() returns a *MimeTypeNotAllowedError as the only element.
+*/
+func (engine *SpanEngine) DecodeCollectErrors(
+	mimeType mimetype.MimeType, contentReceiver interface{}, reader io.Reader,
+) []error {
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return []error{err}
+	}
+
+	decoder, hasDecoder := engine.decoderFor(mimetype.JSON)
+	receiverValue := reflect.ValueOf(contentReceiver)
+
+	if mimeType != mimetype.JSON ||
+		!hasDecoder ||
+		engine.decodeUnenvelope != nil ||
+		!isStructPointer(receiverValue) {
+		return engine.decodeAllErrors(mimeType, contentReceiver, reader)
+	}
+
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	content, err := ioutil.ReadAll(engine.limitDecodeReader(reader))
+	if err != nil {
+		return []error{err}
+	}
+
+	engine.registryLock.RLock()
+	collector := &fieldErrorCollector{
+		engine:     engine,
+		decoder:    decoder,
+		extensions: engine.jsonExtensions,
+	}
+	engine.registryLock.RUnlock()
+
+	object, ok := collector.nestedObject(content, receiverValue.Type())
+	if !ok {
+		return engine.decodeAllErrors(
+			mimeType, contentReceiver, bytes.NewReader(content),
+		)
+	}
+	collector.decodeStruct(object, receiverValue.Elem(), "")
+
+	engine.transformDecoded(contentReceiver)
+	return collector.errs
+}
+
+// Decodes content through Decode(), returning its error as the only element.
+func (engine *SpanEngine) decodeAllErrors(
+	mimeType mimetype.MimeType, contentReceiver interface{}, reader io.Reader,
+) []error {
+	if _, err := engine.Decode(mimeType, contentReceiver, reader); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// Whether value is a non-nil pointer to a struct.
+func isStructPointer(value reflect.Value) bool {
+	return value.Kind() == reflect.Ptr &&
+		!value.IsNil() &&
+		value.Elem().Kind() == reflect.Struct
+}
+
+// Decodes JSON object members into struct fields one at a time, collecting the errors
+// of fields which fail.
+type fieldErrorCollector struct {
+	engine     *SpanEngine
+	decoder    Decoder
+	extensions []*JSONExtensionOpts
+	errs       []error
+}
+
+// Decodes the members of object into the fields of structValue, including the fields
+// of untagged embedded structs. Members with no matching field are ignored.
+func (collector *fieldErrorCollector) decodeStruct(
+	object map[string]json.RawMessage, structValue reflect.Value, path string,
+) {
+	structType := structValue.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		if isPromotedStruct(field) {
+			collector.decodeStruct(object, structValue.Field(i), path)
+			continue
+		}
+
+		name, _ := jsonFieldName(field)
+		raw, ok := object[name]
+		if field.PkgPath != "" || name == "-" || !ok {
+			continue
+		}
+		collector.decodeField(raw, structValue.Field(i), joinFieldPath(path, name))
+	}
+}
+
+// Decodes raw into fieldValue, descending into structs, which are decoded field by
+// field.
+func (collector *fieldErrorCollector) decodeField(
+	raw json.RawMessage, fieldValue reflect.Value, path string,
+) {
+	if object, ok := collector.nestedObject(raw, fieldValue.Type()); ok {
+		if fieldValue.Kind() == reflect.Ptr {
+			if fieldValue.IsNil() {
+				fieldValue.Set(reflect.New(fieldValue.Type().Elem()))
+			}
+			fieldValue = fieldValue.Elem()
+		}
+		collector.decodeStruct(object, fieldValue, path)
+		return
+	}
+
+	decoded := reflect.New(fieldValue.Type())
+	err := collector.engine.safeDecode(
+		collector.decoder, bytes.NewReader(raw), decoded.Interface(),
+	)
+	if err != nil {
+		collector.errs = append(collector.errs, &FieldDecodeError{Field: path, Err: err})
+		return
+	}
+	fieldValue.Set(decoded.Elem())
+}
+
+// Returns raw as an object if it is one and values of valueType are decoded field by
+// field. Structs which decode themselves or have a JSON extension are decoded whole.
+func (collector *fieldErrorCollector) nestedObject(
+	raw json.RawMessage, valueType reflect.Type,
+) (map[string]json.RawMessage, bool) {
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	if valueType.Kind() != reflect.Struct ||
+		implementsAny(valueType, jsonMarshalerTypes) ||
+		collector.hasExtension(valueType) {
+		return nil, false
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// Whether a JSON extension is registered for valueType or a pointer to it.
+func (collector *fieldErrorCollector) hasExtension(valueType reflect.Type) bool {
+	for _, extension := range collector.extensions {
+		if extension.ValueType == valueType ||
+			extension.ValueType == reflect.PtrTo(valueType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package encoding
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"golang.org/x/xerrors"
+	"io"
+	"strings"
+)
+
+// Content codings understood by DecodeWithEncoding() and EncodeWithEncoding(), as sent
+// in a Content-Encoding header. "deflate" is the zlib format, as HTTP specifies.
+const (
+	ContentEncodingIdentity = "identity"
+	ContentEncodingGzip     = "gzip"
+	ContentEncodingDeflate  = "deflate"
+)
+
+// UnsupportedEncodingError is returned when content is decoded from or encoded to a
+// Content-Encoding the engine cannot decompress / compress. Services will usually want
+// to respond to it with a 415.
+type UnsupportedEncodingError struct {
+	// The Content-Encoding which was requested.
+	ContentEncoding string
+}
+
+func (err *UnsupportedEncodingError) Error() string {
+	return "unsupported content encoding: '" + err.ContentEncoding + "'"
+}
+
+// Normalizes a Content-Encoding value, treating a blank value as identity and the
+// legacy "x-gzip" as gzip.
+func normalizeContentEncoding(contentEncoding string) string {
+	contentEncoding = strings.ToLower(strings.TrimSpace(contentEncoding))
+	switch contentEncoding {
+	case "":
+		return ContentEncodingIdentity
+	case "x-gzip":
+		return ContentEncodingGzip
+	}
+	return contentEncoding
+}
+
+// Wraps reader in a decompressor for contentEncoding, which must not be identity.
+func decompressReader(contentEncoding string, reader io.Reader) (io.ReadCloser, error) {
+	var decompressor io.ReadCloser
+	var err error
+
+	switch contentEncoding {
+	case ContentEncodingGzip:
+		decompressor, err = gzip.NewReader(reader)
+	case ContentEncodingDeflate:
+		decompressor, err = zlib.NewReader(reader)
+	default:
+		return nil, &UnsupportedEncodingError{ContentEncoding: contentEncoding}
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("error reading %v content: %w", contentEncoding, err)
+	}
+	return decompressor, nil
+}
+
+// Wraps writer in a compressor for contentEncoding, which must not be identity.
+func compressWriter(contentEncoding string, writer io.Writer) (io.WriteCloser, error) {
+	switch contentEncoding {
+	case ContentEncodingGzip:
+		return gzip.NewWriter(writer), nil
+	case ContentEncodingDeflate:
+		return zlib.NewWriter(writer), nil
+	}
+	return nil, &UnsupportedEncodingError{ContentEncoding: contentEncoding}
+}
+
+/*
+DecodeWithEncoding decodes like Decode(), but first decompresses the content read from
+reader according to contentEncoding, as sent in a Content-Encoding header. "gzip" and
+"deflate" are decompressed, while "identity" or a blank contentEncoding decode reader
+as-is.
+
+Any other contentEncoding returns an *UnsupportedEncodingError without reading from
+reader, rather than passing compressed bytes to the decoder. The limit set through
+SetMaxDecodeBytes() applies to the decompressed content.
+*/
+func (engine *SpanEngine) DecodeWithEncoding(
+	mimeType mimetype.MimeType,
+	contentEncoding string,
+	contentReceiver interface{},
+	reader io.Reader,
+) (mimetype.MimeType, error) {
+	contentEncoding = normalizeContentEncoding(contentEncoding)
+	if contentEncoding == ContentEncodingIdentity {
+		return engine.Decode(mimeType, contentReceiver, reader)
+	}
+
+	// Decode() only closes the decompressor, so close the reader here.
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	decompressor, err := decompressReader(contentEncoding, reader)
+	if err != nil {
+		return "", err
+	}
+	return engine.Decode(mimeType, contentReceiver, decompressor)
+}
+
+/*
+EncodeWithEncoding encodes like Encode(), but compresses the content written to writer
+according to contentEncoding, to be sent as a Content-Encoding header. "gzip" and
+"deflate" are compressed, while "identity" or a blank contentEncoding write content
+as-is.
+
+Any other contentEncoding returns an *UnsupportedEncodingError without writing
+anything. The limit set through SetMaxEncodeBytes() applies to the uncompressed
+content.
+*/
+func (engine *SpanEngine) EncodeWithEncoding(
+	mimeType mimetype.MimeType,
+	contentEncoding string,
+	content interface{},
+	writer io.Writer,
+) (mimetype.MimeType, error) {
+	contentEncoding = normalizeContentEncoding(contentEncoding)
+	if contentEncoding == ContentEncodingIdentity {
+		return engine.Encode(mimeType, content, writer)
+	}
+
+	compressor, err := compressWriter(contentEncoding, writer)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType, err = engine.Encode(mimeType, content, compressor)
+	if err != nil {
+		return "", err
+	}
+
+	// Closing flushes the remaining compressed content and footer to writer.
+	if err := compressor.Close(); err != nil {
+		return "", xerrors.Errorf("error writing %v content: %w", contentEncoding, err)
+	}
+	return mimeType, nil
+}
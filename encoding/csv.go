@@ -0,0 +1,198 @@
+package encoding
+
+import (
+	stdencoding "encoding"
+	"encoding/csv"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CSVTagKey is the struct tag used to map a field to a CSV header column, like
+// `csv:"first_name"`. Fields without the tag are matched to columns by field name,
+// ignoring case. Fields tagged `csv:"-"` are never decoded.
+const CSVTagKey = "csv"
+
+/*
+DecodeCSVStream decodes a CSV payload row by row without buffering the whole payload.
+
+The first row of the payload is read as the header. Each row after it is decoded into a
+fresh value of rowExample's struct type and passed to onRow as a pointer, so a
+rowExample of Name{} or &Name{} results in onRow receiving a *Name. Columns are matched
+to exported fields by CSVTagKey or field name, and columns without a matching field are
+ignored.
+
+Fields may be strings, bools, ints, uints, floats, or implement
+encoding.TextUnmarshaler. Quoted fields and newlines embedded in quoted fields are
+handled per encoding/csv.
+
+Decoding stops at the first error, whether from reading a row or returned by onRow.
+*/
+func DecodeCSVStream(
+	reader io.Reader, rowExample interface{}, onRow func(row interface{}) error,
+) error {
+	rowType := reflect.TypeOf(rowExample)
+	if rowType != nil && rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+	if rowType == nil || rowType.Kind() != reflect.Struct {
+		return xerrors.New("csv row example must be a struct or struct pointer")
+	}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return xerrors.Errorf("error reading csv header: %w", err)
+	}
+
+	indexes := csvFieldIndexes(header, rowType)
+	return decodeCSVRows(csvReader, rowType, indexes, onRow)
+}
+
+// Decodes every row remaining in csvReader, passing each to onRow.
+func decodeCSVRows(
+	csvReader *csv.Reader,
+	rowType reflect.Type,
+	indexes []int,
+	onRow func(row interface{}) error,
+) error {
+	for rowNumber := 1; ; rowNumber++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return xerrors.Errorf("error reading csv: %w", err)
+		}
+
+		row := reflect.New(rowType)
+		err = decodeCSVRecord(record, indexes, row.Elem())
+		if err != nil {
+			return xerrors.Errorf("error decoding csv row %v: %w", rowNumber, err)
+		}
+
+		err = onRow(row.Interface())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Decodes the columns of a single record into their fields on row.
+func decodeCSVRecord(record []string, indexes []int, row reflect.Value) error {
+	for column, text := range record {
+		if indexes[column] < 0 {
+			continue
+		}
+
+		err := setTextField(row.Field(indexes[column]), text)
+		if err != nil {
+			return xerrors.Errorf("column %v: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// Maps CSV header columns to the index of the struct field each decodes into. Columns
+// with no matching field are mapped to -1.
+func csvFieldIndexes(header []string, rowType reflect.Type) []int {
+	indexes := make([]int, len(header))
+	for column, name := range header {
+		indexes[column] = taggedFieldIndex(strings.TrimSpace(name), rowType, CSVTagKey)
+	}
+	return indexes
+}
+
+// Returns the index of the field on structType a key decodes into, or -1 if there is
+// none. Keys are matched to tagKey tags or field names, ignoring case.
+func taggedFieldIndex(key string, structType reflect.Type, tagKey string) int {
+	for i := 0; i < structType.NumField(); i++ {
+		name, ok := taggedFieldName(structType.Field(i), tagKey)
+		if ok && strings.EqualFold(name, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns the name for a struct field from its tagKey tag, falling back to the field
+// name, and false if the field is unexported or tagged "-".
+func taggedFieldName(field reflect.StructField, tagKey string) (string, bool) {
+	// Skip unexported fields.
+	if field.PkgPath != "" {
+		return "", false
+	}
+
+	tag, ok := field.Tag.Lookup(tagKey)
+	if !ok {
+		return field.Name, true
+	}
+
+	name := strings.Split(tag, ",")[0]
+	return name, name != "-"
+}
+
+// Parses text into field.
+func setTextField(field reflect.Value, text string) (err error) {
+	if unmarshaler, ok := field.Addr().Interface().(stdencoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(text))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		err = setTextBool(field, text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		err = setTextInt(field, text)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		err = setTextUint(field, text)
+	case reflect.Float32, reflect.Float64:
+		err = setTextFloat(field, text)
+	default:
+		err = xerrors.Errorf("unsupported field type %v", field.Type())
+	}
+
+	return err
+}
+
+func setTextBool(field reflect.Value, text string) error {
+	parsed, err := strconv.ParseBool(text)
+	if err != nil {
+		return err
+	}
+	field.SetBool(parsed)
+	return nil
+}
+
+func setTextInt(field reflect.Value, text string) error {
+	parsed, err := strconv.ParseInt(text, 10, field.Type().Bits())
+	if err != nil {
+		return err
+	}
+	field.SetInt(parsed)
+	return nil
+}
+
+func setTextUint(field reflect.Value, text string) error {
+	parsed, err := strconv.ParseUint(text, 10, field.Type().Bits())
+	if err != nil {
+		return err
+	}
+	field.SetUint(parsed)
+	return nil
+}
+
+func setTextFloat(field reflect.Value, text string) error {
+	parsed, err := strconv.ParseFloat(text, field.Type().Bits())
+	if err != nil {
+		return err
+	}
+	field.SetFloat(parsed)
+	return nil
+}
@@ -23,5 +23,10 @@ by creating their own encoding.
 
 5. All default encoding shipped with spantools can be easily extendable to handle
 custom types.
+
+Go versions
+
+The module supports Go 1.13 and up. The generic DecodeTyped() and EncodeTyped()
+functions are only built on Go 1.18 and up.
 */
 package encoding
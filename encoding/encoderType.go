@@ -1,6 +1,7 @@
 package encoding
 
 import (
+	"context"
 	"io"
 )
 
@@ -20,3 +21,43 @@ type Decoder interface {
 	// engine-level settings.
 	Decode(engine ContentEngine, reader io.Reader, contentReceiver interface{}) error
 }
+
+// Optional interface for encoders which can stop early when a context is done, like
+// when writing a large list. The engine calls EncodeContext() in place of Encode(),
+// passing context.Background() when encoding through Encode().
+type ContextEncoder interface {
+	// Like Encode(), but expected to return ctx.Err() promptly once ctx is done.
+	EncodeContext(
+		ctx context.Context, engine ContentEngine, writer io.Writer, content interface{},
+	) error
+}
+
+// Optional interface for decoders which can stop early when a context is done, like
+// when reading a large stream. The engine calls DecodeContext() in place of Decode(),
+// passing context.Background() when decoding through Decode().
+type ContextDecoder interface {
+	// Like Decode(), but expected to return ctx.Err() promptly once ctx is done.
+	DecodeContext(
+		ctx context.Context,
+		engine ContentEngine,
+		reader io.Reader,
+		contentReceiver interface{},
+	) error
+}
+
+// Optional interface for encoders and decoders which know the canonical file extension
+// of the content they handle, for things like CLIs and Content-Disposition headers.
+type FileExtensioner interface {
+	// Returns the file extension, including the leading ".", like ".json".
+	FileExtension() string
+}
+
+// Optional interface for decoders which can tell from the leading bytes of content
+// whether it could be theirs. When sniffing, decoders whose validator rejects the
+// content are skipped without being attempted, which keeps permissive decoders from
+// claiming content meant for others.
+type SniffValidator interface {
+	// Returns whether content starting with peek may be decoded. peek holds up to the
+	// first SniffPeekSize bytes of the content.
+	CanSniff(peek []byte) bool
+}
@@ -2,11 +2,16 @@ package encoding
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	uuid "github.com/satori/go.uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"golang.org/x/xerrors"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"sync"
 	"github.com/illuscio-dev/spantools-go/mimetype"
 )
 import "github.com/ugorji/go/codec"
@@ -29,6 +34,12 @@ type ContentEngine interface {
 	// Registers a decoder for a given mimetype.
 	SetDecoder(mimeType mimetype.MimeType, decoder Decoder)
 
+	// Removes the encoder registered for a given mimetype, if any.
+	RemoveEncoder(mimeType mimetype.MimeType)
+
+	// Removes the decoder registered for a given mimetype, if any.
+	RemoveDecoder(mimeType mimetype.MimeType)
+
 	// Returns true if the engine has a registered encoder for the mimetype.
 	HandlesEncode(mimeType mimetype.MimeType) bool
 
@@ -56,6 +67,24 @@ type ContentEngine interface {
 		writer io.Writer,
 	) (mimetype.MimeType, error)
 
+	// Decode like Decode(), returning ctx.Err() if ctx is done before the content is
+	// decoded. Decoders which implement ContextDecoder are passed ctx.
+	DecodeContext(
+		ctx context.Context,
+		mimeType mimetype.MimeType,
+		contentReceiver interface{},
+		reader io.Reader,
+	) (mimetype.MimeType, error)
+
+	// Encode like Encode(), returning ctx.Err() if ctx is done before the content is
+	// encoded. Encoders which implement ContextEncoder are passed ctx.
+	EncodeContext(
+		ctx context.Context,
+		mimeType mimetype.MimeType,
+		content interface{},
+		writer io.Writer,
+	) (mimetype.MimeType, error)
+
 	PickContentMimeType(
 		mimeType mimetype.MimeType, content interface{}, encoding bool,
 	) mimetype.MimeType
@@ -78,6 +107,18 @@ Default Mimetypes
 
 • application/bson
 
+• application/x-gob
+
+• application/yaml
+
+• application/x-www-form-urlencoded
+
+• application/x-ndjson
+
+• application/xml
+
+• application/msgpack
+
 Object encoding/decoders have been selected to be extensible, and SpanEngine exposes
 functions to let you add custom type handlers to each.
 
@@ -91,17 +132,32 @@ extensions. SpanEngine ships with the following types handled:
 
 • Binary blob data represented as []byte or *[]bytes are represented as a hex string.
 To signal that this conversion should take place, you must use the named type
-BinData in the "spantypes" package of this module.
+BinData in the "spantypes" package of this module. Blobs can be written as base64
+instead through SetBinDataEncoding().
+
+• BSON primitive.Binary data will be decoded as a string for 0x3 and 0x4 subtypes
+(UUID) and a hex (or base64) string for 0x0 subtype (arbitrary binary data). Other
+subtypes are not currently supported and will panic.
+
+• BSON raw is converted to a map and THEN encoded to a json object. Field order is
+lost unless SetJSONOrderedBSONRaw() is set, in which case fields, including those of
+embedded documents, are written in document order.
 
-• BSON primitive.Binary data will be decoded as a string for 0x3 subtype (UUID) and a
-hex string for 0x0 subtype (arbitrary binary data). Other subtypes are not currently
-supported and will panic.
+• time.Duration is written as a string like "1h30m0s" rather than a nanosecond count,
+and decoded from either. See SetJSONDurationNanos(). Durations are written as strings
+to yaml as well, but remain an int64 nanosecond count in bson so they can be queried.
 
-• BSON raw is converted to a map and THEN encoded to a json object.
+• time.Time is written as an RFC 3339 string with nanoseconds, or in the layout set
+through SetTimeLayout().
 
 Additional json extensions can be registered through the AddJSONExtensions() by passing
 a slice of JSONExtensionOpts objects.
 
+JSON is written compactly on a single line unless an indent is set through
+SetJSONIndent(), which suits debugging endpoints. Struct fields without a json tag are
+written under their Go field name unless a naming convention is set through
+SetJSONFieldNamer().
+
 Default BSON Codecs
 
 SpanEngine handles the encoding and decoding of Bson data through the official bson
@@ -112,23 +168,120 @@ here: https://godoc.org/go.mongodb.org/mongo-driver/bson/bsoncodec
 
 The following type extensions ship with SpanEngine:
 
-• primitive.Binary of subtype 0x3 can be decoded to / encoded from UUID objects from
-"github.com/satori/go.uuid".
+• primitive.Binary of subtype 0x3 or 0x4 can be decoded to UUID objects from
+"github.com/satori/go.uuid". UUIDs are encoded as subtype 0x3 for backwards
+compatibility, or as the subtype set through SetUUIDBsonSubtype().
 
 • primitive.Binary of subtype 0x0 can be decoded to / encoded from the BinData named
 type of []byte in the "spantypes" module.
 
+• time.Time is written as a datetime, or as a string if a string layout is set through
+SetTimeLayout(), and can be decoded from a datetime, a string or an int64.
+
+When decoding a bson list into a []interface{}, each document is decoded as a bson.M,
+as are any documents nested inside it.
+
+Bson documents only have string keys, so maps are encoded from / decoded into only when
+their key type is a string kind, including named string types like
+map[HouseName]int. Maps with any other key type, like map[int]string, return an error
+and must be converted to a string keyed map first.
+
+Default YAML
+
+SpanEngine handles yaml through gopkg.in/yaml.v2. Types which implement
+encoding.TextMarshaler are written as strings, so UUIDs and spantypes.BinData are
+represented the same way they are in json.
+
+Top-level lists are written as a stream of yaml documents separated by "---". Slices
+can be decoded from either a stream of documents or a single document holding a
+sequence. Mappings decoded into interface{} values are converted to
+map[string]interface{}, to match the json and bson decoders.
+
+When sniffing, yaml is attempted after all other decoders, since it will decode most
+json and plain text.
+
+Default Form
+
+application/x-www-form-urlencoded content can be encoded from / decoded into
+map[string]string or flat structs. Struct fields are matched to form keys by their
+`form:` tag or field name, ignoring case, and may be strings, bools, ints, uints,
+floats, or implement encoding.TextMarshaler / encoding.TextUnmarshaler. Nested structs,
+slices and maps return an error.
+
+Form decoding accepts nearly any content, so it is not attempted when sniffing unless
+set through SetSniffOrder().
+
+Default NDJSON
+
+application/x-ndjson content is encoded with the json handle, one compact document per
+line. Like bson, top-level lists are written as one document per element, and slices
+are decoded line by line. Empty lines are skipped.
+
+Default XML
+
+application/xml content, also matched from "text/xml", is handled through
+encoding/xml, so structs are shaped with `xml:` tags. XML has no top-level list, so
+slices and arrays are written as the children of a root element, named "list" by
+default (see SetXMLListRoot()), and slices are decoded from the children of the root
+element whatever its name. Types which implement encoding.TextMarshaler are written as
+the text of their element, so UUIDs and spantypes.BinData are represented the same way
+they are in json.
+
+Default MessagePack
+
+application/msgpack content, also matched from "application/x-msgpack", is handled
+through the codec library's msgpack handle (see MsgpackHandle()). The json extensions
+above, and any added through AddJSONExtensions(), are registered on the msgpack handle
+too, so UUIDs, BinData and durations round-trip. Extensions are tagged by the order they
+were added in, so both ends must register the same extensions in the same order.
+bson.Raw is only converted for json.
+
 Default Text/Plain Returns
 
 When encoding to plaintext, format.Sprint is used on the passed object, so any type
-can be sent and represented as text.
+can be sent and represented as text. Booleans are always written as "true" / "false",
+types which implement encoding.TextMarshaler are written as the text they marshal to,
+and nil values are written as an empty string (see SetTextNil()).
+
+Text can be decoded into a *string, into a *bool if the text is "true" or "false", or
+into a receiver which implements encoding.TextUnmarshaler.
+
+Custom formatting and parsing for named types, like a Money type, can be registered
+with RegisterTextFormatter() and RegisterTextParser(). These take precedence over the
+defaults above.
 
 Type Sniffing
 
 If created with "sniffMimeType" set to true, when decoding SpanEngine will attempt
-to use each decoder until one does not return an error or panic. Because decoders are
-internally stored in a map, the order of these attempts is not guaranteed to be
-consistent.
+to use each decoder until one does not return an error or panic. Decoders are attempted
+in the order they were registered, except that yaml and then text are attempted last,
+since they accept most content. For the default decoders this is json, bson, gob,
+ndjson, xml, msgpack, yaml, text. The order can be changed with SetSniffOrder() and
+inspected with SniffOrder().
+
+The exception is struct receivers with `json:`, `bson:`, `yaml:` or `xml:` field tags:
+the mimetypes hinted at by those tags are attempted first, most-tagged first. This can
+be turned off with SetSniffTagHints().
+
+Decoders may implement SniffValidator to be skipped when the leading bytes of content
+cannot be theirs. The default json decoder only sniffs content starting with an object
+or array, the default xml decoder content starting with a tag, and the default msgpack
+decoder content starting with a map or array.
+
+Content Negotiation
+
+NegotiateAccept() picks the registered encoder a client prefers from the entries of an
+Accept header, honoring quality values and wildcards. Ties go to the encoder registered
+first, so for the default encoders json is picked when any type is accepted. To
+negotiate against a fixed list of mimetypes instead, use mimetype.Negotiate().
+
+Concurrency
+
+SpanEngine is safe for concurrent use, including registering and removing encoders,
+decoders, json extensions and bson codecs while other goroutines encode and decode.
+Calls which are already underway finish with the encoders and decoders they started
+with. Other settings, like SetMaxListElements(), are not guarded and should be set
+before the engine is shared between goroutines.
 
 Panics
 
@@ -140,19 +293,106 @@ type SpanEngine struct {
 	encoders encoderMapping
 	// MimeType:Decoder mapping
 	decoders decoderMapping
-	// List of all registered decoders. Used for sniffing mimetype.
-	decoderList []Decoder
+	// Mimetypes of all registered encoders, in the order they were first registered.
+	// Used for picking a mimetype from an Accept header.
+	encoderOrder []mimetype.MimeType
+	// Type:Encoder mapping, consulted before the mimetype encoders.
+	typeEncoders map[reflect.Type]Encoder
+	// Used for mimetypes with no registered encoder / decoder, if set.
+	defaultEncoder Encoder
+	defaultDecoder Decoder
+	// Mimetypes of all registered decoders, in the order they were first registered.
+	// Used for sniffing mimetype.
+	decoderOrder []mimetype.MimeType
+	// Mimetypes to attempt first when sniffing, set through SetSniffOrder().
+	sniffOrderSet []mimetype.MimeType
+	// Only mimetypes which may be encoded / decoded, set through SetAllowedMimeTypes().
+	// All are allowed if empty.
+	allowedMimeTypes []mimetype.MimeType
 	// Whether to attempt decoding when no explicit mimetype is known.
 	sniffMimeType bool
+	// Whether to sniff content whose explicit mimetype has no registered decoder.
+	sniffOnUnregistered bool
+	// Whether to attempt mimetypes hinted at by a receiver's struct tags first when
+	// sniffing.
+	sniffTagHints bool
 
 	// JSON handle for default JSON encoder
 	jsonHandle *codec.JsonHandle
+	// Pooled encoders and decoders for jsonHandle, replaced along with it.
+	jsonCodecs *jsonCodecPool
+	// JSON extensions added to the handle, kept so they can be re-added by Clone().
+	jsonExtensions []*JSONExtensionOpts
+	// Msgpack handle for the default msgpack encoder, carrying jsonExtensions.
+	msgpackHandle *codec.MsgpackHandle
+	// Whether JSON numbers which overflow their integer field are rejected.
+	jsonRejectOverflow bool
+	// Whether JSON object keys are matched to struct fields ignoring case.
+	jsonCaseInsensitive bool
+	// Whether unknown JSON object keys are captured into a struct's extra field.
+	jsonCaptureExtra bool
+	// Whether time.Duration is written to JSON as a nanosecond count.
+	jsonDurationNanos bool
+	// Whether bson.Raw fields are written to JSON in document order.
+	jsonOrderedBSONRaw bool
+	// Prefix and indent for each line of encoded JSON. Compact when both are blank.
+	jsonIndentPrefix string
+	jsonIndent       string
+	// Renames untagged struct fields when encoding JSON. Nil leaves them as-is.
+	jsonFieldNamer func(fieldName string) string
+	// String encoding spantypes.BinData is written to JSON in.
+	binDataEncoding BinDataEncoding
+	// Layout time.Time is written to JSON and BSON in. Blank for each format's default.
+	timeLayout string
+	// Maximum number of elements to decode from a top-level list. 0 is unlimited.
+	maxListElements int
+	// Maximum number of bytes Encode() will write. 0 is unlimited.
+	maxEncodeBytes int
+	// Maximum number of bytes Decode() will read. 0 is unlimited.
+	maxDecodeBytes int64
 	// BSON registry for default BSON encoder
 	bsonRegistry *bsoncodec.Registry
 	// BSON codecs
 	bsonCodecs []*BsonCodecOpts
+	// Whether top-level bson scalars should be wrapped in a document.
+	bsonWrapScalars bool
+	// Whether top-level bson lists should be wrapped in a document.
+	bsonWrapLists bool
+	// Whether malformed UUIDs decode as uuid.Nil rather than returning an error.
+	lenientUUID bool
+	// Binary subtype UUIDs are written to bson as.
+	uuidBsonSubtype byte
+	// Applied to every string in a receiver after a successful decode.
+	stringTransform func(string) string
+	// Wraps content in an envelope before it is encoded.
+	encodeEnvelope func(content interface{}) interface{}
+	// Wraps receivers in an envelope to decode into.
+	decodeUnenvelope func(contentReceiver interface{}) interface{}
+	// Text written when encoding nil values to text/plain.
+	textNil string
+	// Whether surrounding whitespace is trimmed when decoding text/plain.
+	trimTextWhitespace bool
+	// contentType:function index of custom text/plain formatting, by exact type.
+	textFormatters map[reflect.Type]TextFormatter
+	// receiverType:function index of custom text/plain parsing, by exact type.
+	textParsers map[reflect.Type]TextParser
+	// Name of the root element top-level lists are wrapped in for xml. "" is the
+	// default.
+	xmlListRoot string
+	// Receives non-fatal warnings from the engine.
+	logger Logger
 	// Engine to pass to Encoder.Encoder() and Decoder.Decode() methods.
 	passedEngine ContentEngine
+
+	// cacheKey:mimetype index of the last type sniffed by DecodeWithCachedType().
+	sniffCache map[string]mimetype.MimeType
+	// Guards sniffCache.
+	sniffCacheLock sync.RWMutex
+
+	// Guards encoders, decoders, typeEncoders, the registration and sniff orders,
+	// textFormatters, textParsers, jsonHandle, jsonCodecs, jsonExtensions,
+	// msgpackHandle, bsonCodecs and bsonRegistry.
+	registryLock sync.RWMutex
 }
 
 // Change the engine passed into Encoder.Encode() and decoder.Decode()
@@ -162,23 +402,117 @@ func (engine *SpanEngine) SetPassedEngine(newEngine ContentEngine) {
 
 // Register an encoder for a given mimeType
 func (engine *SpanEngine) SetEncoder(mimeType mimetype.MimeType, encoder Encoder) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	// Keep track of registration order so content negotiation is deterministic.
+	if _, ok := engine.encoders[mimeType]; !ok {
+		engine.encoderOrder = append(engine.encoderOrder, mimeType)
+	}
+
 	engine.encoders[mimeType] = encoder
 }
 
+// Register an encoder used for all content of contentType, regardless of the mimetype
+// requested from Encode(). Encode() still returns the requested mimetype, so the
+// encoder should write content that mimetype can describe. A nil encoder removes the
+// registration.
+func (engine *SpanEngine) SetTypeEncoder(contentType reflect.Type, encoder Encoder) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	if encoder == nil {
+		delete(engine.typeEncoders, contentType)
+		return
+	}
+	engine.typeEncoders[contentType] = encoder
+}
+
 // Register a decoder for a given mimeType
 func (engine *SpanEngine) SetDecoder(mimeType mimetype.MimeType, decoder Decoder) {
-	// Set the encoder.
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	// Keep track of registration order so sniffing is deterministic. Replacing a
+	// decoder keeps its original position.
+	if _, ok := engine.decoders[mimeType]; !ok {
+		engine.decoderOrder = append(engine.decoderOrder, mimeType)
+	}
+
+	// Set the decoder.
 	engine.decoders[mimeType] = decoder
+}
+
+// Register an encoder used by Encode() for mimetypes with no encoder of their own,
+// rather than returning a "no encoder" error. Encode() still returns the requested
+// mimetype. HandlesEncode() only reports encoders registered for a mimetype. A nil
+// encoder removes the fallback.
+func (engine *SpanEngine) SetDefaultEncoder(encoder Encoder) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	engine.defaultEncoder = encoder
+}
+
+// The encoder used for mimetypes with no registered encoder. nil if not set.
+func (engine *SpanEngine) DefaultEncoder() Encoder {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.defaultEncoder
+}
+
+// Register a decoder used by Decode() for mimetypes with no decoder of their own,
+// rather than returning a "no decoder" error. Content is still sniffed instead if
+// SetSniffOnUnregistered() is on. HandlesDecode() only reports decoders registered for
+// a mimetype. A nil decoder removes the fallback.
+func (engine *SpanEngine) SetDefaultDecoder(decoder Decoder) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
 
-	// Cache a list of all the decoders we can use when mimetype sniffing. Because of
-	// this SNIFF ORDER IS NOT GUARANTEED.
-	engine.decoderList = make([]Decoder, len(engine.decoders))
-	index := 0
+	engine.defaultDecoder = decoder
+}
+
+// The decoder used for mimetypes with no registered decoder. nil if not set.
+func (engine *SpanEngine) DefaultDecoder() Decoder {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.defaultDecoder
+}
+
+// Removes the encoder registered for a given mimeType. Encoders registered for a type
+// through SetTypeEncoder() are not affected.
+func (engine *SpanEngine) RemoveEncoder(mimeType mimetype.MimeType) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	delete(engine.encoders, mimeType)
+	engine.encoderOrder = withoutMimeType(engine.encoderOrder, mimeType)
+}
+
+// Removes the decoder registered for a given mimeType, so it is no longer attempted
+// when sniffing. Registering a decoder for mimeType again puts it at the end of the
+// default sniff order.
+func (engine *SpanEngine) RemoveDecoder(mimeType mimetype.MimeType) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
 
-	for _, decoder := range engine.decoders {
-		engine.decoderList[index] = decoder
-		index++
+	delete(engine.decoders, mimeType)
+	engine.decoderOrder = withoutMimeType(engine.decoderOrder, mimeType)
+}
+
+// Returns a copy of order with mimeType removed.
+func withoutMimeType(
+	order []mimetype.MimeType, mimeType mimetype.MimeType,
+) []mimetype.MimeType {
+	kept := make([]mimetype.MimeType, 0, len(order))
+	for _, registered := range order {
+		if registered != mimeType {
+			kept = append(kept, registered)
+		}
 	}
+	return kept
 }
 
 // Whether SpanEngine will attempt to decode UNKNOWN content.
@@ -188,17 +522,50 @@ func (engine *SpanEngine) SniffType() bool {
 
 // Whether the SpanEngine has a registered encoder for mimeType.
 func (engine *SpanEngine) HandlesEncode(mimeType mimetype.MimeType) bool {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
 	_, ok := engine.encoders[mimeType]
 	return ok
 }
 
 // Whether the SpanEngine has a registered decoder for mimeType.
 func (engine *SpanEngine) HandlesDecode(mimeType mimetype.MimeType) bool {
-	// Register the decoder.
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
 	_, ok := engine.decoders[mimeType]
 	return ok
 }
 
+// Returns the decoder registered for mimeType, or the default decoder if there is none.
+func (engine *SpanEngine) decoderFor(mimeType mimetype.MimeType) (Decoder, bool) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	if decoder, ok := engine.decoders[mimeType]; ok {
+		return decoder, true
+	}
+	return engine.defaultDecoder, engine.defaultDecoder != nil
+}
+
+// Returns the encoder for content, preferring one registered for its type through
+// SetTypeEncoder() over the one registered for mimeType, then the default encoder.
+func (engine *SpanEngine) encoderFor(
+	mimeType mimetype.MimeType, content interface{},
+) (Encoder, bool) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	if encoder, ok := engine.typeEncoders[reflect.TypeOf(content)]; ok {
+		return encoder, true
+	}
+	if encoder, ok := engine.encoders[mimeType]; ok {
+		return encoder, true
+	}
+	return engine.defaultEncoder, engine.defaultEncoder != nil
+}
+
 // Whether the SpanEngine has a registered decoder AND encoder for mimeType.
 func (engine *SpanEngine) Handles(mimeType mimetype.MimeType) bool {
 	return engine.HandlesEncode(mimeType) && engine.HandlesDecode(mimeType)
@@ -219,6 +586,14 @@ func (engine *SpanEngine) getEngine() (passEngine ContentEngine) {
 // Uses a decoder while catching panics to return as errors
 func (engine *SpanEngine) safeEncode(
 	encoder Encoder, writer io.Writer, content interface{},
+) error {
+	return engine.safeEncodeContext(context.Background(), encoder, writer, content)
+}
+
+// Uses an encoder while catching panics to return as errors. ctx is passed to encoders
+// which implement ContextEncoder.
+func (engine *SpanEngine) safeEncodeContext(
+	ctx context.Context, encoder Encoder, writer io.Writer, content interface{},
 ) (err error) {
 	defer func() {
 		recovered := recover()
@@ -228,6 +603,9 @@ func (engine *SpanEngine) safeEncode(
 	}()
 
 	passEngine := engine.getEngine()
+	if contextEncoder, ok := encoder.(ContextEncoder); ok {
+		return contextEncoder.EncodeContext(ctx, passEngine, writer, content)
+	}
 	err = encoder.Encode(passEngine, writer, content)
 	return err
 }
@@ -235,6 +613,16 @@ func (engine *SpanEngine) safeEncode(
 // Uses a decoder while catching panics to return as errors
 func (engine *SpanEngine) safeDecode(
 	decoder Decoder, reader io.Reader, contentReceiver interface{},
+) error {
+	return engine.safeDecodeContext(
+		context.Background(), decoder, reader, contentReceiver,
+	)
+}
+
+// Uses a decoder while catching panics to return as errors. ctx is passed to decoders
+// which implement ContextDecoder.
+func (engine *SpanEngine) safeDecodeContext(
+	ctx context.Context, decoder Decoder, reader io.Reader, contentReceiver interface{},
 ) (err error) {
 	defer func() {
 		recovered := recover()
@@ -244,58 +632,90 @@ func (engine *SpanEngine) safeDecode(
 	}()
 
 	passEngine := engine.getEngine()
+	if contextDecoder, ok := decoder.(ContextDecoder); ok {
+		return contextDecoder.DecodeContext(ctx, passEngine, reader, contentReceiver)
+	}
 	err = decoder.Decode(passEngine, reader, contentReceiver)
 
 	return err
 }
 
-// Attempts to decode content with all registered decoders until one succeeds or all
-// fail.
-func (engine *SpanEngine) sniffContent(
-	contentReceiver interface{},
-	reader io.Reader,
-) (mimetype.MimeType, error) {
+// Reads all of reader for sniffing, returning the content and the peek passed to
+// SniffValidator decoders.
+func readSniffContent(reader io.Reader) (content []byte, peek []byte, err error) {
 	// We need to read the content multiple times, so lets load the bytes into a var.
 	// This will cause a slight performance hit, which is why this is a separate process
 	// from loading a KNOWN mimetype.
 	contentBuffer := bytes.NewBuffer(make([]byte, 0))
 	if _, err := contentBuffer.ReadFrom(reader); err != nil {
-		return "", xerrors.Errorf("error reading contentBytes: %w", err)
+		return nil, nil, xerrors.Errorf("error reading contentBytes: %w", err)
+	}
+
+	content = contentBuffer.Bytes()
+	peek = content
+	if len(peek) > SniffPeekSize {
+		peek = peek[:SniffPeekSize]
 	}
+	return content, peek, nil
+}
 
-	var decoderErr error
-	var decoded bool
-	var decodeMimetype mimetype.MimeType
+// Attempts to decode content with all registered decoders until one succeeds or all
+// fail. Decoders which implement SniffValidator and reject the content are skipped.
+// ctx is checked before each attempt.
+func (engine *SpanEngine) sniffContent(
+	ctx context.Context,
+	contentReceiver interface{},
+	reader io.Reader,
+) (mimetype.MimeType, error) {
+	content, peek, err := readSniffContent(reader)
+	if err != nil {
+		return "", err
+	}
 
-	for thisMimetype, decoder := range engine.decoders {
-		// Make a buffer for this attempt, otherwise we'll run out of bytes.
-		thisReader := bytes.NewBuffer(contentBuffer.Bytes())
-		thisErr := engine.safeDecode(decoder, thisReader, contentReceiver)
+	sniffErr := &SniffError{attempts: make(map[mimetype.MimeType]error)}
 
-		if thisErr != nil {
-			if decoderErr == nil {
-				decoderErr = thisErr
-			} else {
-				decoderErr = xerrors.Errorf(
-					"decoding error: %w after: %w", thisErr, decoderErr,
-				)
-			}
-		} else {
-			decoded = true
-			decodeMimetype = thisMimetype
-			break
+	order, decoders := engine.receiverSniffOrder(contentReceiver)
+	for _, thisMimetype := range order {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		thisErr := engine.sniffAttempt(
+			ctx, decoders[thisMimetype], content, peek, contentReceiver,
+		)
+		if thisErr == nil {
+			return thisMimetype, nil
 		}
+		sniffErr.attempts[thisMimetype] = thisErr
+	}
+
+	if len(sniffErr.attempts) == 0 {
+		return "", nil
 	}
+	return "", sniffErr
+}
 
-	if decoded {
-		decoderErr = nil
+// Attempts to decode content with decoder while sniffing. Returns errSniffRejected
+// without attempting the decode if decoder is a SniffValidator which rejects peek.
+func (engine *SpanEngine) sniffAttempt(
+	ctx context.Context,
+	decoder Decoder,
+	content []byte,
+	peek []byte,
+	contentReceiver interface{},
+) error {
+	if validator, ok := decoder.(SniffValidator); ok && !validator.CanSniff(peek) {
+		return errSniffRejected
 	}
 
-	return decodeMimetype, decoderErr
+	// Make a buffer for this attempt, otherwise we'll run out of bytes.
+	thisReader := bytes.NewBuffer(content)
+	return engine.safeDecodeContext(ctx, decoder, thisReader, contentReceiver)
 }
 
 // Picks the mimetype for encoding / decoding objects when source or target mimetype is
-// unknown.
+// unknown. Strings are picked as text, types which marshal themselves to bson but not
+// to json are picked as bson, and all other types as json. When decoding, only text and
+// bson are picked, leaving other receivers to be sniffed.
 func (engine *SpanEngine) PickContentMimeType(
 	mimeType mimetype.MimeType, content interface{}, encoding bool,
 ) mimetype.MimeType {
@@ -309,23 +729,127 @@ func (engine *SpanEngine) PickContentMimeType(
 			useType = mimetype.TEXT
 		default:
 			useType = mimetype.JSON
+			if marshalsOnlyBson(content) {
+				useType = mimetype.BSON
+			}
 		}
 
-		// If we are decoding, we only want to force a text decoding if the receiver is
-		// a string.
-		if encoding || useType == mimetype.TEXT {
+		// If we are decoding, we only want to force a decoding if the receiver is a
+		// string or can only be decoded from bson.
+		if encoding || useType != mimetype.JSON {
 			mimeType = useType
 		}
 	}
 	return mimeType
 }
 
+// Decode mimeType content from reader into contentReceiver, sniffing the mimetype if
+// it is UNKNOWN. Content is limited to the engine's SetMaxDecodeBytes(), if set.
 func (engine *SpanEngine) Decode(
 	mimeType mimetype.MimeType,
 	contentReceiver interface{},
 	reader io.Reader,
+) (mimetype.MimeType, error) {
+	return engine.DecodeLimited(mimeType, contentReceiver, reader, engine.maxDecodeBytes)
+}
+
+/*
+DecodeLimited decodes like Decode(), but returns a *PayloadTooLargeError if the content
+is longer than maxBytes, rather than whatever error the decoder returns for a truncated
+payload. At most maxBytes+1 bytes are read from reader, including when content is
+sniffed, so an oversized payload is never buffered whole. A maxBytes of 0 or less is
+unlimited.
+
+Decoders which stop reading at the end of a value, like the default json decoder, may
+succeed on content followed by more than maxBytes of trailing data.
+*/
+func (engine *SpanEngine) DecodeLimited(
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
+	maxBytes int64,
+) (mimetype.MimeType, error) {
+	return engine.decodeLimited(
+		context.Background(), mimeType, contentReceiver, reader, maxBytes,
+	)
+}
+
+/*
+DecodeContext decodes like Decode(), but stops early if ctx is cancelled or its deadline
+passes, returning ctx.Err(). ctx is checked before the content is handed to a decoder
+and, when sniffing, before each decoder is attempted. Decoders which implement
+ContextDecoder are passed ctx so they can stop mid-decode, like between the elements of
+a large list. Other decoders are used through their Decode() method, and will run to
+completion once started.
+
+If ctx holds a limit under MaxDecodeBytesKey, like one set by WithMaxDecodeBytes(), it
+is used in place of the engine's SetMaxDecodeBytes() for this call, so middleware can
+set limits per route without a separate engine for each.
+*/
+func (engine *SpanEngine) DecodeContext(
+	ctx context.Context,
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
+) (mimetype.MimeType, error) {
+	maxBytes := engine.maxDecodeBytes
+	if ctxMax, ok := MaxDecodeBytesFromContext(ctx); ok {
+		maxBytes = ctxMax
+	}
+	return engine.decodeLimited(ctx, mimeType, contentReceiver, reader, maxBytes)
+}
+
+// Decodes like DecodeLimited(), checking ctx before decoding.
+func (engine *SpanEngine) decodeLimited(
+	ctx context.Context,
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
+	maxBytes int64,
+) (mimetype.MimeType, error) {
+	if maxBytes <= 0 {
+		return engine.decode(ctx, mimeType, contentReceiver, reader)
+	}
+
+	// decode() cannot see through the limit to close the reader, so close it here.
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	limited := &limitedReader{reader: reader, remaining: maxBytes, max: maxBytes}
+	decodedType, err := engine.decode(ctx, mimeType, contentReceiver, limited)
+	if limited.exceeded {
+		return "", &PayloadTooLargeError{Max: maxBytes}
+	}
+	return decodedType, err
+}
+
+/*
+DecodeSniff decodes content of an unknown mimetype from reader into contentReceiver,
+returning the mimetype of the decoder which succeeded, so it can be echoed back in a
+Content-Type header. It is the same as Decode() with an UNKNOWN mimetype.
+
+Decoders are attempted in the order described by SniffOrder(). If none succeed,
+UNKNOWN is returned along with a *SniffError holding each decoder's error.
+*/
+func (engine *SpanEngine) DecodeSniff(
+	contentReceiver interface{}, reader io.Reader,
+) (mimetype.MimeType, error) {
+	return engine.Decode(mimetype.UNKNOWN, contentReceiver, reader)
+}
+
+// Decodes content from reader with no size limit, returning ctx.Err() if ctx is done
+// before the content is decoded.
+func (engine *SpanEngine) decode(
+	ctx context.Context,
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
 ) (mimetype.MimeType, error) {
 	mimeType = engine.PickContentMimeType(mimeType, contentReceiver, false)
+	contentReceiver = engine.unenvelopeReceiver(contentReceiver)
 
 	// Close the reader if it's a closer.
 	if readCloser, ok := reader.(io.ReadCloser); ok {
@@ -334,139 +858,1479 @@ func (engine *SpanEngine) Decode(
 		}()
 	}
 
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return "", err
+	}
+	mimeType = engine.sniffUnregistered(mimeType)
+
 	// If we want to sniff
 	if mimeType == mimetype.UNKNOWN {
-		if !engine.SniffType() {
-			return "", xerrors.New("mimetype is unknown and sniffing is disabled")
-		}
-		return engine.sniffContent(contentReceiver, reader)
+		return engine.decodeUnknown(ctx, contentReceiver, reader)
 	}
 
-	decoder, ok := engine.decoders[mimeType]
+	decoder, ok := engine.decoderFor(mimeType)
 	if !ok {
 		return "", xerrors.New("no decoder for " + string(mimeType))
 	}
 
-	err := engine.safeDecode(decoder, reader, contentReceiver)
+	err := engine.safeDecodeContext(ctx, decoder, reader, contentReceiver)
 	if err != nil {
 		return "", xerrors.Errorf("decode err: %w", err)
 	}
 
+	engine.transformDecoded(contentReceiver)
 	return mimeType, nil
 }
 
-func (engine *SpanEngine) Encode(
+// Returns the envelope registered through SetDecodeUnenvelope() holding
+// contentReceiver, or contentReceiver if there is none. Public decode methods call this
+// once, before handing the receiver to a decoder.
+func (engine *SpanEngine) unenvelopeReceiver(contentReceiver interface{}) interface{} {
+	if engine.decodeUnenvelope == nil {
+		return contentReceiver
+	}
+	return engine.decodeUnenvelope(contentReceiver)
+}
+
+// Returns UNKNOWN for mimetypes we have no decoder for if we are set to sniff them,
+// otherwise mimeType.
+func (engine *SpanEngine) sniffUnregistered(
 	mimeType mimetype.MimeType,
-	content interface{},
-	writer io.Writer,
+) mimetype.MimeType {
+	if !engine.sniffOnUnregistered ||
+		!engine.SniffType() ||
+		engine.HandlesDecode(mimeType) {
+		return mimeType
+	}
+
+	engine.logger(
+		LogLevelWarn,
+		"no decoder for mimetype, falling back to sniffing",
+		"mimetype", mimeType,
+	)
+	return mimetype.UNKNOWN
+}
+
+/*
+DecodeManyInto decodes a list into sliceReceiver, which must be a pointer to a slice,
+reusing the slice's existing elements to reduce allocations when slices are pooled.
+Existing elements are reset to their zero value and decoded into in place, further
+elements are appended, and the slice is truncated to the number of elements decoded.
+
+The default BSON decoder supports in-place decoding directly. Other decoders are
+passed the reset slice, which decoders like the default JSON decoder fill in place.
+mimeType must be known, as the content is not sniffed.
+*/
+func (engine *SpanEngine) DecodeManyInto(
+	mimeType mimetype.MimeType,
+	sliceReceiver interface{},
+	reader io.Reader,
 ) (mimetype.MimeType, error) {
-	mimeType = engine.PickContentMimeType(mimeType, content, true)
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	slicePointer := reflect.ValueOf(sliceReceiver)
+	if slicePointer.Kind() != reflect.Ptr || slicePointer.Elem().Kind() != reflect.Slice {
+		return "", xerrors.New("slice receiver must be a pointer to a slice")
+	}
+
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return "", err
+	}
 
-	encoder, ok := engine.encoders[mimeType]
+	decoder, ok := engine.decoderFor(mimeType)
 	if !ok {
-		return "", xerrors.New("no encoder for " + string(mimeType))
+		return "", xerrors.New("no decoder for " + string(mimeType))
 	}
+	// An enveloped slice is decoded through the envelope, which the bson reuse decoder
+	// does not handle.
+	enveloped := engine.decodeUnenvelope != nil
+	if _, isDefault := decoder.(*bsonEncoder); isDefault && !enveloped {
+		decoder = &bsonReuseDecoder{}
+	}
+
+	resetSliceElements(slicePointer.Elem())
 
-	err := engine.safeEncode(encoder, writer, content)
+	receiver := engine.unenvelopeReceiver(sliceReceiver)
+	err := engine.safeDecode(decoder, reader, receiver)
 	if err != nil {
-		return "", xerrors.Errorf(
-			"encode err: %w", err,
-		)
+		return "", xerrors.Errorf("decode err: %w", err)
 	}
-	return mimeType, nil
-}
 
-func (engine *SpanEngine) JSONHandle() *codec.JsonHandle {
-	return engine.jsonHandle
+	engine.transformDecoded(receiver)
+	return mimeType, nil
 }
 
-// Returns the internal bsoncodec.BSONRegistry used by the bson encoder/decoder.
-func (engine *SpanEngine) BSONRegistry() *bsoncodec.Registry {
-	return engine.bsonRegistry
+// Resets the existing elements of sliceValue to their zero value.
+func resetSliceElements(sliceValue reflect.Value) {
+	zero := reflect.Zero(sliceValue.Type().Elem())
+	for i := 0; i < sliceValue.Len(); i++ {
+		sliceValue.Index(i).Set(zero)
+	}
 }
 
-// Adds JSON extensions to handle.
-func (engine *SpanEngine) AddJSONExtensions(extensions []*JSONExtensionOpts) error {
-	for _, extOpts := range extensions {
-		err := engine.jsonHandle.SetInterfaceExt(
-			extOpts.ValueType, 1, extOpts.ExtInterface,
-		)
-		if err != nil {
-			return xerrors.Errorf(
-				"error adding json extension to content engine: %w", err,
-			)
-		}
+/*
+DecodeWithCachedType sniffs content like Decode() with an UNKNOWN mimetype, but
+remembers the mimetype that succeeded under cacheKey. The next call with the same
+cacheKey attempts that mimetype first, and only falls back to a full sniff if it fails.
+The cached attempt decodes into a new value of the type contentReceiver points to, which
+is copied to contentReceiver only if it succeeds, so a failed attempt leaves nothing
+behind for the sniff. Both attempts decode through the same path as Decode().
+
+This suits services which talk to the same clients repeatedly without a Content-Type,
+where cacheKey is a client id: once a client is known to send BSON, later bodies from
+it are not attempted as every other type first. The cache is not bounded, so keys
+should be drawn from a bounded set, or forgotten with ForgetCachedType().
+*/
+func (engine *SpanEngine) DecodeWithCachedType(
+	cacheKey string, contentReceiver interface{}, reader io.Reader,
+) (mimetype.MimeType, error) {
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
 	}
-	return nil
-}
 
-// Adds BSON codecs to engine for use when encoding/decoding bson data.
-func (engine *SpanEngine) AddBSONCodecs(codecs []*BsonCodecOpts) error {
-	// Store these codecs for later in case more are added by the end user and we need
-	// to declare a new engine.
-	engine.bsonCodecs = append(engine.bsonCodecs, codecs...)
+	// We may need to read the content twice.
+	content, err := ioutil.ReadAll(engine.limitDecodeReader(reader))
+	if err != nil {
+		return "", xerrors.Errorf("error reading content: %w", err)
+	}
 
-	builder := bsoncodec.NewRegistryBuilder()
-	bsoncodec.DefaultValueEncoders{}.RegisterDefaultEncoders(builder)
-	bsoncodec.DefaultValueDecoders{}.RegisterDefaultDecoders(builder)
+	if cachedType, ok := engine.decodeCachedType(cacheKey, contentReceiver, content); ok {
+		return cachedType, nil
+	}
 
-	for _, codecOpts := range codecs {
-		builder.RegisterCodec(codecOpts.ValueType, codecOpts.Codec)
+	sniffedType, err := engine.decode(
+		context.Background(), mimetype.UNKNOWN, contentReceiver, bytes.NewReader(content),
+	)
+	if err != nil {
+		return "", err
 	}
 
-	// Build the bson registry.
-	engine.bsonRegistry = builder.Build()
+	engine.sniffCacheLock.Lock()
+	defer engine.sniffCacheLock.Unlock()
+	engine.sniffCache[cacheKey] = sniffedType
 
-	// Now redeclare the json extension for bson raw with this registry so it has access
-	// to any additional codecs
-	err := engine.jsonHandle.SetInterfaceExt(
-		reflect.TypeOf(bson.Raw{}),
-		1,
-		&jsonExtBsonRaw{engine.bsonRegistry},
+	return sniffedType, nil
+}
+
+// Attempts to decode content as the type cached for cacheKey, returning the decoded
+// mimetype and whether it succeeded. Content is decoded into a new value, which is only
+// copied to contentReceiver on success, so a failed attempt leaves it untouched.
+func (engine *SpanEngine) decodeCachedType(
+	cacheKey string, contentReceiver interface{}, content []byte,
+) (mimetype.MimeType, bool) {
+	cachedType, ok := engine.CachedType(cacheKey)
+	receiverValue := reflect.ValueOf(contentReceiver)
+	if !ok || receiverValue.Kind() != reflect.Ptr || receiverValue.IsNil() {
+		return "", false
+	}
+
+	fresh := reflect.New(receiverValue.Type().Elem())
+	decodedType, err := engine.decode(
+		context.Background(), cachedType, fresh.Interface(), bytes.NewReader(content),
 	)
 	if err != nil {
-		return xerrors.Errorf(
-			"error building bson extension for json handle: %w", err,
-		)
+		return "", false
 	}
 
-	return nil
+	receiverValue.Elem().Set(fresh.Elem())
+	return decodedType, true
 }
 
-func NewContentEngine(allowSniff bool) (*SpanEngine, error) {
-	// Create the json handle.
-	jsonHandle := &codec.JsonHandle{}
+// CachedType returns the mimetype last sniffed for cacheKey by DecodeWithCachedType().
+func (engine *SpanEngine) CachedType(cacheKey string) (mimetype.MimeType, bool) {
+	engine.sniffCacheLock.RLock()
+	defer engine.sniffCacheLock.RUnlock()
+
+	cachedType, ok := engine.sniffCache[cacheKey]
+	return cachedType, ok
+}
+
+// ForgetCachedType removes the mimetype cached for cacheKey by DecodeWithCachedType().
+func (engine *SpanEngine) ForgetCachedType(cacheKey string) {
+	engine.sniffCacheLock.Lock()
+	defer engine.sniffCacheLock.Unlock()
+
+	delete(engine.sniffCache, cacheKey)
+}
+
+/*
+ReadContent decodes like Decode(), but first verifies the body read from reader is
+exactly contentLength bytes, as declared by a Content-Length header. A shorter body was
+likely truncated and a longer one padded, so both return an error before any decoding
+is attempted.
+
+Pass a negative contentLength when no Content-Length was sent, matching
+http.Request.ContentLength, to skip the check.
+*/
+func (engine *SpanEngine) ReadContent(
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
+	contentLength int64,
+) (mimetype.MimeType, error) {
+	if contentLength < 0 {
+		return engine.Decode(mimeType, contentReceiver, reader)
+	}
+
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	// Read one byte past the declared length so we can tell if the body is too long
+	// without reading an arbitrarily large body into memory.
+	content, err := ioutil.ReadAll(
+		io.LimitReader(engine.limitDecodeReader(reader), contentLength+1),
+	)
+	if err != nil {
+		return "", xerrors.Errorf("error reading content: %w", err)
+	}
+
+	if int64(len(content)) < contentLength {
+		return "", xerrors.Errorf(
+			"content is shorter than Content-Length of %v bytes", contentLength,
+		)
+	} else if int64(len(content)) > contentLength {
+		return "", xerrors.Errorf(
+			"content is longer than Content-Length of %v bytes", contentLength,
+		)
+	}
+
+	return engine.Decode(mimeType, contentReceiver, bytes.NewReader(content))
+}
+
+/*
+DecodeCounting decodes like Decode(), but also returns the number of bytes read from
+reader. When content is sniffed the whole payload is buffered before each decoder is
+attempted, so the count is the size of the payload the successful attempt decoded.
+
+The count is also sent to the engine's Logger at LogLevelDebug for metrics collection.
+*/
+func (engine *SpanEngine) DecodeCounting(
+	mimeType mimetype.MimeType,
+	contentReceiver interface{},
+	reader io.Reader,
+) (decodedType mimetype.MimeType, bytesConsumed int64, err error) {
+	// Decode() cannot see through the counter to close the reader, so close it here.
+	if readCloser, ok := reader.(io.ReadCloser); ok {
+		defer func() {
+			_ = readCloser.Close()
+		}()
+	}
+
+	counter := &countingReader{reader: reader}
+	decodedType, err = engine.Decode(mimeType, contentReceiver, counter)
+	if err != nil {
+		return decodedType, counter.count, err
+	}
+
+	engine.logger(
+		LogLevelDebug,
+		"decoded content",
+		"mimetype", decodedType,
+		"bytes", counter.count,
+	)
+	return decodedType, counter.count, nil
+}
+
+// Wraps a reader to count the bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (counter *countingReader) Read(buffer []byte) (int, error) {
+	read, err := counter.reader.Read(buffer)
+	counter.count += int64(read)
+	return read, err
+}
+
+// Decodes content with an unknown mimetype by sniffing, if sniffing is enabled.
+func (engine *SpanEngine) decodeUnknown(
+	ctx context.Context, contentReceiver interface{}, reader io.Reader,
+) (mimetype.MimeType, error) {
+	if !engine.SniffType() {
+		return "", xerrors.New("mimetype is unknown and sniffing is disabled")
+	}
+
+	sniffedType, err := engine.sniffContent(ctx, contentReceiver, reader)
+	if err != nil {
+		return "", err
+	}
+
+	engine.transformDecoded(contentReceiver)
+	return sniffedType, nil
+}
+
+// Applies any registered decode-time transformations to a decoded receiver.
+func (engine *SpanEngine) transformDecoded(contentReceiver interface{}) {
+	if engine.stringTransform != nil {
+		transformStrings(reflect.ValueOf(contentReceiver), engine.stringTransform)
+	}
+}
+
+func (engine *SpanEngine) Encode(
+	mimeType mimetype.MimeType,
+	content interface{},
+	writer io.Writer,
+) (mimetype.MimeType, error) {
+	return engine.encode(
+		context.Background(), mimeType, content, writer, engine.encodeEnvelope,
+	)
+}
+
+// EncodeContext encodes like Encode(), but returns ctx.Err() without writing anything
+// if ctx is cancelled or its deadline passes before the content is handed to an
+// encoder. Encoders which implement ContextEncoder are passed ctx so they can stop
+// mid-encode. Other encoders are used through their Encode() method.
+func (engine *SpanEngine) EncodeContext(
+	ctx context.Context,
+	mimeType mimetype.MimeType,
+	content interface{},
+	writer io.Writer,
+) (mimetype.MimeType, error) {
+	return engine.encode(ctx, mimeType, content, writer, engine.encodeEnvelope)
+}
+
+// Encodes content, returning ctx.Err() if ctx is done before the content is encoded.
+// The encoder is picked for content, which is then wrapped by envelope if it is not
+// nil. Only the public entry points pass the engine's envelope, so it is applied once.
+func (engine *SpanEngine) encode(
+	ctx context.Context,
+	mimeType mimetype.MimeType,
+	content interface{},
+	writer io.Writer,
+	envelope func(content interface{}) interface{},
+) (mimetype.MimeType, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	mimeType = engine.PickContentMimeType(mimeType, content, true)
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return "", err
+	}
+
+	encoder, ok := engine.encoderFor(mimeType, content)
+	if !ok {
+		return "", xerrors.New("no encoder for " + string(mimeType))
+	}
+
+	if envelope != nil {
+		content = envelope(content)
+	}
+
+	writer = engine.limitEncodeWriter(writer)
+	err := engine.safeEncodeContext(ctx, encoder, writer, content)
+	if err != nil {
+		return "", xerrors.Errorf(
+			"encode err: %w", err,
+		)
+	}
+	return mimeType, nil
+}
+
+// CanEncode reports whether content can be encoded as mimeType by running the encoder
+// without keeping its output, returning the error Encode() would have returned. Useful
+// for validating content before committing to a write.
+func (engine *SpanEngine) CanEncode(
+	mimeType mimetype.MimeType, content interface{},
+) error {
+	_, err := engine.Encode(mimeType, content, ioutil.Discard)
+	return err
+}
+
+// EncodeToBytes encodes content as mimeType like Encode(), returning the encoded bytes.
+func (engine *SpanEngine) EncodeToBytes(
+	mimeType mimetype.MimeType, content interface{},
+) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if _, err := engine.Encode(mimeType, content, buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// DecodeBytes decodes data into contentReceiver like Decode(). data is not modified,
+// including when an UNKNOWN mimetype is sniffed.
+func (engine *SpanEngine) DecodeBytes(
+	mimeType mimetype.MimeType, contentReceiver interface{}, data []byte,
+) error {
+	_, err := engine.Decode(mimeType, contentReceiver, bytes.NewReader(data))
+	return err
+}
+
+// RoundTripCheck encodes content as mimeType, decodes the result into a fresh value of
+// the same type, and reports whether the decoded value is deeply equal to content.
+// Pointer content is compared by what it points to. Useful for catching lossy
+// conversions, like float precision, before committing to a format. Errors from the
+// encoder or decoder are returned as-is.
+func (engine *SpanEngine) RoundTripCheck(
+	mimeType mimetype.MimeType, content interface{},
+) (bool, error) {
+	contentType := reflect.TypeOf(content)
+	if contentType == nil {
+		return false, xerrors.New("cannot round trip nil content")
+	}
+
+	buffer := &bytes.Buffer{}
+	if _, err := engine.Encode(mimeType, content, buffer); err != nil {
+		return false, err
+	}
+
+	isPointer := contentType.Kind() == reflect.Ptr
+	if isPointer {
+		contentType = contentType.Elem()
+	}
+
+	receiver := reflect.New(contentType)
+	if _, err := engine.Decode(mimeType, receiver.Interface(), buffer); err != nil {
+		return false, err
+	}
+
+	loaded := receiver.Interface()
+	if !isPointer {
+		loaded = receiver.Elem().Interface()
+	}
+	return reflect.DeepEqual(content, loaded), nil
+}
+
+// EncodeBSONWithID encodes content as a single BSON document to writer, injecting a
+// fresh primitive.ObjectID as "_id" if the document does not already have one. This is
+// a convenience for write paths to MongoDB, which requires every document to have an
+// "_id". If an envelope is set through SetEncodeEnvelope(), the "_id" is injected into
+// content before it is enveloped.
+func (engine *SpanEngine) EncodeBSONWithID(
+	content interface{}, writer io.Writer,
+) error {
+	buffer := &bytes.Buffer{}
+	_, err := engine.encode(context.Background(), mimetype.BSON, content, buffer, nil)
+	if err != nil {
+		return err
+	}
+
+	document, err := injectBsonID(buffer.Bytes())
+	if err != nil {
+		return xerrors.Errorf("encode err: %w", err)
+	}
+
+	if engine.encodeEnvelope == nil {
+		_, err = writer.Write(document)
+		return err
+	}
+
+	_, err = engine.encode(
+		context.Background(),
+		mimetype.BSON,
+		bson.Raw(document),
+		writer,
+		engine.encodeEnvelope,
+	)
+	return err
+}
+
+// ExtensionFor returns the canonical file extension for mimeType, like ".json", if the
+// encoder or decoder registered for it implements FileExtensioner.
+func (engine *SpanEngine) ExtensionFor(mimeType mimetype.MimeType) (string, bool) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	if extensioner, ok := engine.encoders[mimeType].(FileExtensioner); ok {
+		return extensioner.FileExtension(), true
+	}
+	if extensioner, ok := engine.decoders[mimeType].(FileExtensioner); ok {
+		return extensioner.FileExtension(), true
+	}
+	return "", false
+}
+
+// Returns the internal codec.JsonHandle used by the json encoder/decoder. Adding
+// extensions or bson codecs replaces the handle with a copy rather than changing it
+// while it may be in use, so options should be set on the handle before adding them.
+// Only the options copied by Clone() are carried over to the replacement.
+//
+// The json encoder and decoder re-use pooled codec encoders and decoders made with the
+// handle, so options should also be set before the engine is first used.
+func (engine *SpanEngine) JSONHandle() *codec.JsonHandle {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.jsonHandle
+}
+
+// Returns the internal codec.MsgpackHandle used by the msgpack encoder/decoder. Like
+// JSONHandle(), it is replaced with a new handle when json extensions are added.
+func (engine *SpanEngine) MsgpackHandle() *codec.MsgpackHandle {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.msgpackHandle
+}
+
+// Replaces the json handle, along with the pool of encoders and decoders made with it.
+// The caller must hold registryLock for writing.
+func (engine *SpanEngine) setJSONHandle(handle *codec.JsonHandle) {
+	engine.jsonHandle = handle
+	engine.jsonCodecs = newJSONCodecPool(handle)
+}
+
+// Returns the pool of encoders and decoders for the current json handle.
+func (engine *SpanEngine) jsonCodecPool() *jsonCodecPool {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.jsonCodecs
+}
+
+// Returns the internal bsoncodec.BSONRegistry used by the bson encoder/decoder.
+func (engine *SpanEngine) BSONRegistry() *bsoncodec.Registry {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.bsonRegistry
+}
+
+// Registers a hook to receive the engine's internal, non-fatal warnings, so they can be
+// routed through a host application's structured logger. By default these messages are
+// discarded. Pass nil to restore the default.
+func (engine *SpanEngine) SetLogger(logger Logger) {
+	if logger == nil {
+		logger = noopLogger
+	}
+	engine.logger = logger
+}
+
+// Sets the text written when a nil value is encoded to text/plain. Defaults to an
+// empty string.
+func (engine *SpanEngine) SetTextNil(text string) {
+	engine.textNil = text
+}
+
+// Sets whether surrounding whitespace, like the trailing newline of "hello\n", is
+// trimmed when decoding text/plain. Off by default so decoded text matches what was
+// sent exactly.
+func (engine *SpanEngine) SetTrimTextWhitespace(trim bool) {
+	engine.trimTextWhitespace = trim
+}
+
+// Sets the name of the root element top-level lists are wrapped in when encoded to
+// application/xml. Defaults to XMLListRootDefault, "list". Passing "" restores the
+// default. Decoding accepts a root element of any name.
+func (engine *SpanEngine) SetXMLListRoot(name string) {
+	engine.xmlListRoot = name
+}
+
+// XMLListRoot returns the name of the root element top-level lists are wrapped in when
+// encoded to application/xml.
+func (engine *SpanEngine) XMLListRoot() string {
+	if engine.xmlListRoot == "" {
+		return XMLListRootDefault
+	}
+	return engine.xmlListRoot
+}
+
+// TextFormatter formats content as text/plain. See SpanEngine.RegisterTextFormatter().
+type TextFormatter func(content interface{}) (string, error)
+
+// TextParser parses text/plain into a value. See SpanEngine.RegisterTextParser().
+type TextParser func(text string) (interface{}, error)
+
+// Registers formatter to write content of contentType to text/plain in place of the
+// default formatting, like fmt.Sprint(). Content is matched by its exact dynamic type,
+// so register Money and *Money separately to format both. A nil formatter removes the
+// registration.
+func (engine *SpanEngine) RegisterTextFormatter(
+	contentType reflect.Type, formatter TextFormatter,
+) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	if formatter == nil {
+		delete(engine.textFormatters, contentType)
+		return
+	}
+	engine.textFormatters[contentType] = formatter
+}
+
+// Registers parser to decode text/plain into receivers which point to receiverType,
+// like a *Money receiver for a receiverType of Money. parser must return a value
+// assignable to receiverType, which is set on the receiver. A nil parser removes the
+// registration.
+func (engine *SpanEngine) RegisterTextParser(
+	receiverType reflect.Type, parser TextParser,
+) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	if parser == nil {
+		delete(engine.textParsers, receiverType)
+		return
+	}
+	engine.textParsers[receiverType] = parser
+}
+
+// Returns the formatter registered for the dynamic type of content.
+func (engine *SpanEngine) textFormatterFor(content interface{}) (TextFormatter, bool) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	formatter, ok := engine.textFormatters[reflect.TypeOf(content)]
+	return formatter, ok
+}
+
+// Returns the parser registered for the type contentReceiver points to. Nil pointers
+// have no parser, since the parsed value cannot be set on them.
+func (engine *SpanEngine) textParserFor(
+	contentReceiver interface{},
+) (TextParser, bool) {
+	receiverValue := reflect.ValueOf(contentReceiver)
+	if receiverValue.Kind() != reflect.Ptr || receiverValue.IsNil() {
+		return nil, false
+	}
+	receiverType := receiverValue.Type()
+
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	parser, ok := engine.textParsers[receiverType.Elem()]
+	return parser, ok
+}
+
+// When set to true and sniffing is enabled, Decode() will sniff content whose mimetype
+// was given explicitly but has no registered decoder (like "application/json5") rather
+// than returning a "no decoder" error. Off by default.
+func (engine *SpanEngine) SetSniffOnUnregistered(sniff bool) {
+	engine.sniffOnUnregistered = sniff
+}
+
+// Whether content with an unregistered mimetype is sniffed when decoding.
+func (engine *SpanEngine) SniffOnUnregistered() bool {
+	return engine.sniffOnUnregistered
+}
+
+// Sets the maximum number of elements the default JSON and BSON decoders will decode
+// from a top-level list. Longer lists return an error before the extra elements are
+// decoded, guarding against clients exhausting memory. 0, the default, is unlimited.
+func (engine *SpanEngine) SetMaxListElements(max int) {
+	engine.maxListElements = max
+}
+
+// Returns an error if a list with count elements exceeds the engine's maximum.
+func (engine *SpanEngine) checkListLength(count int) error {
+	if engine.maxListElements > 0 && count > engine.maxListElements {
+		return xerrors.Errorf(
+			"list exceeds maximum of %v elements", engine.maxListElements,
+		)
+	}
+	return nil
+}
+
+// Sets the maximum number of bytes Encode() will write, guarding against runaway
+// encodes like recursive structures. An encode which exceeds the maximum is aborted
+// with an error, though output up to the maximum may already have been written. 0, the
+// default, is unlimited.
+func (engine *SpanEngine) SetMaxEncodeBytes(max int) {
+	engine.maxEncodeBytes = max
+}
+
+// Limits writes to writer to the engine's maximum encode size, if one is set.
+func (engine *SpanEngine) limitEncodeWriter(writer io.Writer) io.Writer {
+	if engine.maxEncodeBytes <= 0 {
+		return writer
+	}
+	return &limitedWriter{
+		writer:    writer,
+		remaining: engine.maxEncodeBytes,
+		max:       engine.maxEncodeBytes,
+	}
+}
+
+// Writer which errors once more than a maximum number of bytes are written to it.
+type limitedWriter struct {
+	writer    io.Writer
+	remaining int
+	max       int
+}
+
+func (limited *limitedWriter) Write(content []byte) (int, error) {
+	if len(content) > limited.remaining {
+		return 0, xerrors.Errorf(
+			"encoded output exceeds maximum of %v bytes", limited.max,
+		)
+	}
+
+	written, err := limited.writer.Write(content)
+	limited.remaining -= written
+	return written, err
+}
+
+// Sets the maximum number of bytes Decode() will read. Longer content returns a
+// *PayloadTooLargeError. See DecodeLimited() for details. 0, the default, is unlimited.
+// DecodeWithCachedType(), ReadContent() and DecodeCounting() are limited as well.
+func (engine *SpanEngine) SetMaxDecodeBytes(max int64) {
+	engine.maxDecodeBytes = max
+}
+
+// Returns the maximum number of bytes Decode() will read. 0 is unlimited.
+func (engine *SpanEngine) MaxDecodeBytes() int64 {
+	return engine.maxDecodeBytes
+}
+
+// Type of the keys this package stores context values under.
+type contextKey struct {
+	name string
+}
+
+// Context key for the maximum number of bytes DecodeContext() will read, overriding
+// the engine's SetMaxDecodeBytes(). The value must be an int64. 0 is unlimited.
+var MaxDecodeBytesKey = &contextKey{name: "max-decode-bytes"}
+
+// Returns a copy of ctx which limits DecodeContext() to reading max bytes. See
+// MaxDecodeBytesKey.
+func WithMaxDecodeBytes(ctx context.Context, max int64) context.Context {
+	return context.WithValue(ctx, MaxDecodeBytesKey, max)
+}
+
+// Returns the limit stored in ctx under MaxDecodeBytesKey, and whether one was set.
+func MaxDecodeBytesFromContext(ctx context.Context) (int64, bool) {
+	max, ok := ctx.Value(MaxDecodeBytesKey).(int64)
+	return max, ok
+}
+
+// Limits reads from reader to the engine's maximum decode size, if one is set.
+func (engine *SpanEngine) limitDecodeReader(reader io.Reader) io.Reader {
+	if engine.maxDecodeBytes <= 0 {
+		return reader
+	}
+	return &limitedReader{
+		reader:    reader,
+		remaining: engine.maxDecodeBytes,
+		max:       engine.maxDecodeBytes,
+	}
+}
+
+// PayloadTooLargeError is returned when content to decode is longer than the maximum
+// set through SetMaxDecodeBytes() or passed to DecodeLimited(). Services will usually
+// want to respond to it with a 413.
+type PayloadTooLargeError struct {
+	// The maximum number of bytes that could have been decoded.
+	Max int64
+}
+
+func (err *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("payload exceeds %v bytes", err.Max)
+}
+
+// Reader which errors once more than a maximum number of bytes are read from it.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+	max       int64
+	// Whether more than max bytes were available.
+	exceeded bool
+}
+
+func (limited *limitedReader) Read(buffer []byte) (int, error) {
+	// Read one byte past the limit so we can tell if the content is too long without
+	// reading any more of it.
+	if int64(len(buffer)) > limited.remaining+1 {
+		buffer = buffer[:limited.remaining+1]
+	}
+
+	read, err := limited.reader.Read(buffer)
+	if int64(read) > limited.remaining {
+		limited.exceeded = true
+		read = int(limited.remaining)
+		limited.remaining = 0
+		return read, &PayloadTooLargeError{Max: limited.max}
+	}
+
+	limited.remaining -= int64(read)
+	return read, err
+}
+
+// Sets whether the default JSON decoder rejects numbers which do not fit the integer
+// field they are decoded into, returning an error like:
+//
+//	value 300 overflows int8 field Inner.Count
+//
+// Checking requires the content to be buffered and parsed a second time, so it is off
+// by default.
+func (engine *SpanEngine) SetJSONRejectOverflow(reject bool) {
+	engine.jsonRejectOverflow = reject
+}
+
+// Sets whether the default JSON decoder matches object keys to struct fields ignoring
+// case, so {"first": "Harry"} decodes into a First field. When a key is sent in more
+// than one case, an exact match takes precedence, then the first sent. Fields which
+// differ only by case are matched to the first declared. Matching requires the content
+// to be buffered and parsed a second time, so it is off by default.
+func (engine *SpanEngine) SetJSONCaseInsensitive(ignoreCase bool) {
+	engine.jsonCaseInsensitive = ignoreCase
+}
+
+// Whether the default JSON decoder matches object keys to struct fields ignoring case.
+func (engine *SpanEngine) JSONCaseInsensitive() bool {
+	return engine.jsonCaseInsensitive
+}
+
+/*
+When set to true, the default JSON decoder captures object keys which match no field
+of the struct they are decoded into in the struct's extra field, for models which need
+to keep fields added by newer clients. The extra field is a map with string keys,
+tagged with JSONExtraTagOption:
+
+	type Wizard struct {
+		Name  string                 `json:"name"`
+		Extra map[string]interface{} `json:",extra" codec:"-"`
+	}
+
+Captured values are decoded as the codec would decode them into the map, and the
+field is replaced on every decode, left nil when there are no unknown keys. Structs
+nested in fields, slices and arrays are captured as well. Without the `codec:"-"` tag
+the extra field is also encoded and decoded as a regular field named "Extra".
+
+Capturing requires the content to be buffered and parsed a second time, so it is off
+by default.
+*/
+func (engine *SpanEngine) SetJSONCaptureExtra(capture bool) {
+	engine.jsonCaptureExtra = capture
+}
+
+// Whether the default JSON decoder captures unknown object keys into extra fields.
+func (engine *SpanEngine) JSONCaptureExtra() bool {
+	return engine.jsonCaptureExtra
+}
+
+// When set to true, time.Duration values are written to JSON as an int64 nanosecond
+// count, for consumers which expect the codec's default output. Off by default, in
+// which case they are written as strings like "1h30m0s". Either form is decoded.
+func (engine *SpanEngine) SetJSONDurationNanos(nanos bool) {
+	engine.jsonDurationNanos = nanos
+}
+
+// Whether time.Duration values are written to JSON as a nanosecond count.
+func (engine *SpanEngine) JSONDurationNanos() bool {
+	return engine.jsonDurationNanos
+}
+
+// When set to true, bson.Raw values are written to JSON with their fields in document
+// order, for canonical re-encoding and clients which display fields as stored. Off by
+// default, in which case they are converted to a map first and field order is lost.
+func (engine *SpanEngine) SetJSONOrderedBSONRaw(ordered bool) {
+	engine.jsonOrderedBSONRaw = ordered
+}
+
+// Whether bson.Raw values are written to JSON with their fields in document order.
+func (engine *SpanEngine) JSONOrderedBSONRaw() bool {
+	return engine.jsonOrderedBSONRaw
+}
+
+/*
+Sets the default JSON encoder to write indented, human-readable JSON. Like
+json.MarshalIndent(), each element of an object or array begins on a new line starting
+with prefix, followed by one copy of indent for each level of nesting:
+
+	engine.SetJSONIndent("", "  ")
+
+Passing blank strings for both restores compact output, which is the default.
+Indentation only applies to Encode() with the JSON mimetype. Other JSON output, like
+NDJSON lines and EncodeCanonical(), stays compact.
+*/
+func (engine *SpanEngine) SetJSONIndent(prefix string, indent string) {
+	engine.jsonIndentPrefix = prefix
+	engine.jsonIndent = indent
+}
+
+// The prefix and indent set through SetJSONIndent(). Both are blank when JSON is
+// written compactly.
+func (engine *SpanEngine) JSONIndent() (string, string) {
+	return engine.jsonIndentPrefix, engine.jsonIndent
+}
+
+/*
+Sets whether the default JSON encoder writes map keys in sorted order, through the json
+handle's Canonical option, so the same map is always encoded to the same bytes. Useful
+when JSON bodies are hashed for cache keys or signatures. Struct fields are always
+written in the order they are declared, so this mostly affects maps, like
+map[string]interface{} payloads and SpanError.ErrorData. Off by default.
+
+Unlike EncodeCanonical(), numbers and strings are written as usual. The json handle is
+replaced with a copy carrying the option, like when extensions are added.
+*/
+func (engine *SpanEngine) SetJSONCanonical(canonical bool) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	base := cloneJSONHandle(engine.jsonHandle)
+	base.Canonical = canonical
+
+	// These were all added to the current handle without error, so can be added again.
+	handle, err := engine.buildJSONHandle(base, engine.jsonExtensions, engine.bsonRegistry)
+	if err != nil {
+		panic(xerrors.Errorf("error re-adding json extensions: %w", err))
+	}
+	engine.setJSONHandle(handle)
+}
+
+// Whether the default JSON encoder writes map keys in sorted order.
+func (engine *SpanEngine) JSONCanonical() bool {
+	return engine.JSONHandle().Canonical
+}
+
+/*
+Sets a function the default JSON encoder passes the Go name of each struct field
+without a json or codec name tag, writing the field under the name it returns. This lets
+a whole API adopt a naming convention, like snake_case, without tagging every struct.
+Fields with a name tag are written under that name, and map keys are never renamed.
+
+Fields are renamed by rewriting the encoded content, so only structs whose type is
+known when encoding are renamed: structs held in interface{} fields or elements, like
+those of a []interface{}, are written as-is. Decoding is not affected. Pass nil to
+write fields under their Go names again, which is the default.
+*/
+func (engine *SpanEngine) SetJSONFieldNamer(namer func(fieldName string) string) {
+	engine.jsonFieldNamer = namer
+}
+
+// The function set through SetJSONFieldNamer(), or nil if none is set.
+func (engine *SpanEngine) JSONFieldNamer() func(fieldName string) string {
+	return engine.jsonFieldNamer
+}
+
+// Sets the string encoding spantypes.BinData is written to and read from JSON in.
+// Defaults to BinDataHex. BinDataBase64 keeps large blobs smaller, but since the mode
+// is engine-wide, both sides of a transfer must use the same one: a base64 engine will
+// not read hex, nor the reverse.
+func (engine *SpanEngine) SetBinDataEncoding(mode BinDataEncoding) {
+	engine.binDataEncoding = mode
+}
+
+// BinDataEncoding returns the string encoding spantypes.BinData is written to JSON in.
+func (engine *SpanEngine) BinDataEncoding() BinDataEncoding {
+	return engine.binDataEncoding
+}
+
+// Sets whether sniffing attempts the mimetypes hinted at by a struct receiver's tags
+// first. For instance, a receiver whose fields only have `json:` tags will have JSON
+// attempted before any other decoder. Enabled by default.
+func (engine *SpanEngine) SetSniffTagHints(useHints bool) {
+	engine.sniffTagHints = useHints
+}
+
+// Whether sniffing attempts the mimetypes hinted at by a struct receiver's tags first.
+func (engine *SpanEngine) SniffTagHints() bool {
+	return engine.sniffTagHints
+}
+
+// Sets the mimetypes to attempt first when sniffing, in order. Registered decoders not
+// in order are attempted after, in their default order. Mimetypes hinted at by a
+// receiver's struct tags are still attempted before order unless SetSniffTagHints() is
+// turned off. Pass nil to restore the default order.
+func (engine *SpanEngine) SetSniffOrder(order []mimetype.MimeType) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	engine.sniffOrderSet = append([]mimetype.MimeType(nil), order...)
+}
+
+// Restricts the mimetypes Encode() and Decode() will handle to allowed, even if
+// encoders or decoders are registered for others, which return a
+// *MimeTypeNotAllowedError instead. Sniffing only attempts allowed mimetypes. Pass nil
+// to allow all mimetypes, which is the default.
+func (engine *SpanEngine) SetAllowedMimeTypes(allowed []mimetype.MimeType) {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	engine.allowedMimeTypes = append([]mimetype.MimeType(nil), allowed...)
+}
+
+// The mimetypes set through SetAllowedMimeTypes(). Empty if all are allowed.
+func (engine *SpanEngine) AllowedMimeTypes() []mimetype.MimeType {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return append([]mimetype.MimeType(nil), engine.allowedMimeTypes...)
+}
+
+// Whether mimeType is allowed by SetAllowedMimeTypes(). The caller must hold
+// registryLock.
+func (engine *SpanEngine) allowsMimeType(mimeType mimetype.MimeType) bool {
+	return len(engine.allowedMimeTypes) == 0 ||
+		containsMimeType(engine.allowedMimeTypes, mimeType)
+}
+
+// Returns a *MimeTypeNotAllowedError if mimeType is not allowed. Unknown content is
+// allowed, as sniffing only attempts allowed mimetypes.
+func (engine *SpanEngine) checkMimeTypeAllowed(mimeType mimetype.MimeType) error {
+	if mimeType == mimetype.UNKNOWN {
+		return nil
+	}
+
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	if engine.allowsMimeType(mimeType) {
+		return nil
+	}
+	return &MimeTypeNotAllowedError{MimeType: mimeType}
+}
+
+// MimeTypeNotAllowedError is returned when content is decoded from or encoded to a
+// mimetype left out of SetAllowedMimeTypes(). Services will usually want to respond to
+// it with a 415.
+type MimeTypeNotAllowedError struct {
+	// The mimetype which was requested.
+	MimeType mimetype.MimeType
+}
+
+func (err *MimeTypeNotAllowedError) Error() string {
+	return "mimetype not allowed: '" + string(err.MimeType) + "'"
+}
+
+// SniffOrder returns the registered mimetypes that will be attempted when sniffing, in
+// order, not counting any struct tag hints of the receiver.
+func (engine *SpanEngine) SniffOrder() []mimetype.MimeType {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	return engine.defaultSniffOrder()
+}
+
+// Returns SniffOrder(). The caller must hold registryLock.
+func (engine *SpanEngine) defaultSniffOrder() []mimetype.MimeType {
+	order := make([]mimetype.MimeType, 0, len(engine.decoders))
+	order = engine.appendSniffable(order, engine.sniffOrderSet, nil)
+	order = engine.appendSniffable(order, engine.decoderOrder, sniffLater)
+	return engine.appendSniffable(order, sniffLast, nil)
+}
+
+// When set to true, top-level scalar values encoded to bson are wrapped in a document
+// as {"value": <scalar>}, and unwrapped again when decoding into a scalar receiver.
+// Off by default, in which case encoding a top-level scalar to bson returns an error.
+func (engine *SpanEngine) SetBsonWrapScalars(wrap bool) {
+	engine.bsonWrapScalars = wrap
+}
+
+// Whether top-level bson scalars are wrapped in a document when encoding.
+func (engine *SpanEngine) BsonWrapScalars() bool {
+	return engine.bsonWrapScalars
+}
+
+// When set to true, top-level lists encoded to bson are written as a single document,
+// {"items": [...]}, rather than as separated documents, and unwrapped again when
+// decoding into a slice. Useful for tools which expect a document at the root of every
+// payload. Off by default.
+func (engine *SpanEngine) SetBsonWrapLists(wrap bool) {
+	engine.bsonWrapLists = wrap
+}
+
+// Whether top-level bson lists are wrapped in a document when encoding.
+func (engine *SpanEngine) BsonWrapLists() bool {
+	return engine.bsonWrapLists
+}
+
+// When set to true, malformed UUIDs decoded by the default JSON and BSON decoders are
+// replaced with uuid.Nil rather than aborting the decode, and a warning is sent to the
+// engine's Logger. Off by default.
+func (engine *SpanEngine) SetLenientUUID(lenient bool) {
+	engine.lenientUUID = lenient
+}
+
+// Whether malformed UUIDs decode as uuid.Nil.
+func (engine *SpanEngine) LenientUUID() bool {
+	return engine.lenientUUID
+}
+
+// Sets the binary subtype UUIDs are written to bson as. Defaults to 0x3, the legacy
+// UUID subtype, for backwards compatibility. Set 0x4, the RFC 4122 UUID subtype, to
+// match what modern MongoDB drivers write. Either subtype is decoded whatever this is
+// set to.
+func (engine *SpanEngine) SetUUIDBsonSubtype(subtype byte) {
+	engine.uuidBsonSubtype = subtype
+}
+
+// The binary subtype UUIDs are written to bson as.
+func (engine *SpanEngine) UUIDBsonSubtype() byte {
+	return engine.uuidBsonSubtype
+}
+
+/*
+Sets the layout time.Time values are written to and read from JSON and BSON in, as a
+layout for time.Format() like time.RFC3339, or TimeLayoutEpochMillis for a count of
+milliseconds since the unix epoch.
+
+By default no layout is set, and times are written as RFC 3339 strings with nanoseconds
+in JSON, and as datetimes in BSON. With a string layout, times are written as strings
+in that layout in both. With TimeLayoutEpochMillis they are written as numbers in JSON,
+and as datetimes in BSON, which are themselves a count of milliseconds.
+
+Decoding accepts a string in the layout, or RFC 3339 if the layout is blank or
+TimeLayoutEpochMillis, as well as a count of milliseconds. BSON datetimes are always
+decoded. Strings which do not match the layout return an error naming the layout.
+*/
+func (engine *SpanEngine) SetTimeLayout(layout string) {
+	engine.timeLayout = layout
+}
+
+// The layout time.Time values are written to JSON and BSON in. Blank if none is set.
+func (engine *SpanEngine) TimeLayout() string {
+	return engine.timeLayout
+}
+
+// Handles a UUID which failed to parse with err, returning uuid.Nil in its place if the
+// engine is lenient, or err otherwise.
+func (engine *SpanEngine) malformedUUID(err error) (uuid.UUID, error) {
+	if !engine.lenientUUID {
+		return uuid.Nil, err
+	}
+
+	engine.logger(LogLevelWarn, "substituting nil uuid for malformed uuid", "error", err)
+	return uuid.Nil, nil
+}
+
+// Registers a function that every string in a receiver is passed through after it is
+// successfully decoded, such as strings.TrimSpace, so input sanitization can be done in
+// one place rather than in each handler. Strings in exported struct fields, slices, and
+// map values are all transformed. Pass nil to remove the transform.
+func (engine *SpanEngine) SetStringTransform(transform func(string) string) {
+	engine.stringTransform = transform
+}
+
+// Registers a function which wraps all content in an envelope before Encode() encodes
+// it, like {"data": ..., "meta": ...}, so every response is enveloped consistently. The
+// encoder is picked from the unwrapped content. The envelope is applied once per call
+// to Encode(), EncodeContext() or the methods built on them, like EncodeMapOrdered()
+// and EncodeBSONWithID(). Stream encoders, like ObjectStreamEncoder and
+// TranscodeStream(), write their content as-is. Pass nil to remove the envelope.
+func (engine *SpanEngine) SetEncodeEnvelope(
+	envelope func(content interface{}) interface{},
+) {
+	engine.encodeEnvelope = envelope
+}
+
+/*
+SetDecodeUnenvelope registers the inverse of SetEncodeEnvelope(): a function which
+returns an envelope for Decode() to decode into, which holds contentReceiver where the
+enveloped content is. For example:
+
+	engine.SetDecodeUnenvelope(func(contentReceiver interface{}) interface{} {
+		return &struct {
+			Data interface{} `json:"data"`
+		}{Data: contentReceiver}
+	})
+
+The envelope is used once per call to Decode(), DecodeContext(), DecodeWithCachedType(),
+DecodeManyInto() or the methods built on them. DecodeStream(), DecodeManyFactory() and
+TranscodeStream() decode lists one element at a time, and do not unwrap envelopes.
+
+The decoder must decode into the receiver held by the envelope rather than replacing
+it. The default JSON decoder does this for interface{} fields holding a pointer, but
+the bson and yaml decoders do not. Pass nil to remove the envelope.
+*/
+func (engine *SpanEngine) SetDecodeUnenvelope(
+	unenvelope func(contentReceiver interface{}) interface{},
+) {
+	engine.decodeUnenvelope = unenvelope
+}
+
+// Adds JSON extensions to handle. The extensions are added to the msgpack handle as
+// well.
+func (engine *SpanEngine) AddJSONExtensions(extensions []*JSONExtensionOpts) error {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	existing := len(engine.jsonExtensions)
+	extensions = append(engine.jsonExtensions[:existing:existing], extensions...)
+
+	handle, err := engine.buildJSONHandle(
+		cloneJSONHandle(engine.jsonHandle), extensions, engine.bsonRegistry,
+	)
+	if err != nil {
+		return err
+	}
+
+	msgpackHandle, err := newMsgpackHandle(extensions)
+	if err != nil {
+		return err
+	}
+
+	engine.jsonExtensions = extensions
+	engine.setJSONHandle(handle)
+	engine.msgpackHandle = msgpackHandle
+	return nil
+}
+
+// Returns base with extensions added, along with the extension for bson raw using
+// registry once it has been built. base should be a fresh copy from cloneJSONHandle().
+// The handle in use is never changed, since other goroutines may be encoding with it.
+func (engine *SpanEngine) buildJSONHandle(
+	base *codec.JsonHandle,
+	extensions []*JSONExtensionOpts,
+	registry *bsoncodec.Registry,
+) (*codec.JsonHandle, error) {
+	handle := base
+
+	for _, extOpts := range extensions {
+		err := handle.SetInterfaceExt(extOpts.ValueType, 1, extOpts.ExtInterface)
+		if err != nil {
+			return nil, xerrors.Errorf(
+				"error adding json extension to content engine: %w", err,
+			)
+		}
+	}
+
+	if registry == nil {
+		return handle, nil
+	}
+
+	err := handle.SetInterfaceExt(
+		reflect.TypeOf(bson.Raw{}),
+		1,
+		&jsonExtBsonRaw{engine: engine, bsonRegistry: registry},
+	)
+	if err != nil {
+		return nil, xerrors.Errorf(
+			"error building bson extension for json handle: %w", err,
+		)
+	}
+	return handle, nil
+}
+
+// Adds BSON codecs to engine for use when encoding/decoding bson data.
+func (engine *SpanEngine) AddBSONCodecs(codecs []*BsonCodecOpts) error {
+	engine.registryLock.Lock()
+	defer engine.registryLock.Unlock()
+
+	// Store these codecs for later in case more are added by the end user and we need
+	// to declare a new engine.
+	engine.bsonCodecs = append(engine.bsonCodecs, codecs...)
+
+	builder := bsoncodec.NewRegistryBuilder()
+	bsoncodec.DefaultValueEncoders{}.RegisterDefaultEncoders(builder)
+	bsoncodec.DefaultValueDecoders{}.RegisterDefaultDecoders(builder)
+	// Handles bson.Raw and bson.RawValue fields.
+	bson.PrimitiveCodecs{}.RegisterPrimitiveCodecs(builder)
+
+	for _, codecOpts := range codecs {
+		builder.RegisterCodec(codecOpts.ValueType, codecOpts.Codec)
+	}
+
+	// Build the bson registry.
+	registry := builder.Build()
+
+	// Now redeclare the json extension for bson raw with this registry so it has access
+	// to any additional codecs
+	handle, err := engine.buildJSONHandle(
+		cloneJSONHandle(engine.jsonHandle), engine.jsonExtensions, registry,
+	)
+	if err != nil {
+		return err
+	}
+
+	engine.bsonRegistry = registry
+	engine.setJSONHandle(handle)
+	return nil
+}
+
+func NewContentEngine(allowSniff bool) (*SpanEngine, error) {
+	// Create the json handle.
+	jsonHandle := &codec.JsonHandle{}
+	// Write times through the engine's time extension rather than the codec's own.
+	jsonHandle.TimeNotBuiltin = true
 
 	// Create the content engine.
 	engine := &SpanEngine{
-		encoders:      make(encoderMapping),
-		decoders:      make(decoderMapping),
-		sniffMimeType: allowSniff,
-		jsonHandle:    jsonHandle,
-		bsonRegistry:  nil,
+		encoders:        make(encoderMapping),
+		decoders:        make(decoderMapping),
+		typeEncoders:    make(map[reflect.Type]Encoder),
+		textFormatters:  make(map[reflect.Type]TextFormatter),
+		textParsers:     make(map[reflect.Type]TextParser),
+		sniffMimeType:   allowSniff,
+		sniffTagHints:   true,
+		uuidBsonSubtype: 0x3,
+		jsonHandle:      jsonHandle,
+		jsonCodecs:      newJSONCodecPool(jsonHandle),
+		bsonRegistry:    nil,
+		logger:          noopLogger,
+		sniffCache:      make(map[string]mimetype.MimeType),
 	}
 
 	// Add the encoding.
 	engine.SetEncoder(mimetype.JSON, &jsonEncoder{})
 	engine.SetEncoder(mimetype.BSON, &bsonEncoder{})
 	engine.SetEncoder(mimetype.TEXT, &textEncoder{})
+	engine.SetEncoder(mimetype.GOB, &gobEncoder{})
+	engine.SetEncoder(mimetype.YAML, &yamlEncoder{})
+	engine.SetEncoder(mimetype.FORM, &formEncoder{})
+	engine.SetEncoder(mimetype.NDJSON, &ndjsonEncoder{})
+	engine.SetEncoder(mimetype.XML, &xmlEncoder{})
+	engine.SetEncoder(mimetype.MSGPACK, &msgpackEncoder{})
 
 	// Add the default decoders.
 	engine.SetDecoder(mimetype.JSON, &jsonEncoder{})
 	engine.SetDecoder(mimetype.BSON, &bsonEncoder{})
 	engine.SetDecoder(mimetype.TEXT, &textEncoder{})
+	engine.SetDecoder(mimetype.GOB, &gobEncoder{})
+	engine.SetDecoder(mimetype.YAML, &yamlEncoder{})
+	engine.SetDecoder(mimetype.FORM, &formEncoder{})
+	engine.SetDecoder(mimetype.NDJSON, &ndjsonEncoder{})
+	engine.SetDecoder(mimetype.XML, &xmlEncoder{})
+	engine.SetDecoder(mimetype.MSGPACK, &msgpackEncoder{})
 
 	// Add the default json extensions to the engine.
-	if err := engine.AddJSONExtensions(defaultJSONExtensions); err != nil {
+	if err := engine.AddJSONExtensions(defaultJSONExtensions(engine)); err != nil {
 		err = xerrors.Errorf("error adding default json extensions: %w", err)
 		return nil, err
 	}
 
 	// Add the default bson codecs to the engine.
-	if err := engine.AddBSONCodecs(defaultBsonCodecs); err != nil {
+	if err := engine.AddBSONCodecs(defaultBsonCodecs(engine)); err != nil {
 		err = xerrors.Errorf("error adding default bson codecs: %w", err)
 		return nil, err
 	}
 
 	return engine, nil
 }
+
+/*
+Clone returns a copy of the engine which can be customized without affecting the
+original, for instance to add a JSON extension or change a setting for a single
+request. Registered encoders, decoders, extensions, codecs and settings are all copied.
+
+The clone gets a fresh JSONHandle() carrying the original's extensions and encode /
+decode options, and a rebuilt BSONRegistry() carrying its codecs. Any other changes
+made directly to the original's handle will not be carried over.
+
+The clone passes itself to encoders and decoders. If it is wrapped by an extended
+engine, set that with SetPassedEngine().
+*/
+func (engine *SpanEngine) Clone() *SpanEngine {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	clone := &SpanEngine{
+		encoders:            make(encoderMapping, len(engine.encoders)),
+		decoders:            make(decoderMapping, len(engine.decoders)),
+		typeEncoders:        make(map[reflect.Type]Encoder, len(engine.typeEncoders)),
+		defaultEncoder:      engine.defaultEncoder,
+		defaultDecoder:      engine.defaultDecoder,
+		textFormatters:      make(map[reflect.Type]TextFormatter),
+		textParsers:         make(map[reflect.Type]TextParser),
+		encoderOrder:        append([]mimetype.MimeType(nil), engine.encoderOrder...),
+		decoderOrder:        append([]mimetype.MimeType(nil), engine.decoderOrder...),
+		sniffOrderSet:       append([]mimetype.MimeType(nil), engine.sniffOrderSet...),
+		allowedMimeTypes:    append([]mimetype.MimeType(nil), engine.allowedMimeTypes...),
+		sniffMimeType:       engine.sniffMimeType,
+		sniffOnUnregistered: engine.sniffOnUnregistered,
+		sniffTagHints:       engine.sniffTagHints,
+		jsonHandle:          cloneJSONHandle(engine.jsonHandle),
+		jsonRejectOverflow:  engine.jsonRejectOverflow,
+		jsonCaseInsensitive: engine.jsonCaseInsensitive,
+		jsonCaptureExtra:    engine.jsonCaptureExtra,
+		jsonDurationNanos:   engine.jsonDurationNanos,
+		jsonOrderedBSONRaw:  engine.jsonOrderedBSONRaw,
+		jsonIndentPrefix:    engine.jsonIndentPrefix,
+		jsonIndent:          engine.jsonIndent,
+		jsonFieldNamer:      engine.jsonFieldNamer,
+		binDataEncoding:     engine.binDataEncoding,
+		timeLayout:          engine.timeLayout,
+		maxListElements:     engine.maxListElements,
+		maxEncodeBytes:      engine.maxEncodeBytes,
+		maxDecodeBytes:      engine.maxDecodeBytes,
+		bsonWrapScalars:     engine.bsonWrapScalars,
+		bsonWrapLists:       engine.bsonWrapLists,
+		lenientUUID:         engine.lenientUUID,
+		uuidBsonSubtype:     engine.uuidBsonSubtype,
+		stringTransform:     engine.stringTransform,
+		encodeEnvelope:      engine.encodeEnvelope,
+		decodeUnenvelope:    engine.decodeUnenvelope,
+		textNil:             engine.textNil,
+		trimTextWhitespace:  engine.trimTextWhitespace,
+		xmlListRoot:         engine.xmlListRoot,
+		logger:              engine.logger,
+		sniffCache:          engine.copySniffCache(),
+	}
+
+	for mimeType, encoder := range engine.encoders {
+		clone.encoders[mimeType] = encoder
+	}
+	for mimeType, decoder := range engine.decoders {
+		clone.decoders[mimeType] = decoder
+	}
+	for contentType, encoder := range engine.typeEncoders {
+		clone.typeEncoders[contentType] = encoder
+	}
+	for contentType, formatter := range engine.textFormatters {
+		clone.textFormatters[contentType] = formatter
+	}
+	for receiverType, parser := range engine.textParsers {
+		clone.textParsers[receiverType] = parser
+	}
+
+	// These were all added to the original without error, so can be added again.
+	if err := clone.AddJSONExtensions(engine.clonedJSONExtensions(clone)); err != nil {
+		panic(xerrors.Errorf("error cloning json extensions: %w", err))
+	}
+	if err := clone.AddBSONCodecs(engine.clonedBsonCodecs(clone)); err != nil {
+		panic(xerrors.Errorf("error cloning bson codecs: %w", err))
+	}
+
+	return clone
+}
+
+// Returns a fresh json handle with the same options as handle, but no extensions.
+func cloneJSONHandle(handle *codec.JsonHandle) *codec.JsonHandle {
+	cloned := &codec.JsonHandle{
+		Indent:          handle.Indent,
+		IntegerAsString: handle.IntegerAsString,
+		HTMLCharsAsIs:   handle.HTMLCharsAsIs,
+		PreferFloat:     handle.PreferFloat,
+		TermWhitespace:  handle.TermWhitespace,
+		MapKeyAsString:  handle.MapKeyAsString,
+		RawBytesExt:     handle.RawBytesExt,
+	}
+	cloned.TypeInfos = handle.TypeInfos
+	cloned.TimeNotBuiltin = handle.TimeNotBuiltin
+	cloned.DecodeOptions = handle.DecodeOptions
+	cloned.EncodeOptions = handle.EncodeOptions
+	return cloned
+}
+
+// Returns the engine's json extensions for clone. The default extensions, which are
+// always added first, are bound to the engine they were made for, so are re-made for
+// clone.
+func (engine *SpanEngine) clonedJSONExtensions(clone *SpanEngine) []*JSONExtensionOpts {
+	extensions := defaultJSONExtensions(clone)
+	return append(extensions, engine.jsonExtensions[len(extensions):]...)
+}
+
+// Returns the engine's bson codecs for clone. The default codecs, which are always
+// added first, are bound to the engine they were made for, so are re-made for clone.
+func (engine *SpanEngine) clonedBsonCodecs(clone *SpanEngine) []*BsonCodecOpts {
+	codecs := defaultBsonCodecs(clone)
+	return append(codecs, engine.bsonCodecs[len(codecs):]...)
+}
+
+// Returns a copy of the sniff cache.
+func (engine *SpanEngine) copySniffCache() map[string]mimetype.MimeType {
+	engine.sniffCacheLock.RLock()
+	defer engine.sniffCacheLock.RUnlock()
+
+	cache := make(map[string]mimetype.MimeType, len(engine.sniffCache))
+	for cacheKey, mimeType := range engine.sniffCache {
+		cache[cacheKey] = mimeType
+	}
+	return cache
+}
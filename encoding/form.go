@@ -0,0 +1,144 @@
+package encoding
+
+import (
+	stdencoding "encoding"
+	"golang.org/x/xerrors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"reflect"
+	"strconv"
+)
+
+// FormTagKey is the struct tag used to map a field to a form key, like
+// `form:"first_name"`. Fields without the tag are matched to keys by field name,
+// ignoring case. Fields tagged `form:"-"` are skipped.
+const FormTagKey = "form"
+
+// Form encoder for SpanEngine. Handles encoding to / decoding from
+// application/x-www-form-urlencoded.
+//
+// Only flat content is supported: map[string]string, or structs whose fields are
+// strings, bools, ints, uints, floats, or implement encoding.TextMarshaler /
+// encoding.TextUnmarshaler. Nested structs, slices and maps return an error. When a key
+// is sent more than once, only its first value is decoded.
+type formEncoder struct{}
+
+func (encoder *formEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	values, err := formValues(content)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(writer, values.Encode())
+	return err
+}
+
+// Collects the form values of a map[string]string or flat struct.
+func formValues(content interface{}) (url.Values, error) {
+	values := url.Values{}
+
+	if mapping, ok := content.(map[string]string); ok {
+		for key, value := range mapping {
+			values.Set(key, value)
+		}
+		return values, nil
+	}
+
+	contentValue := reflect.Indirect(reflect.ValueOf(content))
+	if contentValue.Kind() != reflect.Struct {
+		return nil, xerrors.Errorf(
+			"form content must be a struct or map[string]string, got %T", content,
+		)
+	}
+
+	contentType := contentValue.Type()
+	for i := 0; i < contentType.NumField(); i++ {
+		name, ok := taggedFieldName(contentType.Field(i), FormTagKey)
+		if !ok {
+			continue
+		}
+
+		text, err := formatFormField(contentValue.Field(i))
+		if err != nil {
+			return nil, xerrors.Errorf("form field %v: %w", name, err)
+		}
+		values.Set(name, text)
+	}
+
+	return values, nil
+}
+
+// Formats a single struct field as text.
+func formatFormField(field reflect.Value) (string, error) {
+	if marshaler, ok := field.Interface().(stdencoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		return field.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(field.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(field.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(field.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(field.Float(), 'g', -1, field.Type().Bits()), nil
+	default:
+		return "", xerrors.Errorf("unsupported field type %v", field.Type())
+	}
+}
+
+func (encoder *formEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	values, err := url.ParseQuery(string(content))
+	if err != nil {
+		return err
+	}
+
+	if mapping, ok := contentReceiver.(*map[string]string); ok {
+		*mapping = make(map[string]string, len(values))
+		for key := range values {
+			(*mapping)[key] = values.Get(key)
+		}
+		return nil
+	}
+
+	receiverValue := reflect.ValueOf(contentReceiver)
+	if receiverValue.Kind() != reflect.Ptr ||
+		receiverValue.Elem().Kind() != reflect.Struct {
+		return xerrors.New(
+			"form content receiver must be a struct pointer or *map[string]string",
+		)
+	}
+
+	return decodeFormStruct(values, receiverValue.Elem())
+}
+
+// Decodes values into the matching fields of structValue. Keys with no matching field
+// are ignored.
+func decodeFormStruct(values url.Values, structValue reflect.Value) error {
+	for key, keyValues := range values {
+		index := taggedFieldIndex(key, structValue.Type(), FormTagKey)
+		if index < 0 {
+			continue
+		}
+
+		err := setTextField(structValue.Field(index), keyValues[0])
+		if err != nil {
+			return xerrors.Errorf("form field %v: %w", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package encoding
+
+import (
+	"encoding/gob"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+// RegisterGobType registers the concrete type of value with encoding/gob. Gob requires
+// any concrete type which is sent as an interface value (like a struct stored in an
+// interface{} field) to be registered on both the encoding and decoding end.
+func RegisterGobType(value interface{}) {
+	gob.Register(value)
+}
+
+// Gob encoder for Go-to-Go communication. Handles encoding to / decoding from
+// application/x-gob.
+type gobEncoder struct{}
+
+func (encoder *gobEncoder) FileExtension() string {
+	return ".gob"
+}
+
+func (encoder *gobEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	err := gob.NewEncoder(writer).Encode(content)
+	if err != nil {
+		return xerrors.Errorf("gob encode error: %w", err)
+	}
+	return nil
+}
+
+func (encoder *gobEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	err := gob.NewDecoder(reader).Decode(contentReceiver)
+	if err != nil {
+		return xerrors.Errorf("gob decode error: %w", err)
+	}
+	return nil
+}
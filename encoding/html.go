@@ -0,0 +1,76 @@
+package encoding
+
+import (
+	"golang.org/x/xerrors"
+	"html/template"
+	"io"
+	"reflect"
+)
+
+// HTMLRenderer is implemented by content which knows how to render itself as HTML.
+type HTMLRenderer interface {
+	Render(writer io.Writer) error
+}
+
+/*
+HTMLEncoder encodes content to text/html. It is not registered on engines by default,
+since rendering HTML requires templates from the caller. Register one with:
+
+	htmlEncoder := encoding.NewHTMLEncoder()
+	htmlEncoder.SetTemplate(Name{}, nameTemplate)
+	engine.SetEncoder(mimetype.HTML, htmlEncoder)
+
+Content implementing HTMLRenderer is rendered by its Render() method. Otherwise the
+template registered for the content's type through SetTemplate() is executed with the
+content as its data. HTMLEncoder does not support decoding.
+*/
+type HTMLEncoder struct {
+	// Templates to execute by content type.
+	templates map[reflect.Type]*template.Template
+}
+
+// SetTemplate registers the template to execute for content of the same type as
+// contentExample. Pointers to the type are rendered with the same template. Templates
+// should be registered before the encoder is used, as SetTemplate is not safe to call
+// concurrently with Encode.
+func (encoder *HTMLEncoder) SetTemplate(
+	contentExample interface{}, htmlTemplate *template.Template,
+) {
+	contentType := reflect.TypeOf(contentExample)
+	if contentType != nil && contentType.Kind() == reflect.Ptr {
+		contentType = contentType.Elem()
+	}
+	encoder.templates[contentType] = htmlTemplate
+}
+
+// FileExtension implements FileExtensioner.
+func (encoder *HTMLEncoder) FileExtension() string {
+	return ".html"
+}
+
+func (encoder *HTMLEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	if renderer, ok := content.(HTMLRenderer); ok {
+		return renderer.Render(writer)
+	}
+
+	contentType := reflect.TypeOf(content)
+	if contentType != nil && contentType.Kind() == reflect.Ptr {
+		contentType = contentType.Elem()
+	}
+
+	htmlTemplate, ok := encoder.templates[contentType]
+	if !ok {
+		return xerrors.Errorf("no html template registered for %T", content)
+	}
+
+	return htmlTemplate.Execute(writer, content)
+}
+
+// NewHTMLEncoder returns an HTMLEncoder with no templates registered.
+func NewHTMLEncoder() *HTMLEncoder {
+	return &HTMLEncoder{
+		templates: make(map[reflect.Type]*template.Template),
+	}
+}
@@ -1,15 +1,21 @@
 package encoding
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	uuid "github.com/satori/go.uuid"
 	"github.com/ugorji/go/codec"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/xerrors"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"github.com/illuscio-dev/spantools-go/spantypes"
+	"time"
 )
 
 // JSONExtensionOpts holds options For Json Handle extension to add to the handle on
@@ -19,21 +25,64 @@ type JSONExtensionOpts struct {
 	ExtInterface codec.InterfaceExt
 }
 
-// defaultJSONExtensions holds all the JSONExtensionOpts to add to the JSONHandle on
-// server setup
-var defaultJSONExtensions = []*JSONExtensionOpts{
-	{
-		ValueType:    reflect.TypeOf(primitive.Binary{}),
-		ExtInterface: &jsonExtBsonBinary{},
-	},
+// defaultJSONExtensions returns all the JSONExtensionOpts to add to the JSONHandle on
+// server setup. Extensions are bound to engine so they can consult its settings.
+func defaultJSONExtensions(engine *SpanEngine) []*JSONExtensionOpts {
+	return []*JSONExtensionOpts{
+		{
+			ValueType:    reflect.TypeOf(primitive.Binary{}),
+			ExtInterface: &jsonExtBsonBinary{},
+		},
+		{
+			ValueType:    reflect.TypeOf(uuid.UUID{}),
+			ExtInterface: &jsonExtUUID{engine: engine},
+		},
+		{
+			ValueType:    reflect.TypeOf(time.Duration(0)),
+			ExtInterface: &jsonExtDuration{engine: engine},
+		},
+		{
+			ValueType:    reflect.TypeOf(spantypes.BinData{}),
+			ExtInterface: &jsonExtBinData{engine: engine},
+		},
+		{
+			ValueType:    reflect.TypeOf(time.Time{}),
+			ExtInterface: &jsonExtTime{engine: engine},
+		},
+	}
 }
 
-// Converts BSON binary fields to json. Currently supports Binary blobs and UUIDs.
+// BinDataEncoding is the string encoding spantypes.BinData is written to json in. See
+// SpanEngine.SetBinDataEncoding().
+type BinDataEncoding int
+
+const (
+	// BinDataHex writes BinData as a hex string. This is the default.
+	BinDataHex BinDataEncoding = iota
+	// BinDataBase64 writes BinData as a padded, standard base64 string, which is
+	// smaller than hex for large blobs.
+	BinDataBase64
+)
+
+// Converts BSON binary fields to json. Currently supports Binary blobs and UUIDs, of
+// either the legacy 0x3 or RFC 4122 0x4 subtype.
 type jsonExtBsonBinary struct{}
 
 func (ext *jsonExtBsonBinary) ConvertExt(value interface{}) interface{} {
-	valueBin := value.(*primitive.Binary)
-	if valueBin.Subtype == 0x3 {
+	// Depending on how the field holding the binary data is typed, the codec may pass
+	// us either a value or a pointer.
+	var valueBin *primitive.Binary
+
+	switch typed := value.(type) {
+	case *primitive.Binary:
+		valueBin = typed
+	case primitive.Binary:
+		valueBin = &typed
+	default:
+		panic(xerrors.Errorf("unexpected type for bson binary: %T", value))
+	}
+
+	if valueBin.Subtype == 0x3 || valueBin.Subtype == 0x4 {
 		valueUUID, err := uuid.FromBytes(valueBin.Data)
 		if err != nil {
 			panic(xerrors.Errorf("Error converting bson uuid: %w", err))
@@ -49,6 +98,10 @@ func (ext *jsonExtBsonBinary) ConvertExt(value interface{}) interface{} {
 }
 
 func (ext *jsonExtBsonBinary) UpdateExt(dest interface{}, value interface{}) {
+	if value == nil {
+		zeroExtDest(dest)
+		return
+	}
 	panic(
 		xerrors.New(
 			"decoding to bson binary field not supported -- " +
@@ -57,14 +110,223 @@ func (ext *jsonExtBsonBinary) UpdateExt(dest interface{}, value interface{}) {
 	)
 }
 
-// Converts BSON Raw document to json object.
+// Converts UUIDs to and from their canonical json string.
+type jsonExtUUID struct {
+	engine *SpanEngine
+}
+
+func (ext *jsonExtUUID) ConvertExt(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case *uuid.UUID:
+		return typed.String()
+	case uuid.UUID:
+		return typed.String()
+	default:
+		panic(xerrors.Errorf("unexpected type for uuid: %T", value))
+	}
+}
+
+func (ext *jsonExtUUID) UpdateExt(dest interface{}, value interface{}) {
+	if value == nil {
+		zeroExtDest(dest)
+		return
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		panic(xerrors.Errorf("uuid must be a json string, got %T", value))
+	}
+
+	parsed, err := uuid.FromString(text)
+	if err != nil {
+		parsed, err = ext.engine.malformedUUID(err)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	*dest.(*uuid.UUID) = parsed
+}
+
+// Converts durations to and from strings like "1h30m0s". Durations can be written as
+// nanosecond counts instead through SpanEngine.SetJSONDurationNanos(), and are decoded
+// from either.
+type jsonExtDuration struct {
+	engine *SpanEngine
+}
+
+func (ext *jsonExtDuration) ConvertExt(value interface{}) interface{} {
+	var duration time.Duration
+
+	switch typed := value.(type) {
+	case *time.Duration:
+		duration = *typed
+	case time.Duration:
+		duration = typed
+	default:
+		panic(xerrors.Errorf("unexpected type for duration: %T", value))
+	}
+
+	if ext.engine.jsonDurationNanos {
+		return int64(duration)
+	}
+	return duration.String()
+}
+
+func (ext *jsonExtDuration) UpdateExt(dest interface{}, value interface{}) {
+	var duration time.Duration
+
+	switch typed := value.(type) {
+	case nil:
+		zeroExtDest(dest)
+		return
+	case string:
+		parsed, err := time.ParseDuration(typed)
+		if err != nil {
+			panic(xerrors.Errorf("error parsing duration: %w", err))
+		}
+		duration = parsed
+	case int64:
+		duration = time.Duration(typed)
+	case uint64:
+		duration = time.Duration(typed)
+	case float64:
+		duration = time.Duration(typed)
+	default:
+		panic(xerrors.Errorf("duration must be a json string or number, got %T", value))
+	}
+
+	*dest.(*time.Duration) = duration
+}
+
+// Converts times to and from strings in the engine's SetTimeLayout(), or RFC 3339 with
+// nanoseconds if none is set. Times are written as numbers instead when the layout is
+// TimeLayoutEpochMillis.
+type jsonExtTime struct {
+	engine *SpanEngine
+}
+
+func (ext *jsonExtTime) ConvertExt(value interface{}) interface{} {
+	var valueTime time.Time
+
+	switch typed := value.(type) {
+	case *time.Time:
+		valueTime = *typed
+	case time.Time:
+		valueTime = typed
+	default:
+		panic(xerrors.Errorf("unexpected type for time: %T", value))
+	}
+
+	layout := ext.engine.TimeLayout()
+	if layout == TimeLayoutEpochMillis {
+		return timeToMillis(valueTime)
+	}
+	return valueTime.Format(timeStringLayout(layout))
+}
+
+func (ext *jsonExtTime) UpdateExt(dest interface{}, value interface{}) {
+	var valueTime time.Time
+	layout := ext.engine.TimeLayout()
+
+	switch typed := value.(type) {
+	case nil:
+		zeroExtDest(dest)
+		return
+	case string:
+		parsed, err := parseTimeLayout(layout, typed)
+		if err != nil {
+			panic(err)
+		}
+		valueTime = parsed
+	case int64:
+		valueTime = timeFromMillis(typed)
+	case uint64:
+		valueTime = timeFromMillis(int64(typed))
+	case float64:
+		valueTime = timeFromMillis(int64(typed))
+	default:
+		panic(xerrors.Errorf("time must be a json string or number, got %T", value))
+	}
+
+	*dest.(*time.Time) = valueTime
+}
+
+// Converts BinData to and from a hex or base64 string, depending on the engine's
+// SetBinDataEncoding(). Hex goes through BinData's own text marshalling.
+type jsonExtBinData struct {
+	engine *SpanEngine
+}
+
+func (ext *jsonExtBinData) ConvertExt(value interface{}) interface{} {
+	var data spantypes.BinData
+
+	switch typed := value.(type) {
+	case *spantypes.BinData:
+		data = *typed
+	case spantypes.BinData:
+		data = typed
+	default:
+		panic(xerrors.Errorf("unexpected type for bin data: %T", value))
+	}
+
+	if ext.engine.binDataEncoding == BinDataBase64 {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+
+	text, err := data.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	return string(text)
+}
+
+func (ext *jsonExtBinData) UpdateExt(dest interface{}, value interface{}) {
+	if value == nil {
+		zeroExtDest(dest)
+		return
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		panic(xerrors.Errorf("bin data must be a json string, got %T", value))
+	}
+
+	destData := dest.(*spantypes.BinData)
+	if ext.engine.binDataEncoding != BinDataBase64 {
+		if err := destData.UnmarshalText([]byte(text)); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		panic(xerrors.Errorf("could not decode base64: %w", err))
+	}
+	*destData = decoded
+}
+
+// Converts BSON Raw document to json object. Fields are written in document order
+// if set through SpanEngine.SetJSONOrderedBSONRaw().
 type jsonExtBsonRaw struct {
+	engine       *SpanEngine
 	bsonRegistry *bsoncodec.Registry
 }
 
 func (ext *jsonExtBsonRaw) ConvertExt(value interface{}) interface{} {
 	valueRaw := value.(bson.Raw)
 
+	if ext.engine.jsonOrderedBSONRaw {
+		ordered, err := ext.orderedDocument(valueRaw)
+		if err != nil {
+			panic(xerrors.Errorf(
+				"error while unmarshalling bson for encoding: %w", err,
+			))
+		}
+		return ordered
+	}
+
 	unmarshaled := make(map[string]interface{})
 
 	if len(valueRaw) > 0 {
@@ -81,25 +343,228 @@ func (ext *jsonExtBsonRaw) ConvertExt(value interface{}) interface{} {
 	return unmarshaled
 }
 
+// Converts document to key / value pairs in document order, converting embedded
+// documents in the same way.
+func (ext *jsonExtBsonRaw) orderedDocument(document bson.Raw) (orderedObject, error) {
+	if len(document) == 0 {
+		return orderedObject{}, nil
+	}
+
+	elements, err := document.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make(orderedObject, 0, len(elements)*2)
+	for _, element := range elements {
+		value, err := ext.orderedValue(element.Value())
+		if err != nil {
+			return nil, xerrors.Errorf("error converting '%v': %w", element.Key(), err)
+		}
+		ordered = append(ordered, element.Key(), value)
+	}
+	return ordered, nil
+}
+
+// Converts the elements of array, keeping the field order of any documents in it.
+func (ext *jsonExtBsonRaw) orderedArray(array bson.Raw) ([]interface{}, error) {
+	values, err := array.Values()
+	if err != nil {
+		return nil, err
+	}
+
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		if converted[i], err = ext.orderedValue(value); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// Converts a single bson value, keeping the field order of documents.
+func (ext *jsonExtBsonRaw) orderedValue(rawValue bson.RawValue) (interface{}, error) {
+	switch rawValue.Type {
+	case bsontype.EmbeddedDocument:
+		return ext.orderedDocument(rawValue.Document())
+	case bsontype.Array:
+		return ext.orderedArray(rawValue.Array())
+	}
+
+	var value interface{}
+	err := rawValue.UnmarshalWithRegistry(ext.bsonRegistry, &value)
+	return value, err
+}
+
+// Key / value pairs, alternating, which the json handle writes as an object with its
+// fields in the same order.
+type orderedObject []interface{}
+
+// MapBySlice marks orderedObject to be written as an object rather than an array.
+func (object orderedObject) MapBySlice() {}
+
 func (ext *jsonExtBsonRaw) UpdateExt(dest interface{}, value interface{}) {
+	if value == nil {
+		zeroExtDest(dest)
+		return
+	}
 	panic(xerrors.New("Decoding to BSON raw field not supported"))
 }
 
+// Sets the value dest points to to its zero value. Used by extensions which cannot
+// decode into their type, so a JSON null still decodes rather than panicking.
+func zeroExtDest(dest interface{}) {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() == reflect.Ptr && !destValue.IsNil() {
+		destValue.Elem().Set(reflect.Zero(destValue.Elem().Type()))
+	}
+}
+
 // default JSON encoder for SpanEngine.
 type jsonEncoder struct{}
 
+func (encoder *jsonEncoder) FileExtension() string {
+	return ".json"
+}
+
+// Only content which starts with an object or array, after any leading whitespace, is
+// sniffed as json.
+func (encoder *jsonEncoder) CanSniff(peek []byte) bool {
+	peek = bytes.TrimLeft(peek, " \t\r\n")
+	return len(peek) > 0 && (peek[0] == '{' || peek[0] == '[')
+}
+
 func (encoder *jsonEncoder) Encode(
 	engine ContentEngine, writer io.Writer, content interface{},
 ) error {
 	spanEngine := engine.(*SpanEngine)
-	jsonEncoder := codec.NewEncoder(writer, spanEngine.jsonHandle)
-	return jsonEncoder.Encode(content)
+	codecs := spanEngine.jsonCodecPool()
+
+	namer := spanEngine.JSONFieldNamer()
+	prefix, indent := spanEngine.JSONIndent()
+	if namer == nil && prefix == "" && indent == "" {
+		return codecs.encode(writer, content)
+	}
+
+	// Field names and indentation are applied to the codec's compact output.
+	compact := &bytes.Buffer{}
+	if err := codecs.encode(compact, content); err != nil {
+		return err
+	}
+
+	encoded := compact.Bytes()
+	if namer != nil {
+		encoded = renameJSONFields(encoded, content, namer)
+	}
+	if prefix == "" && indent == "" {
+		_, err := writer.Write(encoded)
+		return err
+	}
+
+	// The codec can only indent with spaces or tabs and no prefix, so indent the compact
+	// output instead.
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, encoded, prefix, indent); err != nil {
+		return err
+	}
+	_, err := indented.WriteTo(writer)
+	return err
 }
 
 func (encoder *jsonEncoder) Decode(
 	engine ContentEngine, reader io.Reader, contentReceiver interface{},
 ) error {
 	spanEngine := engine.(*SpanEngine)
-	jsonDecoder := codec.NewDecoder(reader, spanEngine.jsonHandle)
-	return jsonDecoder.Decode(contentReceiver)
+	codecs := spanEngine.jsonCodecPool()
+
+	if !encoder.buffersContent(spanEngine) {
+		return codecs.decode(reader, contentReceiver)
+	}
+
+	// Checking content before decoding needs to read it twice, so buffer it.
+	content, err := encoder.readContent(spanEngine, reader, contentReceiver)
+	if err != nil {
+		return err
+	}
+
+	if err := codecs.decodeBytes(content, contentReceiver); err != nil {
+		return err
+	}
+
+	if spanEngine.jsonCaptureExtra {
+		capturer := &extraCapturer{handle: codecs.handle}
+		capturer.capture(content, reflect.ValueOf(contentReceiver))
+	}
+	return nil
+}
+
+// Whether the engine is configured to check or rewrite JSON content before it is
+// decoded, or to read it again after, which requires buffering it.
+func (encoder *jsonEncoder) buffersContent(spanEngine *SpanEngine) bool {
+	return spanEngine.jsonRejectOverflow ||
+		spanEngine.maxListElements > 0 ||
+		spanEngine.jsonCaseInsensitive ||
+		spanEngine.jsonCaptureExtra
+}
+
+// Reads the content to decode, checking and rewriting it as the engine is configured
+// to.
+func (encoder *jsonEncoder) readContent(
+	spanEngine *SpanEngine, reader io.Reader, contentReceiver interface{},
+) ([]byte, error) {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := encoder.checkContent(spanEngine, content, contentReceiver); err != nil {
+		return nil, err
+	}
+
+	if spanEngine.jsonCaseInsensitive {
+		content = matchJSONCase(content, contentReceiver)
+	}
+	return content, nil
+}
+
+// Runs the checks the engine is configured for against JSON content before it is
+// decoded.
+func (encoder *jsonEncoder) checkContent(
+	spanEngine *SpanEngine, content []byte, contentReceiver interface{},
+) error {
+	if spanEngine.maxListElements > 0 {
+		if err := checkJSONListLength(spanEngine, content); err != nil {
+			return err
+		}
+	}
+
+	if spanEngine.jsonRejectOverflow {
+		return checkJSONOverflow(
+			content, contentReceiver, spanEngine.jsonCaseInsensitive,
+		)
+	}
+	return nil
+}
+
+// Counts the elements of top-level JSON list content, stopping with an error as soon
+// as the engine's maximum is passed so the elements are never decoded. Content which
+// is not a list, or is malformed, is left for the decoder.
+func checkJSONListLength(spanEngine *SpanEngine, content []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+
+	token, err := decoder.Token()
+	if err != nil || token != json.Delim('[') {
+		return nil
+	}
+
+	for count := 1; decoder.More(); count++ {
+		if err := spanEngine.checkListLength(count); err != nil {
+			return err
+		}
+
+		var element json.RawMessage
+		if err := decoder.Decode(&element); err != nil {
+			return nil
+		}
+	}
+	return nil
 }
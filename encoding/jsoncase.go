@@ -0,0 +1,153 @@
+package encoding
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Rewrites the object keys of JSON content which match the JSON name of a field on
+// contentReceiver only when ignoring case, so the codec, which matches names exactly,
+// decodes them. Keys for nested structs are rewritten as well. Keys with an exact match
+// are left as-is, as is malformed content, which is left for the decoder to reject.
+func matchJSONCase(content []byte, contentReceiver interface{}) []byte {
+	return matchCase(content, reflect.TypeOf(contentReceiver))
+}
+
+// Rewrites the keys of a raw JSON value for the type it will be decoded into.
+func matchCase(raw json.RawMessage, targetType reflect.Type) json.RawMessage {
+	for targetType != nil && targetType.Kind() == reflect.Ptr {
+		targetType = targetType.Elem()
+	}
+	// Types which decode themselves get the content as it was sent.
+	if targetType == nil || implementsAny(targetType, jsonMarshalerTypes) {
+		return raw
+	}
+
+	switch targetType.Kind() {
+	case reflect.Struct:
+		return matchStructCase(raw, targetType)
+	case reflect.Map:
+		return matchMapCase(raw, targetType)
+	case reflect.Slice, reflect.Array:
+		return matchArrayCase(raw, targetType)
+	}
+	return raw
+}
+
+// Rewrites the keys of a JSON object to the JSON names of the fields of structType.
+// Keys are kept in document order. When several keys match a field ignoring case, an
+// exact match takes precedence, then the first key sent. Keys which lose are left as
+// they were sent, so the codec ignores them.
+func matchStructCase(raw json.RawMessage, structType reflect.Type) json.RawMessage {
+	members, ok := readJSONObject(raw)
+	if !ok {
+		return raw
+	}
+
+	fields := collectJSONFields(structType, nil)
+	sent := jsonMemberKeys(members)
+	matched := make(map[string]bool, len(members))
+
+	for index, member := range members {
+		field, ok := lookupFieldCase(member.key, fields)
+		if !ok ||
+			(field.name != member.key && (sent[field.name] || matched[field.name])) {
+			continue
+		}
+
+		matched[field.name] = true
+		members[index] = jsonMember{
+			key:   field.name,
+			value: matchCase(member.value, field.fieldType),
+		}
+	}
+
+	return writeJSONObject(members)
+}
+
+// Returns the set of keys of members.
+func jsonMemberKeys(members []jsonMember) map[string]bool {
+	keys := make(map[string]bool, len(members))
+	for _, member := range members {
+		keys[member.key] = true
+	}
+	return keys
+}
+
+// The JSON name and type of a decodable struct field.
+type jsonField struct {
+	name      string
+	fieldType reflect.Type
+}
+
+// Appends the JSON name and type of every decodable field of structType to fields in
+// declaration order, including the fields of untagged embedded structs.
+func collectJSONFields(structType reflect.Type, fields []jsonField) []jsonField {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		if isPromotedStruct(field) {
+			fields = collectJSONFields(field.Type, fields)
+			continue
+		}
+
+		name, _ := jsonFieldName(field)
+		if field.PkgPath == "" && name != "-" {
+			fields = append(fields, jsonField{name: name, fieldType: field.Type})
+		}
+	}
+	return fields
+}
+
+// Returns the field key decodes into, matching exactly, or ignoring case if there is
+// no exact match. When several fields match ignoring case, the first declared wins.
+func lookupFieldCase(key string, fields []jsonField) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == key {
+			return field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.name, key) {
+			return field, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// Rewrites the keys of the values of a JSON object decoded into a map.
+func matchMapCase(raw json.RawMessage, mapType reflect.Type) json.RawMessage {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return raw
+	}
+
+	for key, value := range object {
+		object[key] = matchCase(value, mapType.Elem())
+	}
+	return marshalMatched(object, raw)
+}
+
+// Rewrites the keys of the elements of a JSON array.
+func matchArrayCase(raw json.RawMessage, arrayType reflect.Type) json.RawMessage {
+	var array []json.RawMessage
+	if err := json.Unmarshal(raw, &array); err != nil || array == nil {
+		return raw
+	}
+
+	for index, value := range array {
+		array[index] = matchCase(value, arrayType.Elem())
+	}
+	return marshalMatched(array, raw)
+}
+
+// Marshals rewritten content, falling back to the original content on failure.
+func marshalMatched(matched interface{}, raw json.RawMessage) json.RawMessage {
+	content, err := json.Marshal(matched)
+	if err != nil {
+		return raw
+	}
+	return content
+}
@@ -0,0 +1,156 @@
+package encoding
+
+import (
+	"encoding/json"
+	"github.com/ugorji/go/codec"
+	"reflect"
+	"strings"
+)
+
+// JSONExtraTagOption is the json tag option which marks the map field of a struct that
+// captures object keys matching no other field, like `json:",extra"`. See
+// SpanEngine.SetJSONCaptureExtra().
+const JSONExtraTagOption = "extra"
+
+// Captures the object keys of decoded JSON content which match no field of the struct
+// they were decoded into, setting them on the struct's extra field if it has one.
+type extraCapturer struct {
+	// Handle to decode captured values with, so they match what the codec would have
+	// decoded.
+	handle *codec.JsonHandle
+}
+
+// Captures the unknown keys of raw for the value it was decoded into. Structs nested in
+// fields, slices and arrays are captured as well.
+func (capturer *extraCapturer) capture(raw json.RawMessage, value reflect.Value) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+
+	// Types which decode themselves have no fields for keys to match.
+	if implementsAny(value.Type(), jsonMarshalerTypes) {
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		capturer.captureStruct(raw, value)
+	case reflect.Slice, reflect.Array:
+		capturer.captureArray(raw, value)
+	}
+}
+
+// Sets the keys of a JSON object which match no field of structValue on its extra
+// field.
+func (capturer *extraCapturer) captureStruct(
+	raw json.RawMessage, structValue reflect.Value,
+) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return
+	}
+
+	fields := make(map[string][]int)
+	collectJSONFieldIndexes(structValue.Type(), nil, fields)
+
+	extra := make(map[string]json.RawMessage)
+	for key, value := range object {
+		if index, ok := fields[key]; ok {
+			capturer.capture(value, structValue.FieldByIndex(index))
+		} else {
+			extra[key] = value
+		}
+	}
+
+	if extraIndex := extraFieldIndex(structValue.Type()); extraIndex >= 0 {
+		capturer.setExtra(structValue.Field(extraIndex), extra)
+	}
+}
+
+// Captures the unknown keys of the elements of a JSON array.
+func (capturer *extraCapturer) captureArray(
+	raw json.RawMessage, arrayValue reflect.Value,
+) {
+	var array []json.RawMessage
+	if err := json.Unmarshal(raw, &array); err != nil {
+		return
+	}
+
+	for index := 0; index < len(array) && index < arrayValue.Len(); index++ {
+		capturer.capture(array[index], arrayValue.Index(index))
+	}
+}
+
+// Decodes extra into field, replacing its value. field is left empty if there are no
+// extra keys.
+func (capturer *extraCapturer) setExtra(
+	field reflect.Value, extra map[string]json.RawMessage,
+) {
+	field.Set(reflect.Zero(field.Type()))
+	if len(extra) == 0 {
+		return
+	}
+
+	content, err := json.Marshal(extra)
+	if err != nil {
+		return
+	}
+
+	captured := reflect.New(field.Type())
+	decoder := codec.NewDecoderBytes(content, capturer.handle)
+	if err := decoder.Decode(captured.Interface()); err == nil {
+		field.Set(captured.Elem())
+	}
+}
+
+// Collects the index of every decodable field of structType by JSON name, including
+// the fields of untagged embedded structs. The extra field is left out, so keys
+// matching its name are captured like any other unknown key.
+func collectJSONFieldIndexes(
+	structType reflect.Type, parent []int, indexes map[string][]int,
+) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(parent[:len(parent):len(parent)], i)
+
+		if isPromotedStruct(field) {
+			collectJSONFieldIndexes(field.Type, index, indexes)
+			continue
+		}
+
+		name, _ := jsonFieldName(field)
+		if field.PkgPath == "" && name != "-" && !hasJSONExtraOption(field) {
+			indexes[name] = index
+		}
+	}
+}
+
+// Returns the index of the exported, string-keyed map field of structType tagged with
+// JSONExtraTagOption, or -1 if there is none.
+func extraFieldIndex(structType reflect.Type) int {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		isStringMap := field.Type.Kind() == reflect.Map &&
+			field.Type.Key().Kind() == reflect.String
+
+		if isStringMap && field.PkgPath == "" && hasJSONExtraOption(field) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Whether the `codec:` or `json:` tag of field carries JSONExtraTagOption.
+func hasJSONExtraOption(field reflect.StructField) bool {
+	for _, tagKey := range jsonNameTags {
+		for _, option := range strings.Split(field.Tag.Get(tagKey), ",")[1:] {
+			if option == JSONExtraTagOption {
+				return true
+			}
+		}
+	}
+	return false
+}
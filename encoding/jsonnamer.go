@@ -0,0 +1,173 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// Rewrites the object keys of encoded JSON content which came from struct fields
+// without a JSON name tag to the name namer returns for the field. Keys of nested
+// structs are rewritten as well, keeping their order. Content which cannot be parsed is
+// returned as-is.
+func renameJSONFields(
+	encoded []byte, content interface{}, namer func(string) string,
+) []byte {
+	return renameFields(encoded, reflect.TypeOf(content), namer)
+}
+
+// Rewrites the keys of a raw JSON value encoded from a value of targetType.
+func renameFields(
+	raw json.RawMessage, targetType reflect.Type, namer func(string) string,
+) json.RawMessage {
+	for targetType != nil && targetType.Kind() == reflect.Ptr {
+		targetType = targetType.Elem()
+	}
+	// Types which encode themselves are written as they chose.
+	if targetType == nil || implementsAny(targetType, jsonMarshalerTypes) {
+		return raw
+	}
+
+	switch targetType.Kind() {
+	case reflect.Struct:
+		return renameStructFields(raw, targetType, namer)
+	case reflect.Map:
+		return renameMapValues(raw, targetType, namer)
+	case reflect.Slice, reflect.Array:
+		return renameArrayElements(raw, targetType, namer)
+	}
+	return raw
+}
+
+// The JSON name of an encoded struct field, and whether it came from a tag.
+type namedField struct {
+	fieldType reflect.Type
+	tagged    bool
+}
+
+// Rewrites the keys of a JSON object encoded from a struct of structType.
+func renameStructFields(
+	raw json.RawMessage, structType reflect.Type, namer func(string) string,
+) json.RawMessage {
+	members, ok := readJSONObject(raw)
+	if !ok {
+		return raw
+	}
+
+	fields := make(map[string]namedField)
+	collectNamedFields(structType, fields)
+
+	for index, member := range members {
+		field, ok := fields[member.key]
+		if !ok {
+			continue
+		}
+		if !field.tagged {
+			members[index].key = namer(member.key)
+		}
+		members[index].value = renameFields(member.value, field.fieldType, namer)
+	}
+	return writeJSONObject(members)
+}
+
+// Collects the JSON name, type and whether it is tagged of every encodable field of
+// structType into fields, including the fields of untagged embedded structs.
+func collectNamedFields(structType reflect.Type, fields map[string]namedField) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		if isPromotedStruct(field) {
+			collectNamedFields(field.Type, fields)
+			continue
+		}
+
+		name, tagged := jsonFieldName(field)
+		if field.PkgPath == "" && name != "-" {
+			fields[name] = namedField{fieldType: field.Type, tagged: tagged}
+		}
+	}
+}
+
+// Rewrites the keys of the values of a JSON object encoded from a map. The map's own
+// keys are left as-is.
+func renameMapValues(
+	raw json.RawMessage, mapType reflect.Type, namer func(string) string,
+) json.RawMessage {
+	members, ok := readJSONObject(raw)
+	if !ok {
+		return raw
+	}
+
+	for index, member := range members {
+		members[index].value = renameFields(member.value, mapType.Elem(), namer)
+	}
+	return writeJSONObject(members)
+}
+
+// Rewrites the keys of the elements of a JSON array.
+func renameArrayElements(
+	raw json.RawMessage, arrayType reflect.Type, namer func(string) string,
+) json.RawMessage {
+	var array []json.RawMessage
+	if err := json.Unmarshal(raw, &array); err != nil || array == nil {
+		return raw
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('[')
+	for index, value := range array {
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(renameFields(value, arrayType.Elem(), namer))
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes()
+}
+
+// A key / value pair of a JSON object.
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// Reads the members of a JSON object in the order they were written, returning false
+// if raw is not an object.
+func readJSONObject(raw json.RawMessage) ([]jsonMember, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+
+	members := make([]jsonMember, 0)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, false
+		}
+
+		member := jsonMember{key: token.(string)}
+		if err := decoder.Decode(&member.value); err != nil {
+			return nil, false
+		}
+		members = append(members, member)
+	}
+	return members, true
+}
+
+// Writes members as a JSON object, in order.
+func writeJSONObject(members []jsonMember) json.RawMessage {
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte('{')
+	for index, member := range members {
+		if index > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(member.key)
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(member.value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
@@ -0,0 +1,121 @@
+package encoding
+
+import (
+	"github.com/ugorji/go/codec"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Pools codec encoders and decoders for a json handle, so they can be reset and re-used
+// rather than allocated on every call. Encoders and decoders stay bound to the handle
+// they were made with, so the engine makes a new pool whenever its handle is replaced.
+//
+// Encoders and decoders are only returned to the pool after a successful call, so one
+// left in a bad state by an error is never re-used.
+type jsonCodecPool struct {
+	// Handle every pooled encoder and decoder was made with.
+	handle *codec.JsonHandle
+	// Pooled *codec.Encoder values.
+	encoders sync.Pool
+	// Pooled *codec.Decoder values.
+	decoders sync.Pool
+}
+
+// Content pooled decoders are reset to. Resetting to nil is a no-op, so would leave the
+// last content read alive.
+var noJSONContent = []byte{}
+
+// Returns a new, empty pool for handle.
+func newJSONCodecPool(handle *codec.JsonHandle) *jsonCodecPool {
+	pool := &jsonCodecPool{handle: handle}
+	pool.encoders.New = func() interface{} {
+		return codec.NewEncoder(ioutil.Discard, handle)
+	}
+	pool.decoders.New = func() interface{} {
+		return codec.NewDecoderBytes(noJSONContent, handle)
+	}
+	return pool
+}
+
+// Returns a pooled encoder reset to write to writer. Return it with putEncoder() once
+// it has encoded without error.
+func (pool *jsonCodecPool) getEncoder(writer io.Writer) *codec.Encoder {
+	encoder := pool.encoders.Get().(*codec.Encoder)
+	encoder.Reset(writer)
+	return encoder
+}
+
+// Returns encoder to the pool. The writer is dropped so it is not kept alive by the
+// pool.
+func (pool *jsonCodecPool) putEncoder(encoder *codec.Encoder) {
+	encoder.Reset(ioutil.Discard)
+	pool.encoders.Put(encoder)
+}
+
+// Returns a pooled decoder reset to read from reader. Return it with putDecoder() once
+// it has decoded without error.
+func (pool *jsonCodecPool) getDecoder(reader io.Reader) *codec.Decoder {
+	decoder := pool.decoders.Get().(*codec.Decoder)
+	decoder.Reset(reader)
+	return decoder
+}
+
+// Returns a pooled decoder reset to read from content. Return it with putDecoder()
+// once it has decoded without error.
+func (pool *jsonCodecPool) getDecoderBytes(content []byte) *codec.Decoder {
+	decoder := pool.decoders.Get().(*codec.Decoder)
+	decoder.ResetBytes(content)
+	return decoder
+}
+
+// Returns decoder to the pool. The content it read from is dropped so it is not kept
+// alive by the pool.
+func (pool *jsonCodecPool) putDecoder(decoder *codec.Decoder) {
+	decoder.ResetBytes(noJSONContent)
+	pool.decoders.Put(decoder)
+}
+
+// Encodes content to writer with a pooled encoder.
+func (pool *jsonCodecPool) encode(writer io.Writer, content interface{}) error {
+	encoder := pool.getEncoder(writer)
+	if err := encoder.Encode(content); err != nil {
+		return err
+	}
+	pool.putEncoder(encoder)
+	return nil
+}
+
+// Decodes the content of reader into contentReceiver with a pooled decoder.
+func (pool *jsonCodecPool) decode(reader io.Reader, contentReceiver interface{}) error {
+	decoder := pool.getDecoder(reader)
+	if err := decoder.Decode(contentReceiver); err != nil {
+		return err
+	}
+	pool.putDecoder(decoder)
+	return nil
+}
+
+// Decodes content into contentReceiver with a pooled decoder.
+func (pool *jsonCodecPool) decodeBytes(
+	content []byte, contentReceiver interface{},
+) error {
+	decoder := pool.getDecoderBytes(content)
+	if err := decoder.Decode(contentReceiver); err != nil {
+		return err
+	}
+	pool.putDecoder(decoder)
+	return nil
+}
+
+// Encodes json compactly through a pool's codec, regardless of SetJSONIndent() and
+// SetJSONFieldNamer(), for output framed by hand, like NDJSON lines.
+type compactJSONEncoder struct {
+	codecs *jsonCodecPool
+}
+
+func (encoder *compactJSONEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	return encoder.codecs.encode(writer, content)
+}
@@ -0,0 +1,15 @@
+package encoding
+
+// Levels passed to a Logger by SpanEngine.
+const (
+	LogLevelDebug = "debug"
+	LogLevelWarn  = "warn"
+)
+
+// Logger is a hook for routing the engine's internal, non-fatal warnings and debug
+// metrics to a host application's own logger. keyValues are alternating key / value
+// pairs of structured data related to the message.
+type Logger func(level string, msg string, keyValues ...interface{})
+
+// Default logger, which discards all messages.
+func noopLogger(level string, msg string, keyValues ...interface{}) {}
@@ -0,0 +1,91 @@
+package encoding
+
+import (
+	"github.com/ugorji/go/codec"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+)
+
+// Wraps a json extension so it can be registered on the msgpack handle, which only
+// takes extensions written as bytes. The value the json extension converts to, like
+// the string of a UUID, is itself written as msgpack.
+type msgpackExt struct {
+	jsonExt codec.InterfaceExt
+	handle  *codec.MsgpackHandle
+}
+
+func (ext *msgpackExt) WriteExt(value interface{}) []byte {
+	var content []byte
+
+	converted := ext.jsonExt.ConvertExt(value)
+	if err := codec.NewEncoderBytes(&content, ext.handle).Encode(converted); err != nil {
+		panic(xerrors.Errorf("error writing msgpack extension: %w", err))
+	}
+	return content
+}
+
+func (ext *msgpackExt) ReadExt(dest interface{}, content []byte) {
+	var value interface{}
+
+	if err := codec.NewDecoderBytes(content, ext.handle).Decode(&value); err != nil {
+		panic(xerrors.Errorf("error reading msgpack extension: %w", err))
+	}
+	ext.jsonExt.UpdateExt(dest, value)
+}
+
+// Returns a new msgpack handle with extensions registered on it. Each extension is
+// tagged by its position in extensions, so both sides of a transfer must register the
+// same extensions in the same order, as engines with only the defaults do.
+func newMsgpackHandle(extensions []*JSONExtensionOpts) (*codec.MsgpackHandle, error) {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	// Decode strings and objects in untyped values the same way json does.
+	handle.RawToString = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	for i, extOpts := range extensions {
+		ext := &msgpackExt{jsonExt: extOpts.ExtInterface, handle: handle}
+		if err := handle.SetBytesExt(extOpts.ValueType, uint64(i+1), ext); err != nil {
+			return nil, xerrors.Errorf(
+				"error adding msgpack extension to content engine: %w", err,
+			)
+		}
+	}
+	return handle, nil
+}
+
+// MessagePack encoder for SpanEngine. Handles encoding to / decoding from
+// application/msgpack through the codec library's msgpack handle, which carries the
+// engine's json extensions.
+type msgpackEncoder struct{}
+
+func (encoder *msgpackEncoder) FileExtension() string {
+	return ".msgpack"
+}
+
+// Only content which starts with a map or array is sniffed as msgpack. Nearly any other
+// leading byte is a valid msgpack scalar, which would claim content meant for other
+// decoders.
+func (encoder *msgpackEncoder) CanSniff(peek []byte) bool {
+	if len(peek) == 0 {
+		return false
+	}
+
+	first := peek[0]
+	// fixmap and fixarray, then array 16 / 32 and map 16 / 32.
+	return (first >= 0x80 && first <= 0x9f) || (first >= 0xdc && first <= 0xdf)
+}
+
+func (encoder *msgpackEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+	return codec.NewEncoder(writer, spanEngine.MsgpackHandle()).Encode(content)
+}
+
+func (encoder *msgpackEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+	return codec.NewDecoder(reader, spanEngine.MsgpackHandle()).Decode(contentReceiver)
+}
@@ -0,0 +1,155 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/ugorji/go/codec"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+)
+
+// NDJSONSepBytes is the separator written after every document of an ndjson payload.
+var NDJSONSepBytes = []byte("\n")
+
+// Newline-delimited JSON encoder for SpanEngine. Handles encoding to / decoding from
+// application/x-ndjson.
+//
+// Like bson, top-level lists are written as one document per element, each terminated
+// by a newline, so consumers can process elements as they arrive. Empty lines are
+// skipped when decoding, and receivers which are not slices are decoded from the first
+// document. Documents are written with the engine's JSONHandle(), which should not be
+// set to indent output.
+type ndjsonEncoder struct{}
+
+func (encoder *ndjsonEncoder) FileExtension() string {
+	return ".ndjson"
+}
+
+// Whether value is a top-level list to be handled as one document per element. Types
+// which marshal themselves, like uuid.UUID, are handled as a single document.
+func (encoder *ndjsonEncoder) isSequence(value interface{}) bool {
+	valueType := reflect.TypeOf(value)
+	if valueType == nil || implementsAny(valueType, jsonMarshalerTypes) {
+		return false
+	}
+
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+// Encodes a single document, followed by the separator.
+func (encoder *ndjsonEncoder) encodeSingle(
+	documents *codec.Encoder, writer io.Writer, content interface{},
+) error {
+	if err := documents.Encode(content); err != nil {
+		return err
+	}
+
+	if _, err := writer.Write(NDJSONSepBytes); err != nil {
+		return xerrors.Errorf("error writing document separator: %w", err)
+	}
+	return nil
+}
+
+func (encoder *ndjsonEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+	codecs := spanEngine.jsonCodecPool()
+	documents := codecs.getEncoder(writer)
+
+	if err := encoder.encodeAll(documents, writer, content); err != nil {
+		return err
+	}
+	codecs.putEncoder(documents)
+	return nil
+}
+
+// Encodes content as a single document, or one document per element if it is a
+// top-level list.
+func (encoder *ndjsonEncoder) encodeAll(
+	documents *codec.Encoder, writer io.Writer, content interface{},
+) error {
+	if !encoder.isSequence(content) {
+		return encoder.encodeSingle(documents, writer, content)
+	}
+
+	contentValue := reflect.Indirect(reflect.ValueOf(content))
+	for i := 0; i < contentValue.Len(); i++ {
+		err := encoder.encodeSingle(documents, writer, contentValue.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Only content which starts with an object or array is sniffed as ndjson.
+func (encoder *ndjsonEncoder) CanSniff(peek []byte) bool {
+	return (&jsonEncoder{}).CanSniff(peek)
+}
+
+// Reads the next non-empty line, returning io.EOF once the content is exhausted.
+func (encoder *ndjsonEncoder) nextLine(reader *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+
+		if len(line) > 0 {
+			return line, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Decodes one document per line, appending each to the slice contentReceiver points
+// to.
+func (encoder *ndjsonEncoder) decodeMany(
+	spanEngine *SpanEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	sliceValue := reflect.ValueOf(contentReceiver).Elem()
+	elementType := sliceValue.Type().Elem()
+	lines := bufio.NewReader(reader)
+	codecs := spanEngine.jsonCodecPool()
+
+	for count := 1; ; count++ {
+		line, err := encoder.nextLine(lines)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := spanEngine.checkListLength(count); err != nil {
+			return err
+		}
+
+		element := reflect.New(elementType)
+		if err := codecs.decodeBytes(line, element.Interface()); err != nil {
+			return xerrors.Errorf("error decoding ndjson document %v: %w", count, err)
+		}
+		sliceValue.Set(reflect.Append(sliceValue, element.Elem()))
+	}
+}
+
+func (encoder *ndjsonEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+
+	receiverValue := reflect.ValueOf(contentReceiver)
+	isSlice := receiverValue.Kind() == reflect.Ptr &&
+		receiverValue.Elem().Kind() == reflect.Slice
+
+	if isSlice && encoder.isSequence(contentReceiver) {
+		return encoder.decodeMany(spanEngine, reader, contentReceiver)
+	}
+
+	line, err := encoder.nextLine(bufio.NewReader(reader))
+	if err != nil {
+		return err
+	}
+	return spanEngine.jsonCodecPool().decodeBytes(line, contentReceiver)
+}
@@ -0,0 +1,248 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+/*
+EncodeOmitNull encodes content like Encode(), but leaves out every object field whose
+value is null, regardless of struct tags. This lets the same type include nulls in one
+response and omit them in another, which an omitempty tag cannot do.
+
+Only null fields are removed: zero values like 0, "" and false are meaningful and kept,
+as are null elements of lists, since removing them would shift the other elements.
+
+JSON and BSON are supported. Content is encoded as normal and then rewritten, so field
+order and any registered extensions or codecs are preserved.
+*/
+func (engine *SpanEngine) EncodeOmitNull(
+	mimeType mimetype.MimeType,
+	content interface{},
+	writer io.Writer,
+) (mimetype.MimeType, error) {
+	mimeType = engine.PickContentMimeType(mimeType, content, true)
+
+	var strip func([]byte) ([]byte, error)
+	switch mimeType {
+	case mimetype.JSON:
+		strip = stripJSONNulls
+	case mimetype.BSON:
+		strip = stripBSONListNulls
+	default:
+		return "", xerrors.Errorf("null omission not supported for %v", mimeType)
+	}
+
+	buffer := &bytes.Buffer{}
+	if _, err := engine.Encode(mimeType, content, buffer); err != nil {
+		return "", err
+	}
+
+	stripped, err := strip(buffer.Bytes())
+	if err != nil {
+		return "", xerrors.Errorf("encode err: error omitting nulls: %w", err)
+	}
+
+	if _, err := writer.Write(stripped); err != nil {
+		return "", xerrors.Errorf("encode err: %w", err)
+	}
+	return mimeType, nil
+}
+
+// Rewrites JSON content without its null object fields.
+func stripJSONNulls(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	output := &bytes.Buffer{}
+	err = copyJSONValue(decoder, output, token)
+	return output.Bytes(), err
+}
+
+// Writes the JSON value starting with token to output, reading any nested values from
+// decoder.
+func copyJSONValue(
+	decoder *json.Decoder, output *bytes.Buffer, token json.Token,
+) error {
+	switch token {
+	case json.Delim('{'):
+		return copyJSONObject(decoder, output)
+	case json.Delim('['):
+		return copyJSONArray(decoder, output)
+	}
+
+	encoded, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	output.Write(encoded)
+	return nil
+}
+
+// Writes the rest of a JSON object to output, skipping fields with null values.
+func copyJSONObject(decoder *json.Decoder, output *bytes.Buffer) error {
+	output.WriteByte('{')
+
+	written := 0
+	for decoder.More() {
+		key, value, err := readJSONField(decoder)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			continue
+		}
+
+		if err := copyJSONField(decoder, output, key, value, written > 0); err != nil {
+			return err
+		}
+		written++
+	}
+
+	// Consume the closing delimiter.
+	_, err := decoder.Token()
+	output.WriteByte('}')
+	return err
+}
+
+// Reads the key and first token of the value of the next field of a JSON object.
+func readJSONField(
+	decoder *json.Decoder,
+) (key json.Token, value json.Token, err error) {
+	key, err = decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err = decoder.Token()
+	return key, value, err
+}
+
+// Writes a field of a JSON object to output, preceded by a comma if it is not the
+// first field.
+func copyJSONField(
+	decoder *json.Decoder,
+	output *bytes.Buffer,
+	key json.Token,
+	value json.Token,
+	comma bool,
+) error {
+	if comma {
+		output.WriteByte(',')
+	}
+
+	if err := copyJSONValue(decoder, output, key); err != nil {
+		return err
+	}
+	output.WriteByte(':')
+	return copyJSONValue(decoder, output, value)
+}
+
+// Writes the rest of a JSON array to output. Null elements are kept.
+func copyJSONArray(decoder *json.Decoder, output *bytes.Buffer) error {
+	output.WriteByte('[')
+
+	for index := 0; decoder.More(); index++ {
+		value, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if index > 0 {
+			output.WriteByte(',')
+		}
+		if err := copyJSONValue(decoder, output, value); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing delimiter.
+	_, err := decoder.Token()
+	output.WriteByte(']')
+	return err
+}
+
+// Rewrites BSON content, which may be a list of documents separated by
+// BsonListSepBytes, without the null fields of each document.
+func stripBSONListNulls(content []byte) ([]byte, error) {
+	output := make([]byte, 0, len(content))
+
+	for len(content) > 0 {
+		length, _, ok := bsoncore.ReadLength(content)
+		if !ok || int(length) > len(content) {
+			return nil, xerrors.New("malformed bson document")
+		}
+
+		stripped, err := stripBSONNulls(content[:length], false)
+		if err != nil {
+			return nil, err
+		}
+		output = append(output, stripped...)
+
+		// Carry over the separator between documents.
+		content = content[length:]
+		if bytes.HasPrefix(content, BsonListSepBytes) {
+			output = append(output, BsonListSepBytes...)
+			content = content[len(BsonListSepBytes):]
+		}
+	}
+
+	return output, nil
+}
+
+// Rewrites a BSON document without its null fields. Arrays are documents in BSON, so
+// isArray is set when rewriting one to keep its null elements.
+func stripBSONNulls(document bsoncore.Document, isArray bool) ([]byte, error) {
+	elements, err := document.Elements()
+	if err != nil {
+		return nil, err
+	}
+
+	index, output := bsoncore.AppendDocumentStart(nil)
+
+	for _, element := range elements {
+		value := element.Value()
+
+		switch value.Type {
+		case bsontype.Null:
+			if isArray {
+				output = append(output, element...)
+			}
+		case bsontype.EmbeddedDocument, bsontype.Array:
+			output, err = appendStrippedBSON(output, element.Key(), value)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			output = append(output, element...)
+		}
+	}
+
+	return bsoncore.AppendDocumentEnd(output, index)
+}
+
+// Appends an embedded document or array to output with its null fields removed.
+func appendStrippedBSON(
+	output []byte, key string, value bsoncore.Value,
+) ([]byte, error) {
+	isArray := value.Type == bsontype.Array
+
+	stripped, err := stripBSONNulls(value.Data, isArray)
+	if err != nil {
+		return nil, err
+	}
+
+	if isArray {
+		return bsoncore.AppendArrayElement(output, key, stripped), nil
+	}
+	return bsoncore.AppendDocumentElement(output, key, stripped), nil
+}
@@ -0,0 +1,91 @@
+package encoding
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/xerrors"
+	"io"
+	"sort"
+)
+
+/*
+EncodeMapOrdered encodes content with its keys written in the order given by order, for
+APIs which expect a fixed field order. Keys of content which are not in order are
+written after the ordered keys, sorted. Keys in order which are not in content are
+skipped.
+
+Only JSON and BSON support ordered encoding. Values are encoded with the engine's
+registered JSON extensions and BSON codecs.
+*/
+func (engine *SpanEngine) EncodeMapOrdered(
+	mimeType mimetype.MimeType,
+	content map[string]interface{},
+	order []string,
+	writer io.Writer,
+) error {
+	keys := orderedKeys(content, order)
+
+	switch mimeType {
+	case mimetype.JSON:
+		_, err := engine.Encode(mimetype.JSON, orderedJSONObject(content, keys), writer)
+		return err
+	case mimetype.BSON:
+		_, err := engine.Encode(mimetype.BSON, orderedBsonDocument(content, keys), writer)
+		return err
+	}
+
+	return xerrors.Errorf("ordered map encoding not supported for %v", mimeType)
+}
+
+// EncodeBSONOrdered encodes content as a single BSON document with its fields in the
+// order given by order, for collections and validators which care about field order.
+// bson.M content can be passed directly. Ordering follows EncodeMapOrdered(): fields
+// not in order are written after the ordered fields, sorted.
+func (engine *SpanEngine) EncodeBSONOrdered(
+	content map[string]interface{}, order []string, writer io.Writer,
+) error {
+	return engine.EncodeMapOrdered(mimetype.BSON, content, order, writer)
+}
+
+// Returns content as a bson.D with its fields in the order of keys.
+func orderedBsonDocument(content map[string]interface{}, keys []string) bson.D {
+	document := make(bson.D, len(keys))
+	for i, key := range keys {
+		document[i] = bson.E{Key: key, Value: content[key]}
+	}
+	return document
+}
+
+// Returns content as key / value pairs in the order of keys, which the json handle
+// writes as an object. The object is encoded through Encode() as a whole, so the
+// engine's envelope, size limit and allowed mimetypes apply to it once.
+func orderedJSONObject(content map[string]interface{}, keys []string) orderedObject {
+	object := make(orderedObject, 0, len(keys)*2)
+	for _, key := range keys {
+		object = append(object, key, content[key])
+	}
+	return object
+}
+
+// Returns the keys of content in order, followed by any keys not in order, sorted.
+func orderedKeys(content map[string]interface{}, order []string) []string {
+	keys := make([]string, 0, len(content))
+	seen := make(map[string]bool, len(content))
+
+	for _, key := range order {
+		if _, ok := content[key]; ok && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+
+	remaining := make([]string, 0, len(content)-len(keys))
+	for key := range content {
+		if !seen[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	sort.Strings(remaining)
+
+	return append(keys, remaining...)
+}
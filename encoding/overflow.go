@@ -0,0 +1,214 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"golang.org/x/xerrors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Struct tag keys checked, in order, for the JSON name of a field. Matches the default
+// behavior of codec.JsonHandle.
+var jsonNameTags = []string{"codec", "json"}
+
+// Checks that every number in JSON content fits the integer field it will be decoded
+// into on contentReceiver, returning an error naming the first field that would
+// overflow. Malformed content is not reported, and is left for the decoder to reject.
+// Object keys are matched to fields ignoring case only if ignoreCase is set, as the
+// decoder does.
+func checkJSONOverflow(
+	content []byte, contentReceiver interface{}, ignoreCase bool,
+) error {
+	var generic interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&generic); err != nil {
+		return nil
+	}
+
+	return checkOverflow(generic, reflect.TypeOf(contentReceiver), "", ignoreCase)
+}
+
+// Checks a generically decoded JSON value against the type it will be decoded into.
+// path is the dotted field path of the value, for error messages.
+func checkOverflow(
+	value interface{}, targetType reflect.Type, path string, ignoreCase bool,
+) error {
+	for targetType != nil && targetType.Kind() == reflect.Ptr {
+		targetType = targetType.Elem()
+	}
+	if targetType == nil {
+		return nil
+	}
+
+	switch typed := value.(type) {
+	case json.Number:
+		return checkNumberOverflow(typed, targetType, path)
+	case map[string]interface{}:
+		return checkObjectOverflow(typed, targetType, path, ignoreCase)
+	case []interface{}:
+		return checkArrayOverflow(typed, targetType, path, ignoreCase)
+	}
+	return nil
+}
+
+// Returns an error if number does not fit targetType, when targetType is an integer.
+func checkNumberOverflow(
+	number json.Number, targetType reflect.Type, path string,
+) error {
+	if !numberOverflows(string(number), targetType) {
+		return nil
+	}
+
+	if path == "" {
+		return xerrors.Errorf("value %v overflows %v", number, targetType)
+	}
+	return xerrors.Errorf("value %v overflows %v field %v", number, targetType, path)
+}
+
+// Whether number is a whole number outside the range of the integer targetType.
+func numberOverflows(number string, targetType reflect.Type) bool {
+	var err error
+
+	switch targetType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err = strconv.ParseInt(number, 10, targetType.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// Negative whole numbers can never fit an unsigned field.
+		if strings.HasPrefix(number, "-") {
+			_, err = strconv.ParseInt(number, 10, 64)
+			return isRangeError(err) || (err == nil && number != "-0")
+		}
+		_, err = strconv.ParseUint(number, 10, targetType.Bits())
+	}
+
+	return isRangeError(err)
+}
+
+func isRangeError(err error) bool {
+	numErr, ok := err.(*strconv.NumError)
+	return ok && numErr.Err == strconv.ErrRange
+}
+
+// Checks the values of a JSON object against the struct or map it will be decoded
+// into.
+func checkObjectOverflow(
+	object map[string]interface{}, targetType reflect.Type, path string, ignoreCase bool,
+) error {
+	switch targetType.Kind() {
+	case reflect.Struct:
+		return checkStructOverflow(object, targetType, path, ignoreCase)
+	case reflect.Map:
+		for key, value := range object {
+			keyPath := joinFieldPath(path, key)
+			err := checkOverflow(value, targetType.Elem(), keyPath, ignoreCase)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Checks the values of a JSON object against the fields of the struct it will be
+// decoded into.
+func checkStructOverflow(
+	object map[string]interface{}, structType reflect.Type, path string, ignoreCase bool,
+) error {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		// Untagged embedded structs have their fields promoted to the parent object.
+		if isPromotedStruct(field) {
+			err := checkStructOverflow(object, field.Type, path, ignoreCase)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookupJSONField(object, field, ignoreCase)
+		if !ok {
+			continue
+		}
+
+		fieldPath := joinFieldPath(path, field.Name)
+		err := checkOverflow(value, field.Type, fieldPath, ignoreCase)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Whether field is an embedded struct whose fields are promoted to the parent object.
+func isPromotedStruct(field reflect.StructField) bool {
+	_, hasName := jsonFieldName(field)
+	return field.Anonymous && !hasName && field.Type.Kind() == reflect.Struct
+}
+
+// Returns the value for field from object, matching the field's JSON name exactly, or
+// case-insensitively if ignoreCase is set and there is no exact match.
+func lookupJSONField(
+	object map[string]interface{}, field reflect.StructField, ignoreCase bool,
+) (interface{}, bool) {
+	// Skip unexported fields.
+	if field.PkgPath != "" {
+		return nil, false
+	}
+
+	name, _ := jsonFieldName(field)
+	if name == "-" {
+		return nil, false
+	}
+
+	if value, ok := object[name]; ok || !ignoreCase {
+		return value, ok
+	}
+	for key, value := range object {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Returns the JSON name of a field, and whether the name came from a tag.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	for _, tagKey := range jsonNameTags {
+		name := strings.Split(field.Tag.Get(tagKey), ",")[0]
+		if name != "" {
+			return name, true
+		}
+	}
+	return field.Name, false
+}
+
+// Checks the elements of a JSON array against the slice or array they will be decoded
+// into.
+func checkArrayOverflow(
+	array []interface{}, targetType reflect.Type, path string, ignoreCase bool,
+) error {
+	if targetType.Kind() != reflect.Slice && targetType.Kind() != reflect.Array {
+		return nil
+	}
+
+	for index, value := range array {
+		elementPath := path + "[" + strconv.Itoa(index) + "]"
+		err := checkOverflow(value, targetType.Elem(), elementPath, ignoreCase)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func joinFieldPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
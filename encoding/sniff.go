@@ -0,0 +1,229 @@
+package encoding
+
+import (
+	stdencoding "encoding"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/ugorji/go/codec"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/xerrors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SniffError is returned by Decode when content of an unknown mimetype could not be
+// decoded by any registered decoder. It holds the error from each decoder attempted.
+type SniffError struct {
+	attempts map[mimetype.MimeType]error
+}
+
+// Error summarizes the failure of every attempted decoder, sorted by mimetype.
+func (sniffErr *SniffError) Error() string {
+	attempted := make([]string, 0, len(sniffErr.attempts))
+	for mimeType := range sniffErr.attempts {
+		attempted = append(attempted, string(mimeType))
+	}
+	sort.Strings(attempted)
+
+	for i, mimeType := range attempted {
+		attempted[i] = mimeType + ": " +
+			sniffErr.attempts[mimetype.MimeType(mimeType)].Error()
+	}
+
+	return "could not sniff content: " + strings.Join(attempted, "; ")
+}
+
+// Attempts returns the error each attempted decoder failed with, keyed by mimetype.
+func (sniffErr *SniffError) Attempts() map[mimetype.MimeType]error {
+	attempts := make(map[mimetype.MimeType]error, len(sniffErr.attempts))
+	for mimeType, err := range sniffErr.attempts {
+		attempts[mimeType] = err
+	}
+	return attempts
+}
+
+// SniffPeekSize is the maximum number of leading content bytes passed to
+// SniffValidator.CanSniff().
+const SniffPeekSize = 512
+
+// Recorded as the attempt error for decoders skipped by their SniffValidator.
+var errSniffRejected = xerrors.New("content rejected by sniff validator")
+
+// Struct tag keys which hint at the mimetype a struct is expected to be decoded from.
+var sniffTagHints = []struct {
+	tag      string
+	mimeType mimetype.MimeType
+}{
+	{tag: "json", mimeType: mimetype.JSON},
+	{tag: "bson", mimeType: mimetype.BSON},
+	{tag: "yaml", mimeType: mimetype.YAML},
+	{tag: "xml", mimeType: mimetype.XML},
+}
+
+// Mimetypes attempted after all others when sniffing, unless hinted at by tags or set
+// through SetSniffOrder(). YAML is a superset of JSON and reads most plain text as a
+// string, and text decodes anything into a string, so they would otherwise claim
+// content meant for other decoders.
+var sniffLast = []mimetype.MimeType{mimetype.YAML, mimetype.TEXT}
+
+// Mimetypes never attempted when sniffing unless set through SetSniffOrder(). Form
+// decoding accepts nearly any content and ignores unknown keys, so it would report
+// success for content of any other type.
+var sniffNever = []mimetype.MimeType{mimetype.FORM}
+
+// Returns the order registered decoders should be attempted in when sniffing content
+// into contentReceiver. Mimetypes hinted at by the receiver's struct tags come first if
+// the engine is set to use them, followed by SniffOrder(). The decoders for the order
+// are returned with it, so decoders changed while sniffing do not affect the attempt.
+func (engine *SpanEngine) receiverSniffOrder(
+	contentReceiver interface{},
+) ([]mimetype.MimeType, decoderMapping) {
+	engine.registryLock.RLock()
+	defer engine.registryLock.RUnlock()
+
+	order := make([]mimetype.MimeType, 0, len(engine.decoders))
+	if engine.sniffTagHints {
+		order = append(order, engine.registeredTagHints(contentReceiver)...)
+	}
+	order = engine.appendSniffable(order, engine.defaultSniffOrder(), nil)
+
+	decoders := make(decoderMapping, len(order))
+	for _, mimeType := range order {
+		decoders[mimeType] = engine.decoders[mimeType]
+	}
+	return order, decoders
+}
+
+// Appends each mimetype of candidates which has a registered decoder, is allowed, and
+// is not already in order. Candidates for which skip returns true are left out.
+func (engine *SpanEngine) appendSniffable(
+	order []mimetype.MimeType,
+	candidates []mimetype.MimeType,
+	skip func(mimetype.MimeType) bool,
+) []mimetype.MimeType {
+	for _, mimeType := range candidates {
+		_, registered := engine.decoders[mimeType]
+		if !registered ||
+			!engine.allowsMimeType(mimeType) ||
+			containsMimeType(order, mimeType) {
+			continue
+		}
+		if skip == nil || !skip(mimeType) {
+			order = append(order, mimeType)
+		}
+	}
+	return order
+}
+
+// Whether mimeType is left out of the main sniff order, either to be attempted last or
+// not at all.
+func sniffLater(mimeType mimetype.MimeType) bool {
+	return containsMimeType(sniffLast, mimeType) || containsMimeType(sniffNever, mimeType)
+}
+
+// Returns the mimetypes hinted at by the tags of contentReceiver which have a
+// registered decoder and are allowed.
+func (engine *SpanEngine) registeredTagHints(
+	contentReceiver interface{},
+) []mimetype.MimeType {
+	registered := make([]mimetype.MimeType, 0)
+	for _, mimeType := range receiverTagHints(contentReceiver) {
+		_, ok := engine.decoders[mimeType]
+		if ok && engine.allowsMimeType(mimeType) {
+			registered = append(registered, mimeType)
+		}
+	}
+	return registered
+}
+
+// Returns the mimetypes hinted at by the struct tags of contentReceiver, ordered by how
+// many fields carry each tag. Returns nothing if the receiver is not a struct.
+func receiverTagHints(contentReceiver interface{}) []mimetype.MimeType {
+	receiverType := reflect.TypeOf(contentReceiver)
+	for receiverType != nil && receiverType.Kind() == reflect.Ptr {
+		receiverType = receiverType.Elem()
+	}
+	if receiverType == nil || receiverType.Kind() != reflect.Struct {
+		return nil
+	}
+
+	counts := countTagHints(receiverType)
+
+	hinted := make([]mimetype.MimeType, 0, len(counts))
+	for _, hint := range sniffTagHints {
+		if counts[hint.mimeType] > 0 {
+			hinted = append(hinted, hint.mimeType)
+		}
+	}
+
+	sort.SliceStable(hinted, func(i, j int) bool {
+		return counts[hinted[i]] > counts[hinted[j]]
+	})
+	return hinted
+}
+
+// Counts the fields of structType tagged for each hinted mimetype.
+func countTagHints(structType reflect.Type) map[mimetype.MimeType]int {
+	counts := make(map[mimetype.MimeType]int)
+	for i := 0; i < structType.NumField(); i++ {
+		tags := structType.Field(i).Tag
+		for _, hint := range sniffTagHints {
+			if _, ok := tags.Lookup(hint.tag); ok {
+				counts[hint.mimeType]++
+			}
+		}
+	}
+	return counts
+}
+
+func containsMimeType(mimeTypes []mimetype.MimeType, mimeType mimetype.MimeType) bool {
+	for _, thisType := range mimeTypes {
+		if thisType == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Interfaces for types which marshal themselves to / from json or text.
+var jsonMarshalerTypes = []reflect.Type{
+	reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*json.Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*stdencoding.TextMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*stdencoding.TextUnmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*codec.Selfer)(nil)).Elem(),
+}
+
+// Interfaces for types which marshal themselves to / from a bson document.
+var bsonMarshalerTypes = []reflect.Type{
+	reflect.TypeOf((*bson.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*bson.Unmarshaler)(nil)).Elem(),
+}
+
+// Whether content, or a pointer to it, marshals itself to / from a bson document but
+// not to / from json.
+func marshalsOnlyBson(content interface{}) bool {
+	contentType := reflect.TypeOf(content)
+	if contentType == nil {
+		return false
+	}
+
+	return implementsAny(contentType, bsonMarshalerTypes) &&
+		!implementsAny(contentType, jsonMarshalerTypes)
+}
+
+// Whether valueType or a pointer to it implements any of interfaces.
+func implementsAny(valueType reflect.Type, interfaces []reflect.Type) bool {
+	pointerType := valueType
+	if valueType.Kind() != reflect.Ptr {
+		pointerType = reflect.PtrTo(valueType)
+	}
+
+	for _, thisInterface := range interfaces {
+		if pointerType.Implements(thisInterface) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+)
+
+/*
+DecodeStream decodes a list one element at a time, passing each to onElement as it is
+read rather than decoding the whole list into memory first. Each element is decoded into
+a fresh value of elementExample's type and passed as a pointer, so an elementExample of
+Name{} or &Name{} results in onElement receiving a *Name.
+
+Only as much of reader is read as is needed for the next element, so DecodeStream
+composes with wrapping readers like gzip.Reader: a compressed list is inflated element
+by element.
+
+BSON lists (documents separated by BsonListSepBytes), JSON arrays and ndjson documents
+are supported, and are decoded with the engine's default BSON and JSON decoders.
+Decoding stops at the first error, whether from decoding an element or returned by
+onElement.
+*/
+func (engine *SpanEngine) DecodeStream(
+	mimeType mimetype.MimeType,
+	reader io.Reader,
+	elementExample interface{},
+	onElement func(element interface{}) error,
+) error {
+	elementType := reflect.TypeOf(elementExample)
+	if elementType == nil {
+		return xerrors.New("stream element example cannot be nil")
+	}
+	if elementType.Kind() == reflect.Ptr {
+		elementType = elementType.Elem()
+	}
+
+	newElement := func([]byte) interface{} {
+		return reflect.New(elementType).Interface()
+	}
+	return engine.decodeElements(mimeType, reader, newElement, onElement)
+}
+
+/*
+DecodeManyFactory decodes a list of mixed types one element at a time, like
+DecodeStream(), for polymorphic lists where each element carries a discriminator like
+{"type": "owl"}.
+
+factory is passed the raw bytes of each element, a JSON value or a BSON document, to
+inspect before it is decoded, and returns the pointer to decode the element into, like
+&Owl{}. The decoded pointer is then passed to appendFn. Decoding stops with an error if
+factory returns nil.
+*/
+func (engine *SpanEngine) DecodeManyFactory(
+	mimeType mimetype.MimeType,
+	reader io.Reader,
+	factory func(peek []byte) interface{},
+	appendFn func(element interface{}),
+) error {
+	onElement := func(element interface{}) error {
+		appendFn(element)
+		return nil
+	}
+	return engine.decodeElements(mimeType, reader, factory, onElement)
+}
+
+// Decodes each element of a list into the value newElement returns for it, passing the
+// result to onElement.
+func (engine *SpanEngine) decodeElements(
+	mimeType mimetype.MimeType,
+	reader io.Reader,
+	newElement func(content []byte) interface{},
+	onElement func(element interface{}) error,
+) error {
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return err
+	}
+
+	stream := &elementStream{
+		engine:     engine,
+		newElement: newElement,
+		onElement:  onElement,
+	}
+
+	switch mimeType {
+	case mimetype.BSON:
+		return stream.decodeBSON(bufio.NewReader(reader))
+	case mimetype.JSON:
+		return stream.decodeJSON(reader)
+	case mimetype.NDJSON:
+		return stream.decodeNDJSON(bufio.NewReader(reader))
+	}
+
+	return xerrors.Errorf("stream decoding not supported for %v", mimeType)
+}
+
+// State for a single DecodeStream() or DecodeManyFactory() call.
+type elementStream struct {
+	engine *SpanEngine
+	// Returns the receiver to decode an element's content into.
+	newElement func(content []byte) interface{}
+	onElement  func(element interface{}) error
+	// Number of elements decoded so far.
+	count int
+}
+
+// Decodes a single element with decoder and passes it to onElement.
+func (stream *elementStream) handle(decoder Decoder, content []byte) error {
+	stream.count++
+	if err := stream.engine.checkListLength(stream.count); err != nil {
+		return err
+	}
+
+	element := stream.newElement(content)
+	if element == nil {
+		return xerrors.Errorf("decode err: no receiver for element %v", stream.count-1)
+	}
+
+	err := stream.engine.safeDecode(decoder, bytes.NewReader(content), element)
+	if err != nil {
+		return xerrors.Errorf(
+			"decode err: error decoding element %v: %w", stream.count-1, err,
+		)
+	}
+
+	stream.engine.transformDecoded(element)
+	return stream.onElement(element)
+}
+
+// Decodes each document of a BSON list.
+func (stream *elementStream) decodeBSON(reader *bufio.Reader) error {
+	decoder := &bsonSingleDecoder{}
+
+	for {
+		document, err := readBsonListDocument(reader, stream.count == 0)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return xerrors.Errorf("decode err: %w", err)
+		}
+
+		if err := stream.handle(decoder, document); err != nil {
+			return err
+		}
+	}
+}
+
+// Decodes each element of a JSON array.
+func (stream *elementStream) decodeJSON(reader io.Reader) error {
+	jsonDecoder := json.NewDecoder(reader)
+
+	token, err := jsonDecoder.Token()
+	if err != nil {
+		return xerrors.Errorf("decode err: %w", err)
+	}
+	if token != json.Delim('[') {
+		return xerrors.New("decode err: json content is not a list")
+	}
+
+	decoder := &jsonEncoder{}
+	for jsonDecoder.More() {
+		var element json.RawMessage
+		if err := jsonDecoder.Decode(&element); err != nil {
+			return xerrors.Errorf("decode err: %w", err)
+		}
+
+		if err := stream.handle(decoder, element); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Decodes each line of ndjson content, skipping empty lines.
+func (stream *elementStream) decodeNDJSON(reader *bufio.Reader) error {
+	lines := &ndjsonEncoder{}
+	decoder := &jsonEncoder{}
+
+	for {
+		line, err := lines.nextLine(reader)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return xerrors.Errorf("decode err: %w", err)
+		}
+
+		if err := stream.handle(decoder, line); err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the next document of a BSON list from reader, returning io.EOF when the list
+// has ended. Every document but the first must be preceded by BsonListSepBytes.
+func readBsonListDocument(reader *bufio.Reader, first bool) ([]byte, error) {
+	if !first {
+		separator := make([]byte, len(BsonListSepBytes))
+		if _, err := io.ReadFull(reader, separator); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(separator, BsonListSepBytes) {
+			return nil, xerrors.New("expected bson document separator")
+		}
+	}
+
+	lengthBytes, err := reader.Peek(4)
+	if err == io.EOF && len(lengthBytes) == 0 && first {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, xerrors.Errorf("error reading bson document length: %w", err)
+	}
+
+	length := int32(binary.LittleEndian.Uint32(lengthBytes))
+	if length < 5 {
+		return nil, xerrors.Errorf("invalid bson document length %v", length)
+	}
+
+	document := make([]byte, length)
+	if _, err := io.ReadFull(reader, document); err != nil {
+		return nil, xerrors.Errorf("error reading bson document: %w", err)
+	}
+	return document, nil
+}
+
+// Decodes a single bson document regardless of the receiver type, for decoding list
+// elements which may themselves be slices.
+type bsonSingleDecoder struct {
+	bsonEncoder
+}
+
+func (decoder *bsonSingleDecoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	return decoder.decodeSingle(engine.(*SpanEngine), reader, contentReceiver)
+}
@@ -0,0 +1,98 @@
+package encoding
+
+import (
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+/*
+ObjectStreamEncoder writes a JSON object to a writer one field at a time, so large maps
+like cache dumps can be encoded without building the whole map in memory first. Values
+are encoded with the engine's JSON codec, so registered JSON extensions apply. The
+object is always written compactly, regardless of SetJSONIndent() and
+SetJSONFieldNamer().
+
+Create one with SpanEngine.NewObjectStreamEncoder(), call WriteField() for each field,
+and call Close() to finish the object. Duplicate keys are not detected.
+
+After an error, all further calls return that same error. If json is left out of
+SetAllowedMimeTypes(), the stream starts with a *MimeTypeNotAllowedError and writes
+nothing.
+*/
+type ObjectStreamEncoder struct {
+	engine *SpanEngine
+	writer io.Writer
+	// Number of fields written so far.
+	fieldCount int
+	closed     bool
+	err        error
+}
+
+// Returns an ObjectStreamEncoder which writes a JSON object to writer.
+func (engine *SpanEngine) NewObjectStreamEncoder(
+	writer io.Writer,
+) *ObjectStreamEncoder {
+	return &ObjectStreamEncoder{
+		engine: engine,
+		writer: writer,
+		err:    engine.checkMimeTypeAllowed(mimetype.JSON),
+	}
+}
+
+// Writes a single key / value pair to the object.
+func (stream *ObjectStreamEncoder) WriteField(key string, value interface{}) error {
+	if stream.err != nil {
+		return stream.err
+	}
+	if stream.closed {
+		return xerrors.New("object stream is closed")
+	}
+
+	stream.err = stream.writeField(key, value)
+	return stream.err
+}
+
+func (stream *ObjectStreamEncoder) writeField(key string, value interface{}) error {
+	separator := ","
+	if stream.fieldCount == 0 {
+		separator = "{"
+	}
+
+	keyBytes, err := json.Marshal(key)
+	if err != nil {
+		return xerrors.Errorf("error encoding key %v: %w", key, err)
+	}
+
+	prefix := append([]byte(separator), keyBytes...)
+	if _, err := stream.writer.Write(append(prefix, ':')); err != nil {
+		return err
+	}
+
+	encoder := &compactJSONEncoder{codecs: stream.engine.jsonCodecPool()}
+	err = stream.engine.safeEncode(encoder, stream.writer, value)
+	if err != nil {
+		return xerrors.Errorf("encode err: field %v: %w", key, err)
+	}
+
+	stream.fieldCount++
+	return nil
+}
+
+// Finishes the object. Close() must be called for the output to be valid JSON.
+// Closing a stream with no fields writes an empty object.
+func (stream *ObjectStreamEncoder) Close() error {
+	if stream.err != nil || stream.closed {
+		return stream.err
+	}
+	stream.closed = true
+
+	closing := "}"
+	if stream.fieldCount == 0 {
+		closing = "{}"
+	}
+
+	_, stream.err = io.WriteString(stream.writer, closing)
+	return stream.err
+}
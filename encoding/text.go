@@ -2,41 +2,196 @@ package encoding
 
 import (
 	"bytes"
+	stdencoding "encoding"
 	"fmt"
 	"golang.org/x/xerrors"
 	"io"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-// TODO: Add ability to register custom formatting functions for named types.
-
 // Handled encoding to / decoding from text/plain
 type textEncoder struct{}
 
+func (encoder *textEncoder) FileExtension() string {
+	return ".txt"
+}
+
+// Whether content is nil or a nil pointer.
+func isNilContent(content interface{}) bool {
+	if content == nil {
+		return true
+	}
+	value := reflect.ValueOf(content)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
+
+// Formats content as text. Nil values are written as the engine's nil text, and
+// types with a formatter registered through RegisterTextFormatter() with it. Otherwise
+// booleans are always written as "true" / "false", and types which implement
+// encoding.TextMarshaler as the text they marshal to.
+func (handler *textEncoder) format(
+	engine ContentEngine, content interface{},
+) (string, error) {
+	if isNilContent(content) {
+		return handler.nilText(engine), nil
+	}
+	if formatter, ok := handler.formatterFor(engine, content); ok {
+		return formatter(content)
+	}
+
+	switch typed := content.(type) {
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case *bool:
+		return strconv.FormatBool(*typed), nil
+	case *string:
+		return *typed, nil
+	case stdencoding.TextMarshaler:
+		text, err := typed.MarshalText()
+		return string(text), err
+	default:
+		return fmt.Sprint(content), nil
+	}
+}
+
+// Returns the text nil content is written as on engine, or an empty string if engine
+// is not a *SpanEngine.
+func (handler *textEncoder) nilText(engine ContentEngine) string {
+	spanEngine, ok := engine.(*SpanEngine)
+	if !ok {
+		return ""
+	}
+	return spanEngine.textNil
+}
+
+// Returns the formatter registered on engine for content, if any.
+func (handler *textEncoder) formatterFor(
+	engine ContentEngine, content interface{},
+) (TextFormatter, bool) {
+	spanEngine, ok := engine.(*SpanEngine)
+	if !ok {
+		return nil, false
+	}
+	return spanEngine.textFormatterFor(content)
+}
+
 func (handler *textEncoder) Encode(
 	engine ContentEngine, writer io.Writer, content interface{},
 ) error {
-	contentString := fmt.Sprint(content)
-	_, err := io.WriteString(writer, contentString)
+	contentString, err := handler.format(engine, content)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, contentString)
 
 	return err
 }
 
+// Parses a boolean from text. Only "true" and "false" are accepted.
+func parseTextBool(text string) (bool, error) {
+	switch text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, xerrors.Errorf("text '%v' is not a valid boolean", text)
+	}
+}
+
+// Reads the full text of reader, trimmed if the engine is set to.
+func (handler *textEncoder) readText(
+	engine ContentEngine, reader io.Reader,
+) (string, error) {
+	buffer := new(bytes.Buffer)
+	if _, err := buffer.ReadFrom(reader); err != nil {
+		return "", err
+	}
+
+	text := buffer.String()
+	if spanEngine, ok := engine.(*SpanEngine); ok && spanEngine.trimTextWhitespace {
+		text = strings.TrimSpace(text)
+	}
+	return text, nil
+}
+
+// Returns the parser registered on engine for contentReceiver, if any.
+func (handler *textEncoder) parserFor(
+	engine ContentEngine, contentReceiver interface{},
+) (TextParser, bool) {
+	spanEngine, ok := engine.(*SpanEngine)
+	if !ok {
+		return nil, false
+	}
+	return spanEngine.textParserFor(contentReceiver)
+}
+
+// Parses text with parser and sets the result on contentReceiver.
+func (handler *textEncoder) decodeParsed(
+	engine ContentEngine,
+	reader io.Reader,
+	contentReceiver interface{},
+	parser TextParser,
+) error {
+	text, err := handler.readText(engine, reader)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := parser(text)
+	if err != nil {
+		return err
+	}
+
+	receiverValue := reflect.ValueOf(contentReceiver).Elem()
+	parsedValue := reflect.ValueOf(parsed)
+	if !parsedValue.IsValid() || !parsedValue.Type().AssignableTo(receiverValue.Type()) {
+		return xerrors.Errorf(
+			"text parser returned %T, which cannot be set on %T", parsed, contentReceiver,
+		)
+	}
+
+	receiverValue.Set(parsedValue)
+	return nil
+}
+
+// Decodes text into a receiver with a parser registered through RegisterTextParser(),
+// a string or bool pointer, or a receiver which implements encoding.TextUnmarshaler.
 func (handler *textEncoder) Decode(
 	engine ContentEngine, reader io.Reader, contentReceiver interface{},
 ) error {
-	stringPointer, ok := contentReceiver.(*string)
-	if !ok {
+	if parser, ok := handler.parserFor(engine, contentReceiver); ok {
+		return handler.decodeParsed(engine, reader, contentReceiver, parser)
+	}
+
+	stringPointer, isString := contentReceiver.(*string)
+	boolPointer, isBool := contentReceiver.(*bool)
+	unmarshaler, isUnmarshaler := contentReceiver.(stdencoding.TextUnmarshaler)
+	if !isString && !isBool && !isUnmarshaler {
 		return xerrors.New(
-			"content receiver must be a string pointer to receive a string.",
+			"content receiver must be a string pointer to receive a string, or a " +
+				"bool pointer to receive a bool.",
 		)
 	}
 
-	buffer := new(bytes.Buffer)
-	if _, err := buffer.ReadFrom(reader); err != nil {
+	text, err := handler.readText(engine, reader)
+	if err != nil {
 		return err
 	}
 
-	*stringPointer = buffer.String()
-
-	return nil
+	switch {
+	case isString:
+		*stringPointer = text
+		return nil
+	case isBool:
+		parsed, err := parseTextBool(text)
+		if err != nil {
+			return err
+		}
+		*boolPointer = parsed
+		return nil
+	}
+	return unmarshaler.UnmarshalText([]byte(text))
 }
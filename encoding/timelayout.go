@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"golang.org/x/xerrors"
+	"time"
+)
+
+// TimeLayoutEpochMillis can be passed to SpanEngine.SetTimeLayout() to write
+// time.Time values as the number of milliseconds since the unix epoch.
+const TimeLayoutEpochMillis = "epoch-millis"
+
+// Returns the number of milliseconds between the unix epoch and value.
+func timeToMillis(value time.Time) int64 {
+	return value.Unix()*1000 + int64(value.Nanosecond())/int64(time.Millisecond)
+}
+
+// Returns the UTC time millis milliseconds after the unix epoch.
+func timeFromMillis(millis int64) time.Time {
+	return time.Unix(millis/1000, (millis%1000)*int64(time.Millisecond)).UTC()
+}
+
+// Returns the layout time.Time strings are written in for layout set through
+// SpanEngine.SetTimeLayout(). RFC 3339 with nanoseconds is used when no layout is set.
+func timeStringLayout(layout string) string {
+	if layout == "" || layout == TimeLayoutEpochMillis {
+		return time.RFC3339Nano
+	}
+	return layout
+}
+
+// Parses text written in the string layout for layout.
+func parseTimeLayout(layout string, text string) (time.Time, error) {
+	stringLayout := timeStringLayout(layout)
+	parsed, err := time.Parse(stringLayout, text)
+	if err != nil {
+		return time.Time{}, xerrors.Errorf(
+			"error parsing time %q with layout %q: %w", text, stringLayout, err,
+		)
+	}
+	return parsed, nil
+}
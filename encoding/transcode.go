@@ -0,0 +1,130 @@
+package encoding
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/xerrors"
+	"io"
+)
+
+/*
+TranscodeStream converts a list from one format to another one element at a time, so a
+large list is never held in memory whole. Each element is read from reader as
+DecodeStream() reads it and written to writer as soon as it is decoded, with the
+engine's default BSON and JSON encoders.
+
+from may be BSON (documents separated by BsonListSepBytes), JSON (an array) or NDJSON.
+to may be any of the same, and BSON is always written with separators, regardless of
+SetBsonWrapLists(). BSON documents are passed through as bson.Raw, so they are written
+to BSON unchanged and to JSON as SetJSONOrderedBSONRaw() dictates. JSON elements are
+decoded untyped, so the key order of their objects is not kept, and are written
+compactly, regardless of SetJSONIndent().
+
+Transcoding stops at the first error. Elements before it will already have been
+written, and a JSON array will be left unterminated.
+*/
+func (engine *SpanEngine) TranscodeStream(
+	from mimetype.MimeType, to mimetype.MimeType, reader io.Reader, writer io.Writer,
+) error {
+	list, err := engine.newListWriter(to, writer)
+	if err != nil {
+		return err
+	}
+
+	newElement := func([]byte) interface{} {
+		if from == mimetype.BSON {
+			return &bson.Raw{}
+		}
+		return new(interface{})
+	}
+
+	err = engine.decodeElements(from, reader, newElement, list.write)
+	if err != nil {
+		return err
+	}
+	return list.close()
+}
+
+// Writes the elements of a list to writer one at a time.
+type listWriter struct {
+	engine   *SpanEngine
+	mimeType mimetype.MimeType
+	writer   io.Writer
+	// Number of elements written so far.
+	count int
+}
+
+// Returns a listWriter which writes a list of mimeType to writer.
+func (engine *SpanEngine) newListWriter(
+	mimeType mimetype.MimeType, writer io.Writer,
+) (*listWriter, error) {
+	switch mimeType {
+	case mimetype.BSON, mimetype.JSON, mimetype.NDJSON:
+	default:
+		return nil, xerrors.Errorf("stream encoding not supported for %v", mimeType)
+	}
+
+	if err := engine.checkMimeTypeAllowed(mimeType); err != nil {
+		return nil, err
+	}
+	return &listWriter{engine: engine, mimeType: mimeType, writer: writer}, nil
+}
+
+// Returns the bytes written before the element at index.
+func (list *listWriter) separator(index int) []byte {
+	switch {
+	case list.mimeType == mimetype.BSON && index > 0:
+		return BsonListSepBytes
+	case list.mimeType == mimetype.JSON && index == 0:
+		return []byte("[")
+	case list.mimeType == mimetype.JSON:
+		return []byte(",")
+	}
+	return nil
+}
+
+// Writes element, a pointer returned by the TranscodeStream() element factory.
+func (list *listWriter) write(element interface{}) error {
+	if _, err := list.writer.Write(list.separator(list.count)); err != nil {
+		return xerrors.Errorf("error writing list separator: %w", err)
+	}
+	list.count++
+
+	// Untyped elements are written as the value they hold, so bson sees a document.
+	if untyped, ok := element.(*interface{}); ok {
+		element = *untyped
+	}
+
+	// JSON elements are framed by hand, so are always written compactly.
+	var encoder Encoder = &compactJSONEncoder{codecs: list.engine.jsonCodecPool()}
+	if list.mimeType == mimetype.BSON {
+		encoder = &bsonEncoder{}
+	}
+	if err := list.engine.safeEncode(encoder, list.writer, element); err != nil {
+		return xerrors.Errorf("error encoding element %v: %w", list.count-1, err)
+	}
+
+	if list.mimeType != mimetype.NDJSON {
+		return nil
+	}
+	if _, err := list.writer.Write(NDJSONSepBytes); err != nil {
+		return xerrors.Errorf("error writing document separator: %w", err)
+	}
+	return nil
+}
+
+// Finishes the list, writing the end of a JSON array.
+func (list *listWriter) close() error {
+	if list.mimeType != mimetype.JSON {
+		return nil
+	}
+
+	end := []byte("]")
+	if list.count == 0 {
+		end = []byte("[]")
+	}
+	if _, err := list.writer.Write(end); err != nil {
+		return xerrors.Errorf("error writing list end: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package encoding
+
+import (
+	"reflect"
+)
+
+// Walks value, replacing every settable string it contains with transform(string).
+// Unexported struct fields are left untouched.
+func transformStrings(value reflect.Value, transform func(string) string) {
+	switch value.Kind() {
+	case reflect.String:
+		if value.CanSet() {
+			value.SetString(transform(value.String()))
+		}
+	case reflect.Ptr:
+		if !value.IsNil() {
+			transformStrings(value.Elem(), transform)
+		}
+	case reflect.Interface:
+		transformInterfaceStrings(value, transform)
+	case reflect.Struct:
+		transformStructStrings(value, transform)
+	case reflect.Slice, reflect.Array:
+		transformSequenceStrings(value, transform)
+	case reflect.Map:
+		transformMapStrings(value, transform)
+	}
+}
+
+// Values held by an interface cannot be set in place, so we need to copy the value
+// out, transform it, and put it back.
+func transformInterfaceStrings(value reflect.Value, transform func(string) string) {
+	if value.IsNil() || !value.CanSet() {
+		return
+	}
+
+	element := reflect.New(value.Elem().Type()).Elem()
+	element.Set(value.Elem())
+	transformStrings(element, transform)
+	value.Set(element)
+}
+
+func transformStructStrings(value reflect.Value, transform func(string) string) {
+	structType := value.Type()
+	for i := 0; i < value.NumField(); i++ {
+		// Skip unexported fields.
+		if structType.Field(i).PkgPath != "" {
+			continue
+		}
+		transformStrings(value.Field(i), transform)
+	}
+}
+
+func transformSequenceStrings(value reflect.Value, transform func(string) string) {
+	// Skip byte slices, which are common and can be large.
+	if value.Type().Elem().Kind() == reflect.Uint8 {
+		return
+	}
+
+	for i := 0; i < value.Len(); i++ {
+		transformStrings(value.Index(i), transform)
+	}
+}
+
+// Map values are not addressable, so like interfaces, each value has to be copied out,
+// transformed and set back.
+func transformMapStrings(value reflect.Value, transform func(string) string) {
+	if value.IsNil() {
+		return
+	}
+
+	for _, key := range value.MapKeys() {
+		element := reflect.New(value.Type().Elem()).Elem()
+		element.Set(value.MapIndex(key))
+		transformStrings(element, transform)
+		value.SetMapIndex(key, element)
+	}
+}
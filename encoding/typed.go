@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package encoding
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"io"
+)
+
+// DecodeTyped decodes mimeType content from reader into a newly allocated T and
+// returns it, removing the need to declare a receiver and pass it as an interface{}.
+// On error, the zero value of T is returned.
+func DecodeTyped[T any](
+	engine ContentEngine, mimeType mimetype.MimeType, reader io.Reader,
+) (T, error) {
+	var receiver T
+
+	if _, err := engine.Decode(mimeType, &receiver, reader); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return receiver, nil
+}
+
+// EncodeTyped encodes content as mimeType to writer. It is the type-safe counterpart
+// of DecodeTyped().
+func EncodeTyped[T any](
+	engine ContentEngine, mimeType mimetype.MimeType, content T, writer io.Writer,
+) error {
+	_, err := engine.Encode(mimeType, content, writer)
+	return err
+}
@@ -0,0 +1,45 @@
+package encoding
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+)
+
+/*
+DecodeVersioned decodes mimeType content from reader into a new value of the type
+registered for version, for APIs where clients send a schema version alongside the
+body and each version decodes into its own struct.
+
+The decoded value is returned as the registered type: registering V2{} returns a V2,
+and registering &V2{}'s type returns a *V2. A blank version is looked up like any other,
+so a registry can hold a "" entry for clients which send no version. If no type is
+registered for version, nothing is read from reader and an error is returned.
+*/
+func (engine *SpanEngine) DecodeVersioned(
+	mimeType mimetype.MimeType,
+	version string,
+	registry map[string]reflect.Type,
+	reader io.Reader,
+) (interface{}, error) {
+	receiverType, ok := registry[version]
+	if !ok || receiverType == nil {
+		return nil, xerrors.Errorf("no receiver type registered for version '%v'", version)
+	}
+
+	isPointer := receiverType.Kind() == reflect.Ptr
+	if isPointer {
+		receiverType = receiverType.Elem()
+	}
+
+	receiver := reflect.New(receiverType)
+	if _, err := engine.Decode(mimeType, receiver.Interface(), reader); err != nil {
+		return nil, err
+	}
+
+	if isPointer {
+		return receiver.Interface(), nil
+	}
+	return receiver.Elem().Interface(), nil
+}
@@ -0,0 +1,161 @@
+package encoding
+
+import (
+	"bytes"
+	stdencoding "encoding"
+	"encoding/xml"
+	"golang.org/x/xerrors"
+	"io"
+	"reflect"
+)
+
+// XMLListRootDefault is the name of the root element top-level lists are wrapped in
+// when encoded to xml, unless changed with SpanEngine.SetXMLListRoot().
+const XMLListRootDefault = "list"
+
+// Interfaces for types which marshal themselves to / from xml, and so are never
+// handled as a list.
+var xmlMarshalerTypes = []reflect.Type{
+	reflect.TypeOf((*xml.Marshaler)(nil)).Elem(),
+	reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem(),
+	reflect.TypeOf((*stdencoding.TextMarshaler)(nil)).Elem(),
+	reflect.TypeOf((*stdencoding.TextUnmarshaler)(nil)).Elem(),
+}
+
+// XML encoder for SpanEngine. Handles encoding to / decoding from application/xml
+// through encoding/xml.
+//
+// XML has no top-level list, so slices and arrays are written as the children of a
+// root element named by SpanEngine.XMLListRoot(), and slices are decoded from the
+// children of the root element, whatever its name. Types which implement
+// encoding.TextMarshaler, like UUIDs and spantypes.BinData, are written as the text of
+// their element, so BinData is hex like it is in json.
+type xmlEncoder struct{}
+
+func (encoder *xmlEncoder) FileExtension() string {
+	return ".xml"
+}
+
+// Only content which starts with a tag, like an element or declaration, is sniffed as
+// xml.
+func (encoder *xmlEncoder) CanSniff(peek []byte) bool {
+	peek = bytes.TrimLeft(peek, " \t\r\n")
+	return len(peek) > 0 && peek[0] == '<'
+}
+
+// Whether value is a top-level list to be handled as the children of a root element.
+// Byte slices and types which marshal themselves are handled as a single value.
+func (encoder *xmlEncoder) isList(value interface{}) bool {
+	valueType := reflect.TypeOf(value)
+	if valueType == nil || implementsAny(valueType, xmlMarshalerTypes) {
+		return false
+	}
+
+	indirect := reflect.Indirect(reflect.ValueOf(value))
+	kind := indirect.Kind()
+	return (kind == reflect.Slice || kind == reflect.Array) &&
+		indirect.Type().Elem().Kind() != reflect.Uint8
+}
+
+// Writes each element of list content as a child of the list root element.
+func (encoder *xmlEncoder) encodeList(
+	spanEngine *SpanEngine, writer io.Writer, content interface{},
+) error {
+	xmlWriter := xml.NewEncoder(writer)
+	root := xml.StartElement{Name: xml.Name{Local: spanEngine.XMLListRoot()}}
+
+	if err := xmlWriter.EncodeToken(root); err != nil {
+		return err
+	}
+
+	contentValue := reflect.Indirect(reflect.ValueOf(content))
+	for i := 0; i < contentValue.Len(); i++ {
+		if err := xmlWriter.Encode(contentValue.Index(i).Interface()); err != nil {
+			return xerrors.Errorf("error encoding xml element %v: %w", i, err)
+		}
+	}
+
+	if err := xmlWriter.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	return xmlWriter.Flush()
+}
+
+func (encoder *xmlEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+
+	if encoder.isList(content) {
+		return encoder.encodeList(spanEngine, writer, content)
+	}
+	return xml.NewEncoder(writer).Encode(content)
+}
+
+// Returns the next start element read by xmlReader, or nil once the element it is
+// inside of ends.
+func nextXMLStart(xmlReader *xml.Decoder) (*xml.StartElement, error) {
+	for {
+		token, err := xmlReader.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch typed := token.(type) {
+		case xml.StartElement:
+			return &typed, nil
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+// Decodes each child of the root element, appending each to the slice contentReceiver
+// points to.
+func (encoder *xmlEncoder) decodeList(
+	spanEngine *SpanEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	xmlReader := xml.NewDecoder(reader)
+	if _, err := nextXMLStart(xmlReader); err == io.EOF {
+		return xerrors.New("xml content has no root element")
+	} else if err != nil {
+		return err
+	}
+
+	sliceValue := reflect.ValueOf(contentReceiver).Elem()
+	elementType := sliceValue.Type().Elem()
+
+	for count := 1; ; count++ {
+		start, err := nextXMLStart(xmlReader)
+		if err != nil {
+			return err
+		} else if start == nil {
+			return nil
+		}
+
+		if err := spanEngine.checkListLength(count); err != nil {
+			return err
+		}
+
+		element := reflect.New(elementType)
+		if err := xmlReader.DecodeElement(element.Interface(), start); err != nil {
+			return xerrors.Errorf("error decoding xml element %v: %w", count, err)
+		}
+		sliceValue.Set(reflect.Append(sliceValue, element.Elem()))
+	}
+}
+
+func (encoder *xmlEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	spanEngine := engine.(*SpanEngine)
+
+	receiverValue := reflect.ValueOf(contentReceiver)
+	isSlice := receiverValue.Kind() == reflect.Ptr &&
+		receiverValue.Elem().Kind() == reflect.Slice
+
+	if isSlice && encoder.isList(contentReceiver) {
+		return encoder.decodeList(spanEngine, reader, contentReceiver)
+	}
+	return xml.NewDecoder(reader).Decode(contentReceiver)
+}
@@ -0,0 +1,168 @@
+package encoding
+
+import (
+	"bytes"
+	stdencoding "encoding"
+	"fmt"
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"reflect"
+)
+
+// YAML encoder for SpanEngine. Handles encoding to / decoding from application/yaml.
+//
+// Like bson, top-level lists are written as a stream of documents, separated by "---".
+// When decoding into a slice, both a stream of documents and a single document holding
+// a sequence are accepted.
+type yamlEncoder struct{}
+
+func (encoder *yamlEncoder) FileExtension() string {
+	return ".yaml"
+}
+
+// Whether value is a top-level list to be handled as a stream of yaml documents.
+// Types which marshal themselves, like uuid.UUID, are handled as a single document.
+func isYAMLList(value interface{}) bool {
+	switch value.(type) {
+	case yaml.Marshaler, yaml.Unmarshaler:
+		return false
+	case stdencoding.TextMarshaler, stdencoding.TextUnmarshaler:
+		return false
+	}
+
+	kind := reflect.Indirect(reflect.ValueOf(value)).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+func (encoder *yamlEncoder) Encode(
+	engine ContentEngine, writer io.Writer, content interface{},
+) error {
+	documents := yaml.NewEncoder(writer)
+
+	if !isYAMLList(content) {
+		if err := documents.Encode(content); err != nil {
+			return err
+		}
+		return documents.Close()
+	}
+
+	// The yaml encoder writes the "---" separator before every document after the
+	// first.
+	contentValue := reflect.Indirect(reflect.ValueOf(content))
+	for i := 0; i < contentValue.Len(); i++ {
+		if err := documents.Encode(contentValue.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return documents.Close()
+}
+
+func (encoder *yamlEncoder) Decode(
+	engine ContentEngine, reader io.Reader, contentReceiver interface{},
+) (err error) {
+	receiverValue := reflect.ValueOf(contentReceiver)
+	isSlice := receiverValue.Kind() == reflect.Ptr &&
+		receiverValue.Elem().Kind() == reflect.Slice
+
+	if isSlice && isYAMLList(contentReceiver) {
+		err = encoder.decodeList(engine.(*SpanEngine), reader, receiverValue.Elem())
+	} else {
+		err = yaml.NewDecoder(reader).Decode(contentReceiver)
+	}
+
+	normalizeYAMLReceiver(contentReceiver)
+	return err
+}
+
+// Decodes a stream of documents, or a single document holding a sequence, into
+// sliceValue.
+func (encoder *yamlEncoder) decodeList(
+	spanEngine *SpanEngine, reader io.Reader, sliceValue reflect.Value,
+) error {
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	if isYAMLSequenceDocument(content) {
+		err = yaml.Unmarshal(content, sliceValue.Addr().Interface())
+		if err != nil {
+			return err
+		}
+		return spanEngine.checkListLength(sliceValue.Len())
+	}
+
+	documents := yaml.NewDecoder(bytes.NewReader(content))
+	sliceValue.Set(reflect.MakeSlice(sliceValue.Type(), 0, 0))
+
+	for count := 1; ; count++ {
+		element := reflect.New(sliceValue.Type().Elem())
+		err := documents.Decode(element.Interface())
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return xerrors.Errorf("error decoding yaml document %v: %w", count-1, err)
+		}
+
+		if err := spanEngine.checkListLength(count); err != nil {
+			return err
+		}
+		sliceValue.Set(reflect.Append(sliceValue, element.Elem()))
+	}
+}
+
+// Whether content is a single yaml document holding a sequence, rather than a stream of
+// documents.
+func isYAMLSequenceDocument(content []byte) bool {
+	documents := yaml.NewDecoder(bytes.NewReader(content))
+
+	var first interface{}
+	if err := documents.Decode(&first); err != nil {
+		return false
+	}
+
+	var second interface{}
+	if err := documents.Decode(&second); err != io.EOF {
+		return false
+	}
+
+	_, isSequence := first.([]interface{})
+	return isSequence
+}
+
+// yaml decodes mappings into empty interfaces as map[interface{}]interface{}. Converts
+// these to map[string]interface{} in interface{}, map[string]interface{} and
+// []interface{} receivers, to match what the json and bson decoders produce.
+func normalizeYAMLReceiver(contentReceiver interface{}) {
+	switch typed := contentReceiver.(type) {
+	case *interface{}:
+		*typed = normalizeYAML(*typed)
+	case *map[string]interface{}:
+		normalizeYAML(*typed)
+	case *[]interface{}:
+		normalizeYAML(*typed)
+	}
+}
+
+// Recursively converts map[interface{}]interface{} values to map[string]interface{}.
+func normalizeYAML(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			normalized[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return normalized
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalizeYAML(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalizeYAML(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,264 @@
+package mimetype
+
+import (
+	"container/list"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AcceptEntry is a single media range parsed from an Accept header, like
+// "application/json;q=0.8".
+type AcceptEntry struct {
+	// Mimetype of the media range, normalized through FromString(). Wildcard ranges
+	// like "*/*" and "application/*" are kept as-is.
+	MimeType MimeType
+
+	// Quality value of the entry from 0 to 1. Defaults to 1 when not sent. Entries with
+	// a malformed quality value are given a quality of 0.
+	Quality float64
+
+	// Any additional parameters sent with the media range, excluding "q".
+	Params map[string]string
+}
+
+// Parses a single media range of an Accept header.
+func parseAcceptEntry(raw string) (entry AcceptEntry, ok bool) {
+	mediaRange, params := parseMediaType(raw)
+	if mediaRange == "" {
+		return entry, false
+	}
+
+	entry = AcceptEntry{
+		MimeType: FromString(mediaRange),
+		Quality:  1,
+		Params:   params,
+	}
+
+	rawQuality, hasQuality := params["q"]
+	if !hasQuality {
+		return entry, true
+	}
+	delete(params, "q")
+
+	quality, err := strconv.ParseFloat(rawQuality, 64)
+	if err != nil || quality < 0 || quality > 1 {
+		quality = 0
+	}
+	entry.Quality = quality
+
+	return entry, true
+}
+
+// ParseAccept parses an Accept header value into its entries, sorted from highest to
+// lowest quality. Entries of equal quality keep the order they were sent in.
+func ParseAccept(accept string) []AcceptEntry {
+	entries := make([]AcceptEntry, 0)
+
+	for _, raw := range strings.Split(accept, ",") {
+		if entry, ok := parseAcceptEntry(raw); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Quality > entries[j].Quality
+	})
+
+	return entries
+}
+
+// Number of Accept headers cached by the package-level parser.
+const acceptCacheSize = 128
+
+// Parser used by FromAcceptHeader(), so the handful of Accept headers clients send over
+// and over are parsed once.
+var acceptParser = NewAcceptParser(acceptCacheSize)
+
+// FromAcceptHeader parses every Accept header sent on a message / request, like
+// http.Request.Header. See ParseAccept() for details. Returns no entries if the
+// header was not sent. Results are cached by a package-level AcceptParser.
+func FromAcceptHeader(headers headerFetcher) []AcceptEntry {
+	return acceptParser.Parse(strings.Join(headerValues(headers, "Accept"), ","))
+}
+
+// Specificity returns how specifically the entry's media range matches mimeType: 2 for
+// an exact match, 1 for a "type/*" match, 0 for "*/*" and -1 if it does not match.
+// When several entries match a mimetype, the most specific one sets its quality.
+func (entry AcceptEntry) Specificity(mimeType MimeType) int {
+	mediaRange := strings.ToLower(string(entry.MimeType))
+	mimeTypeLower := strings.ToLower(string(mimeType))
+
+	switch {
+	case mediaRange == mimeTypeLower:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*") &&
+		strings.HasPrefix(mimeTypeLower, strings.TrimSuffix(mediaRange, "*")):
+		return 1
+	}
+	return -1
+}
+
+// Used in place of an absent Accept header, which accepts any mimetype.
+var acceptAny = []AcceptEntry{{MimeType: "*/*", Quality: 1}}
+
+// Returns the quality entries assign to mimeType, set by the most specific entry which
+// matches it, and the index of that entry. Returns a quality of 0 if no entry matches.
+func acceptQuality(
+	entries []AcceptEntry, mimeType MimeType,
+) (quality float64, index int) {
+	specificity := -1
+	index = len(entries)
+
+	for i, entry := range entries {
+		if matched := entry.Specificity(mimeType); matched > specificity {
+			specificity = matched
+			quality = entry.Quality
+			index = i
+		}
+	}
+	return quality, index
+}
+
+// NegotiateEntries picks the best match for entries, parsed by ParseAccept() or
+// FromAcceptHeader(), from supported.
+//
+// Each supported mimetype is normalized through FromString(), so aliases like
+// "application/x-yaml" match, and given the quality of the most specific entry which
+// matches it. The mimetype with the highest quality is returned as it appears in
+// supported, with ties going to the entry the client sent first, and then to the
+// earlier supported mimetype. Wildcards like "*/*" and "application/*" therefore
+// resolve to the first supported mimetype they match, as does an empty entries.
+//
+// Returns UNKNOWN if no supported mimetype has a quality above 0.
+func NegotiateEntries(entries []AcceptEntry, supported []MimeType) MimeType {
+	if len(entries) == 0 {
+		entries = acceptAny
+	}
+
+	best := UNKNOWN
+	bestQuality, bestIndex := 0.0, len(entries)
+
+	for _, candidate := range supported {
+		quality, index := acceptQuality(entries, FromString(string(candidate)))
+		// Mimetypes the client does not accept are never picked.
+		if quality == 0 {
+			continue
+		}
+		if quality > bestQuality || (quality == bestQuality && index < bestIndex) {
+			best, bestQuality, bestIndex = candidate, quality, index
+		}
+	}
+	return best
+}
+
+// Negotiate picks the mimetype from supported which best matches the Accept header of
+// a message / request, like http.Request.Header, so a response can be encoded in
+// whichever type the client prefers. Quality values are honored, and an absent header
+// accepts the first supported mimetype. The header is parsed by FromAcceptHeader(), so
+// recently seen headers are not parsed again. See NegotiateEntries() for details.
+//
+// Returns UNKNOWN if the client accepts none of supported.
+func Negotiate(headers headerFetcher, supported []MimeType) MimeType {
+	return NegotiateEntries(FromAcceptHeader(headers), supported)
+}
+
+// Cached parse result stored in the AcceptParser's list.
+type acceptCacheItem struct {
+	accept  string
+	entries []AcceptEntry
+}
+
+/*
+AcceptParser parses Accept headers and caches the results in a fixed-size LRU cache.
+Clients tend to send the same handful of Accept headers over and over, so under high
+load re-using the parsed result is much cheaper than re-parsing it on every request.
+
+AcceptParser is safe for concurrent use. Create one with NewAcceptParser().
+*/
+type AcceptParser struct {
+	// Maximum number of headers to cache.
+	capacity int
+	// Most recently used items are kept at the front.
+	order *list.List
+	// Accept header:list element index for lookups.
+	items map[string]*list.Element
+	// Guards order and items.
+	lock sync.Mutex
+}
+
+// Parse returns the parsed entries of an Accept header, using the cached result if
+// this header has been seen recently. See ParseAccept() for details. The returned
+// entries, including their Params, may be modified by the caller without affecting the
+// cache.
+func (parser *AcceptParser) Parse(accept string) []AcceptEntry {
+	if parser.capacity <= 0 {
+		return ParseAccept(accept)
+	}
+
+	parser.lock.Lock()
+	defer parser.lock.Unlock()
+
+	element, ok := parser.items[accept]
+	if ok {
+		parser.order.MoveToFront(element)
+	} else {
+		element = parser.order.PushFront(
+			&acceptCacheItem{accept: accept, entries: ParseAccept(accept)},
+		)
+		parser.items[accept] = element
+		parser.evict()
+	}
+
+	cached := element.Value.(*acceptCacheItem).entries
+	entries := make([]AcceptEntry, len(cached))
+	for i, entry := range cached {
+		entries[i] = entry.clone()
+	}
+
+	return entries
+}
+
+// Returns a copy of entry with its own Params.
+func (entry AcceptEntry) clone() AcceptEntry {
+	if entry.Params == nil {
+		return entry
+	}
+
+	params := make(map[string]string, len(entry.Params))
+	for key, value := range entry.Params {
+		params[key] = value
+	}
+	entry.Params = params
+	return entry
+}
+
+// Drops least recently used items until the cache is within capacity.
+func (parser *AcceptParser) evict() {
+	for parser.order.Len() > parser.capacity {
+		oldest := parser.order.Back()
+		parser.order.Remove(oldest)
+		delete(parser.items, oldest.Value.(*acceptCacheItem).accept)
+	}
+}
+
+// Len returns the number of Accept headers currently cached.
+func (parser *AcceptParser) Len() int {
+	parser.lock.Lock()
+	defer parser.lock.Unlock()
+
+	return parser.order.Len()
+}
+
+// NewAcceptParser returns an AcceptParser which caches up to capacity parsed headers.
+// A capacity of 0 or less disables caching.
+func NewAcceptParser(capacity int) *AcceptParser {
+	return &AcceptParser{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
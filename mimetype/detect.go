@@ -0,0 +1,48 @@
+package mimetype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+/*
+Detect classifies data by its content. JSON and BSON documents are recognized first by
+their structure, after which detection falls back to http.DetectContentType(), which
+recognizes common formats like images, PDFs and plain text. Parameters like charset are
+dropped from the result, and "text/plain" is returned as TEXT.
+
+Content nothing recognizes is returned as "application/octet-stream".
+*/
+func Detect(data []byte) MimeType {
+	if isJSON(data) {
+		return JSON
+	}
+	if isBSONDocument(data) {
+		return BSON
+	}
+
+	detected := http.DetectContentType(data)
+	return FromString(strings.TrimSpace(strings.Split(detected, ";")[0]))
+}
+
+// Whether data is a JSON object or array.
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+	return json.Valid(trimmed)
+}
+
+// Whether data is a single BSON document: a little-endian int32 length prefix equal to
+// the length of data, ending with a null terminator.
+func isBSONDocument(data []byte) bool {
+	if len(data) < 5 {
+		return false
+	}
+	length := binary.LittleEndian.Uint32(data)
+	return int(length) == len(data) && data[len(data)-1] == 0
+}
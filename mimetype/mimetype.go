@@ -17,14 +17,23 @@ const (
 	JSON = MimeType("application/json")
 	BSON = MimeType("application/bson")
 	YAML = MimeType("application/yaml")
+	GOB  = MimeType("application/x-gob")
+	FORM = MimeType("application/x-www-form-urlencoded")
 	TEXT = MimeType("text/plain")
+	HTML = MimeType("text/html")
+	// NDJSON is newline-delimited json, with one document per line.
+	NDJSON = MimeType("application/x-ndjson")
+	// XML is also matched from "text/xml".
+	XML = MimeType("application/xml")
+	// MSGPACK is MessagePack, also matched from "application/x-msgpack".
+	MSGPACK = MimeType("application/msgpack")
 	// UNKNOWN is used when the incoming string is blank
 	UNKNOWN = MimeType("")
 )
 
 // List of default mimeTypes that are encoded to / from objects (as opposed to raw
-// text).
-var objectMimeTypes = []MimeType{JSON, BSON, YAML}
+// text). Types are matched by suffix in this order, so NDJSON must come before JSON.
+var objectMimeTypes = []MimeType{NDJSON, JSON, BSON, YAML, GOB, FORM, XML, MSGPACK}
 
 // Interface for object used to set headers such as http.Request.Header or
 // http.Response.Header
@@ -32,9 +41,89 @@ type headerFetcher interface {
 	Get(string) string
 }
 
-// Extract content type from a message / request header.
+// Interface for header objects which can return every value sent for a key, such as
+// http.Header.
+type headerValuesFetcher interface {
+	Values(string) []string
+}
+
+// Returns all raw values sent for key, falling back to Get() if headers cannot return
+// multiple values.
+func headerValues(headers headerFetcher, key string) []string {
+	if valuesFetcher, ok := headers.(headerValuesFetcher); ok {
+		return valuesFetcher.Values(key)
+	}
+	return []string{headers.Get(key)}
+}
+
+// Extract content type from a message / request header. If multiple content types
+// were sent, either as separate headers or comma-joined by a proxy, the first valid one
+// is returned. Parameters like "charset=utf-8" are ignored; use FromHeaderWithParams()
+// to read them.
 func FromHeader(headers headerFetcher) MimeType {
-	return FromString(headers.Get("Content-Type"))
+	mimeType, _ := FromHeaderWithParams(headers)
+	return mimeType
+}
+
+// Extract content type from a message / request header along with its parameters,
+// like {"charset": "utf-8"} for "application/json; charset=utf-8". Parameter names are
+// lowercased, and values are unquoted but otherwise left as sent. If multiple content
+// types were sent, the first valid one and its parameters are returned. The parameters
+// are empty if none were sent.
+func FromHeaderWithParams(headers headerFetcher) (MimeType, map[string]string) {
+	for _, raw := range contentTypeValues(headers) {
+		mediaType, params := parseMediaType(raw)
+		if mimeType := FromString(mediaType); mimeType != UNKNOWN {
+			return mimeType, params
+		}
+	}
+	return UNKNOWN, make(map[string]string)
+}
+
+// Extract every content type from a message / request header in the order they were
+// sent. Multiple Content-Type headers and comma-joined values are both split into
+// separate entries, and blank entries are dropped. Useful for trying each declared type
+// in order when a message's headers are malformed.
+func FromHeaderAll(headers headerFetcher) []MimeType {
+	mimeTypes := make([]MimeType, 0)
+
+	for _, raw := range contentTypeValues(headers) {
+		mimeType := FromString(raw)
+		if mimeType != UNKNOWN {
+			mimeTypes = append(mimeTypes, mimeType)
+		}
+	}
+
+	return mimeTypes
+}
+
+// Returns every Content-Type value sent, splitting comma-joined values.
+func contentTypeValues(headers headerFetcher) []string {
+	values := make([]string, 0)
+	for _, value := range headerValues(headers, "Content-Type") {
+		values = append(values, strings.Split(value, ",")...)
+	}
+	return values
+}
+
+// Splits a media type, like "application/json; charset=utf-8", into the trimmed type
+// and its parameters. Parameter names are lowercased and quotes are trimmed from
+// values.
+func parseMediaType(raw string) (mediaType string, params map[string]string) {
+	parts := strings.Split(raw, ";")
+	params = make(map[string]string)
+
+	for _, param := range parts[1:] {
+		keyValue := strings.SplitN(param, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(keyValue[0]))
+		value := ""
+		if len(keyValue) == 2 {
+			value = strings.Trim(strings.TrimSpace(keyValue[1]), "\"")
+		}
+		params[key] = value
+	}
+
+	return strings.TrimSpace(parts[0]), params
 }
 
 /*
@@ -51,9 +140,13 @@ multiple formats are respected. For instance, all of the following will yield
 • "json"
 
 • "x-json"
+
+• "application/json; charset=utf-8"
+
+Parameters after a ";" are ignored.
 */
 func FromString(incoming string) MimeType {
-	incoming = strings.ToLower(incoming)
+	incoming, _ = parseMediaType(strings.ToLower(incoming))
 
 	if incoming == "" {
 		return UNKNOWN
@@ -65,6 +158,9 @@ func FromString(incoming string) MimeType {
 	for _, mimeType := range objectMimeTypes {
 		mimeTypeLower := strings.ToLower(string(mimeType))
 		mimeTypeLower = strings.Split(mimeTypeLower, "/")[1]
+		// Match on the subtype without an "x-" prefix so aliases like "gob" still
+		// resolve for types whose canonical form is "application/x-gob".
+		mimeTypeLower = strings.TrimPrefix(mimeTypeLower, "x-")
 		if strings.HasSuffix(incoming, mimeTypeLower) {
 			return mimeType
 		}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
 	"golang.org/x/xerrors"
 	"strconv"
+	"strings"
 )
 
 type valueSetter interface {
@@ -75,6 +78,19 @@ func getInt(headers valueFetcher, fieldName string, defaultValue int) (int, erro
 	return valueInt, nil
 }
 
+func getBool(headers valueFetcher, fieldName string, defaultValue bool) (bool, error) {
+	value := headers.Get(fieldName)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	valueBool, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, xerrors.New(fieldName + " is not bool")
+	}
+	return valueBool, nil
+}
+
 // Generates a PagingReq object from request parameters.
 func PagingReqFromParams(
 	headers valueFetcher, defaultLimit int,
@@ -134,3 +150,170 @@ func PagingRespFromHeaders(
 
 	return pagingResp, nil
 }
+
+// Fetches values from the "paging" object of a body by their paging header names, so
+// body paging is parsed the same way as header paging.
+type bodyPaging map[string]interface{}
+
+func (paging bodyPaging) Get(key string) string {
+	value := paging[strings.TrimPrefix(key, "paging-")]
+
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case float64:
+		// JSON numbers decode as float64, which fmt would write with an exponent once
+		// large enough.
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// Returns value as a map with string keys if it is a decoded object.
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(typed))
+		for key, fieldValue := range typed {
+			converted[fmt.Sprint(key)] = fieldValue
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// Returns the envelope object of body, decoding it first if it is raw JSON.
+func bodyEnvelope(body interface{}) (map[string]interface{}, error) {
+	var raw []byte
+	switch typed := body.(type) {
+	case []byte:
+		raw = typed
+	case json.RawMessage:
+		raw = typed
+	default:
+		envelope, ok := toStringMap(body)
+		if !ok {
+			return nil, xerrors.Errorf("body of type %T is not an object", body)
+		}
+		return envelope, nil
+	}
+
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, xerrors.Errorf("error decoding body: %w", err)
+	}
+	return envelope, nil
+}
+
+/*
+PagingFromBody generates a PagingResp object from the "paging" object of a response
+body, for APIs which send paging alongside the data, like
+{"paging": {...}, "data": [...]}, rather than in headers.
+
+body may be raw JSON, as a []byte or json.RawMessage, or an envelope which has already
+been decoded into a map. The keys of the paging object are the paging header names
+without their "paging-" prefix:
+
+	{"offset": 10, "limit": 50, "total-items": 200, "total-pages": 4,
+	"current-page": 2, "next": "...", "previous": "..."}
+
+Missing values default as they do for PagingRespFromHeaders(), and errors name the
+header a value would have been sent in, like "paging-limit is not int".
+*/
+func PagingFromBody(body interface{}, defaultLimit int) (*PagingResp, error) {
+	envelope, err := bodyEnvelope(body)
+	if err != nil {
+		return nil, err
+	}
+
+	paging, ok := toStringMap(envelope["paging"])
+	if !ok {
+		return nil, xerrors.New("body has no paging object")
+	}
+
+	return PagingRespFromHeaders(bodyPaging(paging), defaultLimit)
+}
+
+// Cursor paging parameters for request, for collections paged by an opaque cursor
+// rather than an offset.
+type CursorPagingReq struct {
+	// Opaque cursor of the page to fetch. Blank for the first page.
+	Cursor string
+	// Maximum item count to return.
+	Limit int
+}
+
+// Dumps cursor paging information to request URL params.
+func (pagingReq *CursorPagingReq) ToParams(params valueSetter) {
+	if pagingReq.Cursor != "" {
+		params.Set("paging-cursor", pagingReq.Cursor)
+	}
+	// Only send back limit if it is valid.
+	if pagingReq.Limit > 0 {
+		params.Set("paging-limit", strconv.Itoa(pagingReq.Limit))
+	}
+}
+
+type CursorPagingResp struct {
+	*CursorPagingReq
+	// Cursor of the next page. Blank if there is none.
+	NextCursor string
+	// Cursor of the previous page. Blank if there is none.
+	PrevCursor string
+	// Whether there are more items after this page.
+	HasMore bool
+}
+
+func (pagingResp *CursorPagingResp) ToHeaders(headers valueSetter) {
+	pagingResp.CursorPagingReq.ToParams(headers)
+	headers.Set("paging-has-more", strconv.FormatBool(pagingResp.HasMore))
+	// Only send back valid fields.
+	if pagingResp.NextCursor != "" {
+		headers.Set("paging-next-cursor", pagingResp.NextCursor)
+	}
+	if pagingResp.PrevCursor != "" {
+		headers.Set("paging-prev-cursor", pagingResp.PrevCursor)
+	}
+}
+
+// Generates a CursorPagingReq object from request parameters.
+func CursorPagingReqFromParams(
+	params valueFetcher, defaultLimit int,
+) (pagingReq *CursorPagingReq, err error) {
+	pagingReq = &CursorPagingReq{Cursor: params.Get("paging-cursor")}
+
+	pagingReq.Limit, err = getInt(params, "paging-limit", defaultLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagingReq, nil
+}
+
+// CursorPagingRespFromHeaders generates a CursorPagingResp object from response
+// headers. HasMore is false if the header is missing.
+func CursorPagingRespFromHeaders(
+	headers valueFetcher, defaultLimit int,
+) (pagingResp *CursorPagingResp, err error) {
+	pagingReq, err := CursorPagingReqFromParams(headers, defaultLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	pagingResp = &CursorPagingResp{
+		CursorPagingReq: pagingReq,
+		NextCursor:      headers.Get("paging-next-cursor"),
+		PrevCursor:      headers.Get("paging-prev-cursor"),
+	}
+
+	pagingResp.HasMore, err = getBool(headers, "paging-has-more", false)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagingResp, nil
+}
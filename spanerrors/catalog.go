@@ -0,0 +1,68 @@
+package spanerrors
+
+import (
+	"golang.org/x/xerrors"
+)
+
+// ErrorTypeDef is a plain definition of a SpanErrorType, so a shared catalog of error
+// types can be decoded from a json or yaml file and loaded with LoadErrorTypes().
+type ErrorTypeDef struct {
+	Name     string `json:"name" yaml:"name" bson:"name"`
+	ApiCode  int    `json:"api_code" yaml:"api_code" bson:"api_code"`
+	HttpCode int    `json:"http_code" yaml:"http_code" bson:"http_code"`
+}
+
+/*
+LoadErrorTypes creates a SpanErrorType for each of defs and adds them to
+ErrorTypeCodeIndex, returning the new types in the order they were defined.
+
+Every definition must have a name, and its name and ApiCode must not collide with
+another definition or a type already in ErrorTypeCodeIndex. If any definition is
+invalid, an error is returned and no types are added.
+
+ErrorTypeCodeIndex is not safe for concurrent writes, so error types should be loaded
+during initialization, before errors are decoded.
+*/
+func LoadErrorTypes(defs []ErrorTypeDef) ([]*SpanErrorType, error) {
+	if err := validateErrorTypeDefs(defs); err != nil {
+		return nil, err
+	}
+
+	errorTypes := make([]*SpanErrorType, len(defs))
+	for i, def := range defs {
+		errorTypes[i] = NewSpanErrorType(def.Name, def.ApiCode, def.HttpCode)
+		ErrorTypeCodeIndex[def.ApiCode] = errorTypes[i]
+	}
+
+	return errorTypes, nil
+}
+
+// Checks defs for missing names, and names or codes which collide with each other or
+// with ErrorTypeCodeIndex.
+func validateErrorTypeDefs(defs []ErrorTypeDef) error {
+	codes := make(map[int]string, len(ErrorTypeCodeIndex)+len(defs))
+	names := make(map[string]bool, len(ErrorTypeCodeIndex)+len(defs))
+	for code, errorType := range ErrorTypeCodeIndex {
+		codes[code] = errorType.name
+		names[errorType.name] = true
+	}
+
+	for i, def := range defs {
+		if def.Name == "" {
+			return xerrors.Errorf("error type definition %v has no name", i)
+		}
+		if existing, ok := codes[def.ApiCode]; ok {
+			return xerrors.Errorf(
+				"api code %v of %v is already used by %v", def.ApiCode, def.Name, existing,
+			)
+		}
+		if names[def.Name] {
+			return xerrors.Errorf("error type name %v is already used", def.Name)
+		}
+
+		codes[def.ApiCode] = def.Name
+		names[def.Name] = true
+	}
+
+	return nil
+}
@@ -5,8 +5,10 @@ import (
 	"github.com/illuscio-dev/spantools-go/mimetype"
 	uuid "github.com/satori/go.uuid"
 	"golang.org/x/xerrors"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Returns a span error type definition. Each definition should only need to be declared
@@ -94,6 +96,33 @@ func ErrorFromHeaders(
 		errorMessage, errorData, nil,
 	)
 	spanError.Id = errorID
+	spanError.RetryAfter = parseRetryAfter(headers.Get("Retry-After"))
 
 	return spanError, true, nil
 }
+
+// Parses a Retry-After header value, which may be a number of seconds or an HTTP-date.
+// Returns 0 if the value is blank, malformed, or a date which has passed.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	retryAt, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+
+	wait := time.Until(retryAt)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
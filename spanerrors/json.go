@@ -0,0 +1,72 @@
+package spanerrors
+
+import (
+	"encoding/json"
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/xerrors"
+)
+
+// Stable JSON representation of a SpanError.
+type spanErrorJSON struct {
+	Name     string                 `json:"name"`
+	Code     int                    `json:"code"`
+	HTTPCode int                    `json:"http_code"`
+	Message  string                 `json:"message"`
+	ID       uuid.UUID              `json:"id"`
+	Data     map[string]interface{} `json:"data"`
+}
+
+// MarshalJSON implements json.Marshaler, writing the error as
+// {"name", "code", "http_code", "message", "id", "data"}. The source error and stack
+// are not included, as they may contain information that should not leave the service,
+// and data is written after the filter set on Serialization, if any.
+func (spanError *SpanError) MarshalJSON() ([]byte, error) {
+	if spanError.SpanErrorType == nil {
+		return nil, xerrors.New("cannot marshal SpanError with no SpanErrorType")
+	}
+
+	return json.Marshal(spanErrorJSON{
+		Name:     spanError.name,
+		Code:     spanError.apiCode,
+		HTTPCode: spanError.httpCode,
+		Message:  spanError.Message,
+		ID:       spanError.Id,
+		Data:     Serialization.filterData(spanError.ErrorData),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler for JSON written by MarshalJSON(). The
+// error type is resolved by code through ErrorTypeCodeIndex, so custom error types must
+// be added to that index to be unmarshalled. If the sent http code differs from the
+// indexed type, the type is copied with WithHttpCode().
+func (spanError *SpanError) UnmarshalJSON(data []byte) error {
+	loaded := spanErrorJSON{}
+	err := json.Unmarshal(data, &loaded)
+	if err != nil {
+		return err
+	}
+
+	return loaded.load(spanError, ErrorTypeCodeIndex)
+}
+
+// Loads the JSON representation into spanError, resolving its type through
+// errorTypeCodeIndex.
+func (loaded *spanErrorJSON) load(
+	spanError *SpanError, errorTypeCodeIndex map[int]*SpanErrorType,
+) error {
+	errorType, ok := errorTypeCodeIndex[loaded.Code]
+	if !ok {
+		return xerrors.Errorf("no known error for code %v", loaded.Code)
+	}
+	if errorType.httpCode != loaded.HTTPCode {
+		errorType = errorType.WithHttpCode(loaded.HTTPCode)
+	}
+
+	*spanError = SpanError{
+		SpanErrorType: errorType,
+		Message:       loaded.Message,
+		Id:            loaded.ID,
+		ErrorData:     loaded.Data,
+	}
+	return nil
+}
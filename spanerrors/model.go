@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"github.com/satori/go.uuid"
 	"golang.org/x/xerrors"
+	"math"
 	"runtime/debug"
 	"github.com/illuscio-dev/spantools-go/encoding"
 	"github.com/illuscio-dev/spantools-go/mimetype"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Interface for object that can set header information.
@@ -46,16 +49,7 @@ func (errorType *SpanErrorType) New(
 	errorData map[string]interface{},
 	source error,
 ) *SpanError {
-	spanError := SpanError{
-		SpanErrorType: errorType,
-		Message:       message,
-		Id:            uuid.NewV4(),
-		ErrorData:     errorData,
-		sourceErr:     source,
-		sourceStack:   debug.Stack(),
-		frame:         xerrors.Caller(0),
-	}
-	return &spanError
+	return errorType.newError(message, errorData, source)
 }
 
 /*
@@ -69,10 +63,48 @@ func (errorType *SpanErrorType) Panic(
 	errorData map[string]interface{},
 	source error,
 ) {
-	spanError := errorType.New(message, errorData, source)
+	spanError := errorType.newError(message, errorData, source)
 	panic(spanError)
 }
 
+// Builds a new span error. Must be called directly by the exported function the user
+// called, like New() or Panic(), so the recorded frame and stack start at the user's
+// call site instead of inside this package.
+func (errorType *SpanErrorType) newError(
+	message string,
+	errorData map[string]interface{},
+	source error,
+) *SpanError {
+	spanError := SpanError{
+		SpanErrorType: errorType,
+		Message:       message,
+		Id:            uuid.NewV4(),
+		ErrorData:     errorData,
+		sourceErr:     source,
+		// Skip newError() and the exported function which called it.
+		sourceStack: callerStack(2),
+		frame:       xerrors.Caller(2),
+	}
+	return &spanError
+}
+
+// Returns debug.Stack() with its first skip frames removed, along with the frames of
+// debug.Stack() and callerStack() themselves.
+func callerStack(skip int) []byte {
+	stack := debug.Stack()
+
+	// The stack starts with a goroutine header line, followed by two lines for each
+	// frame: the function, then its file and line.
+	lines := bytes.Split(stack, []byte("\n"))
+	dropped := 2 * (skip + 2)
+	if len(lines) <= 1+dropped {
+		return stack
+	}
+
+	kept := append(lines[:1:1], lines[1+dropped:]...)
+	return bytes.Join(kept, []byte("\n"))
+}
+
 // Unique human-readable name of the error type for the API ecosystem.
 func (errorType *SpanErrorType) Name() string {
 	return errorType.name
@@ -119,6 +151,10 @@ type SpanError struct {
 	// A string / any mapping of data related to the error.
 	ErrorData map[string]interface{}
 
+	// How long the client should wait before retrying, like for an APILimitError. Zero
+	// if not set. Written to the standard Retry-After header by ToHeader().
+	RetryAfter time.Duration
+
 	// If this error was returned because of another error, the original error is stored
 	// here.
 	sourceErr error
@@ -142,6 +178,16 @@ func (spanError *SpanError) Error() string {
 	return spanError.SpanErrorType.Error() + " - " + spanError.Message
 }
 
+// Error() with ": <source error>" appended when the error has a source, for quickly
+// logging the cause. Like LogMessage(), the source error may contain sensitive
+// information that should not be returned to the client.
+func (spanError *SpanError) VerboseError() string {
+	if spanError.sourceErr == nil {
+		return spanError.Error()
+	}
+	return spanError.Error() + ": " + spanError.sourceErr.Error()
+}
+
 // Implements xerrors.Wrapper interface. Part of how errors are being considered for
 // implementation in future GO versions with more traceback support.
 func (spanError *SpanError) Unwrap() error {
@@ -149,9 +195,10 @@ func (spanError *SpanError) Unwrap() error {
 	return spanError.sourceErr
 }
 
-// More verbose error message that includes a debug.Stack() and source error
-// information. This is not part of the Error(), Message, or ErrorData by default since
-// it may contain sensitive information that is not desirable to return to the client.
+// More verbose error message that includes the origin and debug.Stack() of where the
+// error was created, and source error information. This is not part of the Error(),
+// Message, or ErrorData by default since it may contain sensitive information that is
+// not desirable to return to the client.
 func (spanError *SpanError) LogMessage() string {
 	loggerMessage := fmt.Sprint(
 		// print the error
@@ -159,14 +206,62 @@ func (spanError *SpanError) LogMessage() string {
 		spanError.Error(),
 		"\nORIGINAL: ",
 		spanError.sourceErr,
+		"\nORIGIN: ",
+		spanError.origin(),
 		"\nPANIC STACK:\n",
 		string(spanError.sourceStack),
 	)
 	return loggerMessage
 }
 
+// Returns the function, file and line where the error was created, as printed by the
+// error's xerrors.Frame.
+func (spanError *SpanError) origin() string {
+	printer := &framePrinter{}
+	spanError.frame.Format(printer)
+	return strings.TrimSpace(printer.String())
+}
+
+// xerrors.Printer which collects the detailed output of an xerrors.Frame.
+type framePrinter struct {
+	strings.Builder
+}
+
+func (printer *framePrinter) Print(args ...interface{}) {
+	_, _ = fmt.Fprint(printer, args...)
+}
+
+func (printer *framePrinter) Printf(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(printer, format, args...)
+}
+
+func (printer *framePrinter) Detail() bool {
+	return true
+}
+
+// Returns the error's fields as a map for structured loggers, like a logger's
+// WithFields() method. Like LogMessage(), this includes the source error and the
+// debug.Stack() from where the error was created, so it should not be returned to the
+// client.
+func (spanError *SpanError) LogFields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":    spanError.name,
+		"code":    spanError.apiCode,
+		"id":      spanError.Id.String(),
+		"message": spanError.Message,
+		"stack":   string(spanError.sourceStack),
+	}
+
+	if spanError.sourceErr != nil {
+		fields["source"] = spanError.sourceErr.Error()
+	}
+
+	return fields
+}
+
 // Writes error to an object which implements a Set(key string, value string) method
-// like http.Request or http.Response.
+// like http.Request or http.Response. Error data is written after the filter set on
+// Serialization, if any.
 func (spanError *SpanError) ToHeader(
 	setter headerSetter, dataEngine encoding.ContentEngine,
 ) error {
@@ -175,9 +270,14 @@ func (spanError *SpanError) ToHeader(
 	setter.Set("error-message", spanError.Message)
 	setter.Set("error-id", spanError.Id.String())
 
-	if spanError.ErrorData != nil {
+	if spanError.RetryAfter > 0 {
+		seconds := int(math.Ceil(spanError.RetryAfter.Seconds()))
+		setter.Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	if errorData := Serialization.filterData(spanError.ErrorData); errorData != nil {
 		dataBytes := bytes.Buffer{}
-		_, err := dataEngine.Encode(mimetype.JSON, spanError.ErrorData, &dataBytes)
+		_, err := dataEngine.Encode(mimetype.JSON, errorData, &dataBytes)
 		if err != nil {
 			return err
 		}
@@ -186,3 +286,24 @@ func (spanError *SpanError) ToHeader(
 
 	return nil
 }
+
+// Wrap returns a new SpanError of errorType with err as its source error.
+func Wrap(errorType *SpanErrorType, message string, err error) *SpanError {
+	return errorType.newError(message, nil, err)
+}
+
+// FromError converts err to a SpanError at an error boundary, like a route handler
+// returning. If err is or wraps a *SpanError, that SpanError is returned unchanged.
+// Otherwise err is wrapped as an APIError using err's message. A nil err returns nil.
+func FromError(err error) *SpanError {
+	if err == nil {
+		return nil
+	}
+
+	var spanError *SpanError
+	if xerrors.As(err, &spanError) {
+		return spanError
+	}
+
+	return APIError.newError(err.Error(), nil, err)
+}
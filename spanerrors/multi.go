@@ -0,0 +1,124 @@
+package spanerrors
+
+import (
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"golang.org/x/xerrors"
+	"strconv"
+	"strings"
+)
+
+/*
+MultiSpanError holds multiple SpanErrors returned at once, like every failure found
+while validating a request.
+
+As JSON it is written as a list of each error's MarshalJSON() representation. When
+written to headers, the first error is written as normal so clients which only handle a
+single error still receive one, and the full list is written as JSON to the
+"error-list" header.
+*/
+type MultiSpanError struct {
+	Errors []*SpanError
+}
+
+// Returns a MultiSpanError holding errors.
+func NewMultiSpanError(errors ...*SpanError) *MultiSpanError {
+	return &MultiSpanError{Errors: errors}
+}
+
+// Error string to conform to builtin error interface, joining every held error.
+func (multiError *MultiSpanError) Error() string {
+	messages := make([]string, len(multiError.Errors))
+	for i, spanError := range multiError.Errors {
+		messages[i] = spanError.Error()
+	}
+	return strconv.Itoa(len(messages)) + " errors: " + strings.Join(messages, "; ")
+}
+
+// MarshalJSON implements json.Marshaler, writing the held errors as a list.
+func (multiError *MultiSpanError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(multiError.Errors)
+}
+
+// UnmarshalJSON implements json.Unmarshaler for JSON written by MarshalJSON(). Like
+// SpanError.UnmarshalJSON(), error types are resolved through ErrorTypeCodeIndex.
+func (multiError *MultiSpanError) UnmarshalJSON(data []byte) error {
+	return multiError.load(data, ErrorTypeCodeIndex)
+}
+
+// Loads a JSON list of errors, resolving their types through errorTypeCodeIndex.
+func (multiError *MultiSpanError) load(
+	data []byte, errorTypeCodeIndex map[int]*SpanErrorType,
+) error {
+	loaded := make([]spanErrorJSON, 0)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	errors := make([]*SpanError, len(loaded))
+	for i := range loaded {
+		errors[i] = &SpanError{}
+		if err := loaded[i].load(errors[i], errorTypeCodeIndex); err != nil {
+			return xerrors.Errorf("error %v: %w", i, err)
+		}
+	}
+
+	multiError.Errors = errors
+	return nil
+}
+
+// Writes the first error to setter with SpanError.ToHeader(), and the full list as JSON
+// to the "error-list" header.
+func (multiError *MultiSpanError) ToHeader(
+	setter headerSetter, dataEngine encoding.ContentEngine,
+) error {
+	if len(multiError.Errors) == 0 {
+		return xerrors.New("cannot write MultiSpanError with no errors")
+	}
+
+	errorList, err := multiError.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	if err := multiError.Errors[0].ToHeader(setter, dataEngine); err != nil {
+		return err
+	}
+	setter.Set("error-list", string(errorList))
+
+	return nil
+}
+
+/*
+MultiErrorFromHeaders loads the errors written by MultiSpanError.ToHeader(). Return
+values follow ErrorFromHeaders(). If the headers hold a single error without an
+"error-list", it is loaded with ErrorFromHeaders() and returned as the only error of the
+MultiSpanError.
+*/
+func MultiErrorFromHeaders(
+	headers headerFetcher,
+	dataEngine encoding.ContentEngine,
+	errorTypeCodeIndex map[int]*SpanErrorType,
+) (multiError *MultiSpanError, hasError bool, err error) {
+	errorList := headers.Get("error-list")
+	if errorList == "" {
+		spanError, hasError, err := ErrorFromHeaders(
+			headers, dataEngine, errorTypeCodeIndex,
+		)
+		if err != nil {
+			return nil, hasError, err
+		}
+		return NewMultiSpanError(spanError), true, nil
+	}
+
+	if errorTypeCodeIndex == nil {
+		return nil, true, xerrors.New("no error index provided")
+	}
+
+	multiError = &MultiSpanError{}
+	if err := multiError.load([]byte(errorList), errorTypeCodeIndex); err != nil {
+		return nil, true, xerrors.Errorf("error-list could not be loaded: %w", err)
+	}
+
+	return multiError, true, nil
+}
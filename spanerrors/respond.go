@@ -0,0 +1,106 @@
+package spanerrors
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"net/http"
+	"strings"
+)
+
+// Content engine which can pick a response mimetype from an Accept header, like
+// *encoding.SpanEngine.
+type acceptNegotiator interface {
+	encoding.ContentEngine
+	NegotiateAccept(entries []mimetype.AcceptEntry) (mimetype.MimeType, bool)
+	EncoderMimeTypes() []mimetype.MimeType
+}
+
+// Returned when no mimetype the client accepts can be encoded.
+var notAcceptableError = RequestValidationError.WithHttpCode(http.StatusNotAcceptable)
+
+// RespondTo writes content to writer with status, encoded in the mimetype the
+// request's Accept header prefers. The header is parsed by mimetype.FromAcceptHeader(),
+// which caches recently seen headers, and the mimetype is picked with
+// engine.NegotiateAccept(), so quality values and wildcards are honored, and json is
+// used for the default engine when Accept is absent or "*/*". The written mimetype is
+// returned and set as the Content-Type. "Accept" is added to the Vary header, so
+// caches do not serve one client the representation negotiated for another.
+//
+// Content is encoded before anything is written, so if encoding fails nothing is
+// written and the error is returned for the caller to respond with.
+//
+// If none of the accepted mimetypes can be encoded, a 406 RequestValidationError
+// listing the supported mimetypes in its "supported" data is written as a json body and
+// to the headers with ToHeader(), and is also returned.
+func RespondTo(
+	writer http.ResponseWriter,
+	request *http.Request,
+	engine acceptNegotiator,
+	status int,
+	content interface{},
+) (mimetype.MimeType, error) {
+	// Set for every response, since even a 406 depends on the Accept header.
+	addVary(writer.Header(), "Accept")
+
+	mimeType, ok := engine.NegotiateAccept(mimetype.FromAcceptHeader(request.Header))
+	if !ok {
+		return mimetype.JSON, respondNotAcceptable(writer, request, engine)
+	}
+
+	body := &bytes.Buffer{}
+	if _, err := engine.Encode(mimeType, content, body); err != nil {
+		return mimeType, err
+	}
+
+	writer.Header().Set("Content-Type", string(mimeType))
+	writer.WriteHeader(status)
+	_, err := writer.Write(body.Bytes())
+	return mimeType, err
+}
+
+// Adds field to the Vary header, unless it or "*" is already listed.
+func addVary(header http.Header, field string) {
+	for _, value := range header["Vary"] {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, field) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", field)
+}
+
+// Writes a 406 error listing the mimetypes engine can encode, and returns it.
+func respondNotAcceptable(
+	writer http.ResponseWriter, request *http.Request, engine acceptNegotiator,
+) error {
+	supported := make([]string, 0)
+	for _, mimeType := range engine.EncoderMimeTypes() {
+		supported = append(supported, string(mimeType))
+	}
+
+	spanError := notAcceptableError.New(
+		"no acceptable mimetype for '"+request.Header.Get("Accept")+"', supported: "+
+			strings.Join(supported, ", "),
+		map[string]interface{}{"supported": supported},
+		nil,
+	)
+
+	body, err := json.Marshal(spanError)
+	if err != nil {
+		return err
+	}
+	if err := spanError.ToHeader(writer.Header(), engine); err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", string(mimetype.JSON))
+	writer.WriteHeader(spanError.HttpCode())
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	return spanError
+}
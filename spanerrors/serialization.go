@@ -0,0 +1,71 @@
+package spanerrors
+
+import (
+	"sync"
+)
+
+/*
+SerializationConfig holds options for how SpanErrors are written for clients by
+SpanError.ToHeader() and SpanError.MarshalJSON(). The package-wide config is
+Serialization.
+
+SerializationConfig is safe for concurrent use, though options are usually set once
+at service startup.
+*/
+type SerializationConfig struct {
+	// Applied to error data before it is written. nil writes data as-is.
+	dataFilter func(data map[string]interface{}) map[string]interface{}
+	// Guards dataFilter.
+	lock sync.RWMutex
+}
+
+/*
+SetErrorDataFilter sets a function applied to the ErrorData of every SpanError before
+it is written, so internal keys can be stripped or renamed in one place rather than
+wherever errors are created. The filter is passed a copy of the error data, which it
+may change and return, and is not called for errors with no data. If it returns nil, the
+error is written with no data.
+
+Errors loaded back from headers or JSON hold the filtered data. Pass nil to write error
+data as-is, which is the default.
+*/
+func (config *SerializationConfig) SetErrorDataFilter(
+	filter func(data map[string]interface{}) map[string]interface{},
+) {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	config.dataFilter = filter
+}
+
+// ErrorDataFilter returns the filter set through SetErrorDataFilter(), or nil if there
+// is none.
+func (config *SerializationConfig) ErrorDataFilter() func(
+	data map[string]interface{},
+) map[string]interface{} {
+	config.lock.RLock()
+	defer config.lock.RUnlock()
+
+	return config.dataFilter
+}
+
+// Returns errorData as it should be written, passed through the data filter if there
+// is one. errorData itself is never changed.
+func (config *SerializationConfig) filterData(
+	errorData map[string]interface{},
+) map[string]interface{} {
+	filter := config.ErrorDataFilter()
+	if filter == nil || errorData == nil {
+		return errorData
+	}
+
+	copied := make(map[string]interface{}, len(errorData))
+	for key, value := range errorData {
+		copied[key] = value
+	}
+	return filter(copied)
+}
+
+// Serialization is the config applied whenever a SpanError is written to headers or
+// JSON.
+var Serialization = &SerializationConfig{}
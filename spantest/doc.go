@@ -0,0 +1,2 @@
+// Test helpers for packages which use the encoding package with their own types.
+package spantest
@@ -0,0 +1,49 @@
+package spantest
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+/*
+AssertRoundTrip encodes value as mimeType with engine, decodes the result into a fresh
+value of the same type, and asserts the decoded value equals the original. Pointer
+values are compared by what they point to.
+
+Failures are reported on test. Returns true if the round trip succeeded.
+*/
+func AssertRoundTrip(
+	test testing.TB,
+	engine encoding.ContentEngine,
+	mimeType mimetype.MimeType,
+	value interface{},
+) bool {
+	test.Helper()
+
+	buffer := &bytes.Buffer{}
+	if _, err := engine.Encode(mimeType, value, buffer); err != nil {
+		return assert.Fail(test, "error encoding value", "%v: %v", mimeType, err)
+	}
+
+	valueType := reflect.TypeOf(value)
+	isPointer := valueType.Kind() == reflect.Ptr
+	if isPointer {
+		valueType = valueType.Elem()
+	}
+
+	receiver := reflect.New(valueType)
+	if _, err := engine.Decode(mimeType, receiver.Interface(), buffer); err != nil {
+		return assert.Fail(test, "error decoding value", "%v: %v", mimeType, err)
+	}
+
+	loaded := receiver.Interface()
+	if !isPointer {
+		loaded = receiver.Elem().Interface()
+	}
+
+	return assert.Equal(test, value, loaded, "%v round trip", mimeType)
+}
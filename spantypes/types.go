@@ -52,6 +52,12 @@ func (data BinData) MarshalBSONValue() (bsontype.Type, []byte, error) {
 func (data *BinData) UnmarshalBSONValue(
 	valueType bsontype.Type, incomingData []byte,
 ) error {
+	if valueType != bsontype.Binary {
+		return xerrors.Errorf(
+			"spantools.BinData cannot be decoded from bson type %v", valueType,
+		)
+	}
+
 	subType, rawData, _, ok := bsoncore.ReadBinary(incomingData)
 	if !ok {
 		return xerrors.New("unknown error decoding spantools.BinData")
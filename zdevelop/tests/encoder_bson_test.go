@@ -8,16 +8,20 @@ import (
 	"bytes"
 	"github.com/illuscio-dev/spantools-go/encoding"
 	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spantest"
 	"github.com/illuscio-dev/spantools-go/spantypes"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
 	"golang.org/x/xerrors"
 	"io"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestBSONListRoundTrip(test *testing.T) {
@@ -177,6 +181,66 @@ func TestUUIDToBSON(test *testing.T) {
 	assert.Equal(data.Data, loaded.Data)
 }
 
+func TestUUIDFromBSONSubtype4(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	uuidValue := uuid.NewV4()
+	content, err := bson.Marshal(
+		bson.M{"data": primitive.Binary{Subtype: 0x4, Data: uuidValue.Bytes()}},
+	)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	loaded := struct {
+		Data uuid.UUID `bson:"data"`
+	}{}
+	_, err = engine.Decode(mimetype.BSON, &loaded, bytes.NewReader(content))
+	assert.Nil(err)
+	assert.Equal(uuidValue, loaded.Data)
+}
+
+func TestUUIDBsonSubtype(test *testing.T) {
+	type Receiver struct {
+		Data uuid.UUID `bson:"data"`
+	}
+
+	testCases := []struct {
+		Name    string
+		Set     bool
+		Subtype byte
+	}{
+		{Name: "Default", Set: false, Subtype: 0x3},
+		{Name: "RFC4122", Set: true, Subtype: 0x4},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+			if thisCase.Set {
+				engine.SetUUIDBsonSubtype(thisCase.Subtype)
+			}
+			assert.Equal(thisCase.Subtype, engine.UUIDBsonSubtype())
+
+			data := Receiver{Data: uuid.NewV4()}
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(mimetype.BSON, data, buffer)
+			assert.Nil(err)
+
+			subtype, bytesUUID := bson.Raw(buffer.Bytes()).Lookup("data").Binary()
+			assert.Equal(thisCase.Subtype, subtype)
+			assert.Equal(data.Data.Bytes(), bytesUUID)
+
+			loaded := Receiver{}
+			_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+			assert.Nil(err)
+			assert.Equal(data, loaded)
+		})
+	}
+}
+
 type BinReceiver struct {
 	Data spantypes.BinData
 }
@@ -290,10 +354,9 @@ func TestErrorDecodingUUID(test *testing.T) {
 	receiver := &TestData{}
 	mimeType, err = engine.Decode(mimetype.BSON, receiver, buffer)
 	assert.Zero(mimeType)
-	assert.EqualError(
-		err,
-		"decode err: uuid: UUID must be exactly 16 bytes long, got 0 bytes",
-	)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "decode err: could not read bson uuid:")
+	}
 }
 
 func TestErrorMarshall(test *testing.T) {
@@ -432,3 +495,646 @@ func TestBSONListEncodeErrorWritingSeparator(test *testing.T) {
 		err, ": : ",
 	)
 }
+
+func TestBSONWrapScalarsRoundTrip(test *testing.T) {
+	engine := createSpanEngine(test)
+	engine.SetBsonWrapScalars(true)
+
+	assert.True(test, engine.BsonWrapScalars())
+
+	testInt := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+		buffer := &bytes.Buffer{}
+
+		mimeType, err := engine.Encode(mimetype.BSON, 42, buffer)
+		if err != nil {
+			subTest.Error(err)
+		}
+		assert.Equal(mimetype.BSON, mimeType)
+
+		_, err = bson.Raw(buffer.Bytes()).LookupErr(encoding.BsonScalarWrapKey)
+		assert.Nil(err)
+
+		var loaded int
+		mimeType, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+		if err != nil {
+			subTest.Error(err)
+		}
+		assert.Equal(mimetype.BSON, mimeType)
+		assert.Equal(42, loaded)
+	}
+
+	testString := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+		buffer := &bytes.Buffer{}
+
+		mimeType, err := engine.Encode(mimetype.BSON, "I am a string", buffer)
+		if err != nil {
+			subTest.Error(err)
+		}
+		assert.Equal(mimetype.BSON, mimeType)
+
+		var loaded string
+		mimeType, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+		if err != nil {
+			subTest.Error(err)
+		}
+		assert.Equal(mimetype.BSON, mimeType)
+		assert.Equal("I am a string", loaded)
+	}
+
+	test.Run("Wrap Int", testInt)
+	test.Run("Wrap String", testString)
+}
+
+func TestBSONWrapScalarsDocumentsUnchanged(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetBsonWrapScalars(true)
+
+	data := &Name{
+		First: "Harry",
+		Last:  "Potter",
+	}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	_, err = bson.Raw(buffer.Bytes()).LookupErr(encoding.BsonScalarWrapKey)
+	assert.NotNil(err)
+
+	loaded := &Name{}
+	_, err = engine.Decode(mimetype.BSON, loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(data, loaded)
+}
+
+func TestBSONListHeterogeneousToInterface(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []interface{}{
+		&Name{
+			First: "Harry",
+			Last:  "Potter",
+		},
+		bson.M{
+			"pet":   "Hedwig",
+			"owner": bson.M{"first": "Harry"},
+		},
+	}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, &data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	loaded := make([]interface{}, 0)
+	mimeType, err := engine.Decode(mimetype.BSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+
+	assert.Len(loaded, 2)
+	assert.IsType(bson.M{}, loaded[0])
+	assert.IsType(bson.M{}, loaded[1])
+
+	assert.Equal(bson.M{"first": "Harry", "last": "Potter"}, loaded[0])
+	assert.Equal("Hedwig", loaded[1].(bson.M)["pet"])
+	assert.Equal(bson.M{"first": "Harry"}, loaded[1].(bson.M)["owner"])
+}
+
+func TestBSONTopLevelValueMarshalerError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := spantypes.BinData("Test Data.")
+	buffer := &bytes.Buffer{}
+
+	mimeType, err := engine.Encode(mimetype.BSON, data, buffer)
+	assert.Zero(mimeType)
+	assert.EqualError(
+		err,
+		"encode err: spantypes.BinData marshals to a bson value, not a document, "+
+			"and cannot be encoded at the top level: wrap it in a struct or use "+
+			"SetBsonWrapScalars(true)",
+	)
+	assert.Zero(buffer.Len())
+}
+
+func TestBSONTopLevelValueMarshalerWrapped(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetBsonWrapScalars(true)
+
+	data := spantypes.BinData("Test Data.")
+	buffer := &bytes.Buffer{}
+
+	mimeType, err := engine.Encode(mimetype.BSON, &data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+
+	subtype, binData := bson.Raw(buffer.Bytes()).Lookup(
+		encoding.BsonScalarWrapKey,
+	).Binary()
+	assert.Equal(byte(0x0), subtype)
+	assert.Equal([]byte(data), binData)
+
+	loaded := spantypes.BinData{}
+	mimeType, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal(data, loaded)
+}
+
+func TestEncodeBSONWithIDInjected(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	data := Name{First: "Harry", Last: "Potter"}
+	buffer := &bytes.Buffer{}
+
+	err := engine.EncodeBSONWithID(data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	document := bson.Raw(buffer.Bytes())
+	assert.Nil(document.Validate())
+
+	idValue, err := document.LookupErr("_id")
+	assert.Nil(err)
+	assert.Equal(bsontype.ObjectID, idValue.Type)
+	assert.False(idValue.ObjectID().IsZero())
+
+	loaded := Name{}
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(data, loaded)
+}
+
+func TestEncodeBSONWithIDExisting(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	existingID := primitive.NewObjectID()
+	data := bson.M{"_id": existingID, "first": "Harry"}
+	buffer := &bytes.Buffer{}
+
+	err := engine.EncodeBSONWithID(data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	document := bson.Raw(buffer.Bytes())
+	assert.Equal(existingID, document.Lookup("_id").ObjectID())
+	assert.Equal("Harry", document.Lookup("first").StringValue())
+}
+
+func TestEncodeBSONWithIDListError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	data := []Name{{First: "Harry"}, {First: "Hermione"}}
+	buffer := &bytes.Buffer{}
+
+	err := engine.EncodeBSONWithID(data, buffer)
+	if assert.Error(err) {
+		assert.Contains(
+			err.Error(), "encode err: content is not a single bson document",
+		)
+	}
+	assert.Zero(buffer.Len())
+}
+
+// Encodes names to a bson list for DecodeManyInto tests.
+func encodeNameList(tb testing.TB, engine encoding.ContentEngine, names []Name) []byte {
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, names, buffer)
+	if err != nil {
+		tb.Error(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestBSONDecodeManyInto(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Existing int
+		Decoded  int
+	}{
+		{Name: "Append Extras", Existing: 2, Decoded: 3},
+		{Name: "Truncate", Existing: 4, Decoded: 2},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			names := make([]Name, thisCase.Decoded)
+			for i := range names {
+				names[i] = Name{First: "Harry", Last: strconv.Itoa(i)}
+			}
+			content := encodeNameList(subTest, engine, names)
+
+			// Pooled elements have stale data, which must not survive the decode.
+			pooled := make([]Name, thisCase.Existing, 8)
+			for i := range pooled {
+				pooled[i] = Name{First: "Stale", Last: "Stale"}
+			}
+			firstElement := &pooled[0]
+
+			_, err := engine.DecodeManyInto(
+				mimetype.BSON, &pooled, bytes.NewReader(content),
+			)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			assert.Equal(names, pooled)
+			assert.Same(firstElement, &pooled[0])
+		})
+	}
+}
+
+func TestDecodeManyIntoNotSlice(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	mimeType, err := engine.DecodeManyInto(
+		mimetype.BSON, &Name{}, bytes.NewReader(nil),
+	)
+	assert.Zero(mimeType)
+	assert.EqualError(err, "slice receiver must be a pointer to a slice")
+}
+
+func BenchmarkBSONDecodeList(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	content := encodeNameList(bench, engine, make([]Name, 100))
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		names := make([]Name, 0)
+		_, _ = engine.Decode(mimetype.BSON, &names, bytes.NewReader(content))
+	}
+}
+
+func BenchmarkBSONDecodeManyInto(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	content := encodeNameList(bench, engine, make([]Name, 100))
+	names := make([]Name, 100)
+
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		_, _ = engine.DecodeManyInto(mimetype.BSON, &names, bytes.NewReader(content))
+	}
+}
+
+func TestBSONDecodeRawReceiver(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, Name{First: "Harry", Last: "Potter"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	expected := append([]byte{}, buffer.Bytes()...)
+
+	loaded := bson.Raw{}
+	mimeType, err := engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal(bson.Raw(expected), loaded)
+	assert.Equal("Harry", loaded.Lookup("first").StringValue())
+}
+
+func TestBSONDecodeRawField(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	type Envelope struct {
+		Kind    string
+		Payload bson.Raw
+	}
+
+	data := bson.M{"kind": "name", "payload": bson.M{"first": "Hermione"}}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	loaded := Envelope{}
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal("name", loaded.Kind)
+	assert.Equal("Hermione", loaded.Payload.Lookup("first").StringValue())
+}
+
+func TestBSONWrapLists(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.False(engine.BsonWrapLists())
+	engine.SetBsonWrapLists(true)
+	assert.True(engine.BsonWrapLists())
+
+	data := []Name{
+		{First: "Harry", Last: "Potter"},
+		{First: "Hermione", Last: "Granger"},
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.BSON, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+
+	// The payload is a single document holding the list.
+	document := bson.Raw(buffer.Bytes())
+	assert.Nil(document.Validate())
+	items, err := document.LookupErr(encoding.BsonListWrapKey)
+	assert.Nil(err)
+	assert.Equal(bsontype.Array, items.Type)
+
+	var loaded []Name
+	mimeType, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal(data, loaded)
+}
+
+func TestBSONWrapListsErrors(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetBsonWrapLists(true)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, Name{First: "Harry"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	var loaded []Name
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "error unwrapping bson list from 'items'")
+	}
+
+	engine.SetMaxListElements(1)
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.BSON, []Name{{}, {}}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.EqualError(err, "decode err: list exceeds maximum of 1 elements")
+}
+
+func TestLenientUUID(test *testing.T) {
+	type TestData struct {
+		ID   uuid.UUID
+		Name string
+	}
+
+	bsonContent, err := bson.Marshal(bson.M{
+		"id":   primitive.Binary{Subtype: 0x3, Data: []byte{0x1, 0x2, 0x3}},
+		"name": "Harry",
+	})
+	if err != nil {
+		test.Error(err)
+	}
+
+	testCases := []struct {
+		Name     string
+		MimeType mimetype.MimeType
+		Content  []byte
+	}{
+		{Name: "BSON", MimeType: mimetype.BSON, Content: bsonContent},
+		{
+			Name:     "JSON",
+			MimeType: mimetype.JSON,
+			Content:  []byte(`{"ID": "not-a-uuid", "Name": "Harry"}`),
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			receiver := &TestData{}
+			_, err := engine.Decode(
+				thisCase.MimeType, receiver, bytes.NewReader(thisCase.Content),
+			)
+			assert.Error(err)
+
+			records := make([]LogRecord, 0)
+			engine.SetLogger(func(level string, msg string, keyValues ...interface{}) {
+				records = append(records, LogRecord{level, msg, keyValues})
+			})
+
+			assert.False(engine.LenientUUID())
+			engine.SetLenientUUID(true)
+			assert.True(engine.LenientUUID())
+
+			receiver = &TestData{ID: uuid.NewV4()}
+			_, err = engine.Decode(
+				thisCase.MimeType, receiver, bytes.NewReader(thisCase.Content),
+			)
+			assert.Nil(err)
+			assert.Equal(uuid.Nil, receiver.ID)
+			assert.Equal("Harry", receiver.Name)
+
+			if assert.Len(records, 1) {
+				assert.Equal(encoding.LogLevelWarn, records[0].Level)
+				assert.Equal(
+					"substituting nil uuid for malformed uuid", records[0].Msg,
+				)
+			}
+		})
+	}
+}
+
+func TestEncodeBSONOrdered(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := bson.M{
+		"validator": "schema",
+		"_id":       "wizard-1",
+		"name":      "Harry",
+		"house":     "Gryffindor",
+	}
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeBSONOrdered(content, []string{"_id", "name", "house"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	document := bson.Raw(buffer.Bytes())
+	elements, err := document.Elements()
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	keys := make([]string, 0)
+	for _, element := range elements {
+		keys = append(keys, element.Key())
+	}
+	assert.Equal([]string{"_id", "name", "house", "validator"}, keys)
+	assert.Equal("Harry", document.Lookup("name").StringValue())
+
+	loaded := bson.M{}
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(content, loaded)
+}
+
+func TestBSONDuration(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	spell := Spell{Name: "Protego", Duration: 90 * time.Minute}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, spell, buffer)
+	assert.Nil(err)
+
+	// Durations stay nanosecond counts in bson so they can be queried.
+	rawDuration := bson.Raw(buffer.Bytes()).Lookup("duration")
+	assert.Equal(bsontype.Int64, rawDuration.Type)
+
+	var nanos int64
+	assert.Nil(rawDuration.Unmarshal(&nanos))
+	assert.Equal(int64(90*time.Minute), nanos)
+
+	assert.True(spantest.AssertRoundTrip(test, engine, mimetype.BSON, spell))
+}
+
+type HouseName string
+
+func TestBSONNamedStringMapKeys(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	points := map[HouseName]int{"Gryffindor": 482, "Slytherin": 472}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, points, buffer)
+	assert.Nil(err)
+
+	loaded := make(map[HouseName]int)
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(points, loaded)
+}
+
+func TestBSONNonStringMapKeysError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, map[int]string{1: "Harry"}, buffer)
+	assert.Error(err)
+
+	_, err = engine.Encode(mimetype.BSON, map[string]string{"1": "Harry"}, buffer)
+	assert.Nil(err)
+
+	loaded := make(map[int]string)
+	_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+	assert.Error(err)
+}
+
+func TestBSONTimeLayout(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	delivered := time.Date(1991, 7, 31, 12, 30, 15, 123456789, time.UTC)
+	post := OwlPost{Sender: "Hagrid", Delivered: delivered}
+
+	// Times are datetimes by default, and with epoch millis.
+	for _, layout := range []string{"", encoding.TimeLayoutEpochMillis} {
+		engine.SetTimeLayout(layout)
+
+		buffer := &bytes.Buffer{}
+		_, err := engine.Encode(mimetype.BSON, post, buffer)
+		assert.Nil(err)
+
+		rawDelivered := bson.Raw(buffer.Bytes()).Lookup("delivered")
+		assert.Equal(bsontype.DateTime, rawDelivered.Type)
+		assert.Equal(int64(680963415123), rawDelivered.DateTime())
+
+		loaded := OwlPost{}
+		_, err = engine.Decode(mimetype.BSON, &loaded, buffer)
+		assert.Nil(err)
+		assert.Equal(delivered.Truncate(time.Millisecond), loaded.Delivered)
+	}
+
+	// String layouts are written as strings, like in json.
+	engine.SetTimeLayout(time.RFC3339Nano)
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.BSON, post, buffer)
+	assert.Nil(err)
+
+	rawDelivered := bson.Raw(buffer.Bytes()).Lookup("delivered")
+	assert.Equal(bsontype.String, rawDelivered.Type)
+	assert.Equal("1991-07-31T12:30:15.123456789Z", rawDelivered.StringValue())
+
+	assert.True(spantest.AssertRoundTrip(test, engine, mimetype.BSON, post))
+}
+
+func TestBSONTimeDecode(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetTimeLayout(time.RFC1123)
+
+	expected := time.Date(1991, 7, 31, 12, 30, 15, 0, time.UTC)
+
+	documents := []bson.M{
+		{"delivered": primitive.DateTime(680963415000)},
+		{"delivered": int64(680963415000)},
+		{"delivered": "Wed, 31 Jul 1991 12:30:15 UTC"},
+	}
+
+	for _, document := range documents {
+		content, err := bson.Marshal(document)
+		assert.Nil(err)
+
+		loaded := OwlPost{}
+		_, err = engine.Decode(mimetype.BSON, &loaded, bytes.NewReader(content))
+		assert.Nil(err)
+		assert.True(expected.Equal(loaded.Delivered))
+	}
+
+	content, err := bson.Marshal(bson.M{"delivered": "1991-07-31"})
+	assert.Nil(err)
+
+	_, err = engine.Decode(mimetype.BSON, &OwlPost{}, bytes.NewReader(content))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), `error parsing time "1991-07-31"`)
+	}
+}
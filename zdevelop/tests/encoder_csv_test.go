@@ -0,0 +1,112 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"fmt"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type CSVWizard struct {
+	Name    string `csv:"name"`
+	House   string
+	Year    int    `csv:"school_year"`
+	Prefect bool   `csv:"prefect"`
+	Notes   string `csv:"-"`
+}
+
+func TestCSVStreamRows(test *testing.T) {
+	assert := assert.New(test)
+
+	builder := &strings.Builder{}
+	builder.WriteString("name,HOUSE,school_year,prefect,extra\n")
+
+	rowCount := 10000
+	for i := 0; i < rowCount; i++ {
+		_, _ = fmt.Fprintf(
+			builder, "\"Wizard, %v\",\"Gryff\nindor\",%v,%v,ignored\n", i, i, i%2 == 0,
+		)
+	}
+
+	calls := 0
+	err := encoding.DecodeCSVStream(
+		strings.NewReader(builder.String()),
+		CSVWizard{},
+		func(row interface{}) error {
+			wizard := row.(*CSVWizard)
+			assert.Equal(fmt.Sprintf("Wizard, %v", calls), wizard.Name)
+			assert.Equal("Gryff\nindor", wizard.House)
+			assert.Equal(calls, wizard.Year)
+			assert.Equal(calls%2 == 0, wizard.Prefect)
+			calls++
+			return nil
+		},
+	)
+
+	assert.Nil(err)
+	assert.Equal(rowCount, calls)
+}
+
+func TestCSVStreamCallbackError(test *testing.T) {
+	assert := assert.New(test)
+
+	content := "name\nHarry\nHermione\n"
+
+	calls := 0
+	err := encoding.DecodeCSVStream(
+		strings.NewReader(content),
+		&CSVWizard{},
+		func(row interface{}) error {
+			calls++
+			return fmt.Errorf("stop")
+		},
+	)
+
+	assert.EqualError(err, "stop")
+	assert.Equal(1, calls)
+}
+
+func TestCSVStreamErrors(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		Example  interface{}
+		ErrorMsg string
+	}{
+		{
+			Name:     "BadInt",
+			Content:  "name,school_year\nHarry,first\n",
+			Example:  CSVWizard{},
+			ErrorMsg: "error decoding csv row 1: column 1: strconv.ParseInt",
+		},
+		{
+			Name:     "RaggedRow",
+			Content:  "name,school_year\nHarry,1\nRon\n",
+			Example:  CSVWizard{},
+			ErrorMsg: "error reading csv:",
+		},
+		{
+			Name:     "NotStruct",
+			Content:  "name\nHarry\n",
+			Example:  "not a struct",
+			ErrorMsg: "csv row example must be a struct or struct pointer",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			err := encoding.DecodeCSVStream(
+				strings.NewReader(thisCase.Content),
+				thisCase.Example,
+				func(row interface{}) error { return nil },
+			)
+			if assert.Error(subTest, err) {
+				assert.Contains(subTest, err.Error(), thisCase.ErrorMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type FormWizard struct {
+	Name    string `form:"name"`
+	House   string
+	Year    int       `form:"school_year"`
+	Prefect bool      `form:"prefect"`
+	Height  float64   `form:"height"`
+	ID      uuid.UUID `form:"id"`
+	Notes   string    `form:"-"`
+}
+
+func TestFormRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	wizard := FormWizard{
+		Name:    "Harry Potter",
+		House:   "Gryffindor",
+		Year:    5,
+		Prefect: false,
+		Height:  1.75,
+		ID:      uuid.NewV4(),
+		Notes:   "not sent",
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.FORM, &wizard, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.FORM, mimeType)
+
+	values, err := url.ParseQuery(buffer.String())
+	assert.Nil(err)
+	assert.Equal("Harry Potter", values.Get("name"))
+	assert.Equal("Gryffindor", values.Get("House"))
+	assert.Equal("5", values.Get("school_year"))
+	assert.Equal("false", values.Get("prefect"))
+	assert.Equal("1.75", values.Get("height"))
+	assert.Equal(wizard.ID.String(), values.Get("id"))
+	assert.NotContains(values, "Notes")
+
+	loaded := FormWizard{}
+	mimeType, err = engine.Decode(mimetype.FORM, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.FORM, mimeType)
+
+	wizard.Notes = ""
+	assert.Equal(wizard, loaded)
+}
+
+func TestFormDecodeStruct(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "name=Hermione&house=Gryffindor&school_year=5&prefect=true&extra=1" +
+		"&name=ignored"
+
+	loaded := FormWizard{}
+	_, err := engine.Decode(mimetype.FORM, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal(
+		FormWizard{Name: "Hermione", House: "Gryffindor", Year: 5, Prefect: true},
+		loaded,
+	)
+}
+
+func TestFormMapRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := map[string]string{"first": "Harry", "last": "Potter & Co"}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.FORM, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal("first=Harry&last=Potter+%26+Co", buffer.String())
+
+	loaded := make(map[string]string)
+	_, err = engine.Decode(mimetype.FORM, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(data, loaded)
+}
+
+type FormNested struct {
+	Name   string
+	Houses []string
+}
+
+func TestFormErrors(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Decode   bool
+		Content  string
+		Value    interface{}
+		ErrorMsg string
+	}{
+		{
+			Name:     "EncodeSlice",
+			Value:    FormNested{Houses: []string{"Gryffindor"}},
+			ErrorMsg: "form field Houses: unsupported field type []string",
+		},
+		{
+			Name:     "EncodeNotStruct",
+			Value:    []string{"Gryffindor"},
+			ErrorMsg: "form content must be a struct or map[string]string",
+		},
+		{
+			Name:     "DecodeSlice",
+			Decode:   true,
+			Content:  "houses=Gryffindor",
+			Value:    &FormNested{},
+			ErrorMsg: "form field houses: unsupported field type []string",
+		},
+		{
+			Name:     "DecodeBadInt",
+			Decode:   true,
+			Content:  "school_year=fifth",
+			Value:    &FormWizard{},
+			ErrorMsg: "form field school_year: strconv.ParseInt",
+		},
+		{
+			Name:     "DecodeNotStruct",
+			Decode:   true,
+			Content:  "name=Harry",
+			Value:    new(string),
+			ErrorMsg: "form content receiver must be a struct pointer",
+		},
+		{
+			Name:     "DecodeBadEscape",
+			Decode:   true,
+			Content:  "name=%zz",
+			Value:    &FormWizard{},
+			ErrorMsg: "invalid URL escape",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			engine := createEngine(subTest)
+
+			var err error
+			if thisCase.Decode {
+				_, err = engine.Decode(
+					mimetype.FORM, thisCase.Value, strings.NewReader(thisCase.Content),
+				)
+			} else {
+				_, err = engine.Encode(mimetype.FORM, thisCase.Value, &bytes.Buffer{})
+			}
+
+			if assert.Error(subTest, err) {
+				assert.Contains(subTest, err.Error(), thisCase.ErrorMsg)
+			}
+		})
+	}
+}
+
+func TestFormNotSniffed(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	loaded := FormWizard{}
+	_, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader("name=Harry&school_year=5"),
+	)
+	if assert.Error(err) {
+		assert.NotContains(err.Error(), string(mimetype.FORM))
+	}
+}
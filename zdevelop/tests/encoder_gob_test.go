@@ -0,0 +1,124 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGobRegisteredByDefault(test *testing.T) {
+	engine := createEngine(test)
+	assert.True(test, engine.Handles(mimetype.GOB))
+}
+
+func TestFromGob(test *testing.T) {
+	stringValues := []string{
+		"gob",
+		"GOB",
+		"x-gob",
+		"application/gob",
+		"application/x-gob",
+		"application/X-GOB",
+	}
+
+	testFromString := func(subTest *testing.T) {
+		ParameterizeFromString(test, stringValues, mimetype.GOB)
+	}
+	testFromHeader := func(subTest *testing.T) {
+		ParameterizeFromHeader(test, stringValues, mimetype.GOB)
+	}
+
+	test.Run("GOB From String", testFromString)
+	test.Run("GOB From Header", testFromHeader)
+}
+
+func TestGobRoundTrip(test *testing.T) {
+	RoundTripName(test, mimetype.GOB, mimetype.GOB)
+}
+
+func TestGobListRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{
+		{
+			First: "Harry",
+			Last:  "Potter",
+		},
+		{
+			First: "Ron",
+			Last:  "Weasley",
+		},
+	}
+
+	buffer := &bytes.Buffer{}
+
+	mimeType, err := engine.Encode(mimetype.GOB, &data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.GOB, mimeType)
+
+	loaded := make([]Name, 0)
+	mimeType, err = engine.Decode(mimetype.GOB, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.GOB, mimeType)
+	assert.Equal(data, loaded)
+}
+
+type GobPet struct {
+	Name string
+}
+
+type GobRegisteredPet struct {
+	Name string
+}
+
+type GobOwner struct {
+	Pet interface{}
+}
+
+func TestGobRegisteredInterfaceRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	encoding.RegisterGobType(GobRegisteredPet{})
+
+	data := GobOwner{Pet: GobRegisteredPet{Name: "Hedwig"}}
+	buffer := &bytes.Buffer{}
+
+	_, err := engine.Encode(mimetype.GOB, &data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	loaded := GobOwner{}
+	_, err = engine.Decode(mimetype.GOB, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(data, loaded)
+}
+
+func TestGobUnregisteredInterfaceError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := GobOwner{Pet: GobPet{Name: "Hedwig"}}
+	buffer := &bytes.Buffer{}
+
+	mimeType, err := engine.Encode(mimetype.GOB, &data, buffer)
+	assert.Zero(mimeType)
+	assert.EqualError(
+		err,
+		"encode err: gob encode error: gob: type not registered for interface: "+
+			"tests.GobPet",
+	)
+}
@@ -0,0 +1,91 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"html/template"
+	"io"
+	"testing"
+)
+
+type HTMLBadge struct {
+	Name string
+}
+
+func (badge HTMLBadge) Render(writer io.Writer) error {
+	_, err := io.WriteString(writer, "<b>"+template.HTMLEscapeString(badge.Name)+"</b>")
+	return err
+}
+
+func createHTMLEngine(test *testing.T) encoding.ContentEngine {
+	engine := createSpanEngine(test)
+
+	htmlEncoder := encoding.NewHTMLEncoder()
+	htmlEncoder.SetTemplate(
+		Name{},
+		template.Must(
+			template.New("name").Parse("<p>{{.First}} {{.Last}}</p>"),
+		),
+	)
+	engine.SetEncoder(mimetype.HTML, htmlEncoder)
+
+	return engine
+}
+
+func TestHTMLTemplate(test *testing.T) {
+	testCases := []struct {
+		Name    string
+		Content interface{}
+	}{
+		{Name: "Value", Content: Name{First: "Harry", Last: "<Potter>"}},
+		{Name: "Pointer", Content: &Name{First: "Harry", Last: "<Potter>"}},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createHTMLEngine(subTest)
+
+			buffer := &bytes.Buffer{}
+			mimeType, err := engine.Encode(mimetype.HTML, thisCase.Content, buffer)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			assert.Equal(mimetype.HTML, mimeType)
+			assert.Equal("<p>Harry &lt;Potter&gt;</p>", buffer.String())
+		})
+	}
+}
+
+func TestHTMLRenderer(test *testing.T) {
+	assert := assert.New(test)
+	engine := createHTMLEngine(test)
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.HTML, HTMLBadge{Name: "Hermione"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(mimetype.HTML, mimeType)
+	assert.Equal("<b>Hermione</b>", buffer.String())
+}
+
+func TestHTMLNoTemplateError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createHTMLEngine(test)
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.HTML, map[string]string{}, buffer)
+
+	assert.Zero(mimeType)
+	assert.EqualError(
+		err, "encode err: no html template registered for map[string]string",
+	)
+}
@@ -7,16 +7,24 @@ import (
 	"bou.ke/monkey"
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/bsoncodec"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/xerrors"
 	"io"
+	"github.com/illuscio-dev/spantools-go/encoding"
 	"github.com/illuscio-dev/spantools-go/mimetype"
 	"github.com/illuscio-dev/spantools-go/spantypes"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unicode"
 )
 
 func TestJsonListRoundTrip(test *testing.T) {
@@ -88,6 +96,24 @@ func TestBsonUUIDToJson(test *testing.T) {
 	assert.Equal(uuidValue, loaded.Id)
 }
 
+func TestBsonUUIDSubtype4ToJson(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	uuidValue := uuid.NewV4()
+	data := bson.M{"Id": primitive.Binary{Subtype: 0x4, Data: uuidValue.Bytes()}}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, &data, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"Id":"`+uuidValue.String()+`"}`, buffer.String())
+
+	loaded := struct{ Id uuid.UUID }{}
+	_, err = engine.Decode(mimetype.JSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(uuidValue, loaded.Id)
+}
+
 func TestBinBlobToJson(test *testing.T) {
 	engine := createEngine(test)
 
@@ -355,6 +381,30 @@ func TestUnmarshalToBsonBinError(test *testing.T) {
 	)
 }
 
+func TestJSONNullToPointerFields(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	type TestData struct {
+		Binary *primitive.Binary
+		Raw    *bson.Raw
+		Name   *Name
+	}
+
+	receiver := &TestData{
+		Binary: &primitive.Binary{Subtype: 0x0, Data: []byte("stale")},
+		Raw:    &bson.Raw{},
+		Name:   &Name{First: "Stale"},
+	}
+	content := `{"Binary": null, "Raw": null, "Name": null}`
+
+	_, err := engine.Decode(mimetype.JSON, receiver, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Nil(receiver.Binary)
+	assert.Nil(receiver.Raw)
+	assert.Nil(receiver.Name)
+}
+
 func TestUnmarshalToBsonRawError(test *testing.T) {
 	assert := assert.New(test)
 	engine := createEngine(test)
@@ -382,3 +432,1354 @@ func TestUnmarshalToBsonRawError(test *testing.T) {
 			"field not supported",
 	)
 }
+
+func TestBsonBinaryFieldsToJson(test *testing.T) {
+	uuidValue := uuid.NewV4()
+	blobValue := []byte("Test Data.")
+
+	type Receiver struct {
+		Id   uuid.UUID
+		Blob spantypes.BinData
+	}
+
+	testValueField := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+		engine := createEngine(subTest)
+
+		type Data struct {
+			Id   primitive.Binary
+			Blob primitive.Binary
+		}
+
+		data := Data{
+			Id:   primitive.Binary{Subtype: 0x3, Data: uuidValue.Bytes()},
+			Blob: primitive.Binary{Subtype: 0x0, Data: blobValue},
+		}
+
+		buffer := &bytes.Buffer{}
+		if _, err := engine.Encode(mimetype.JSON, data, buffer); err != nil {
+			subTest.Error(err)
+		}
+
+		loaded := Receiver{}
+		if _, err := engine.Decode(mimetype.JSON, &loaded, buffer); err != nil {
+			subTest.Error(err)
+		}
+
+		assert.Equal(uuidValue, loaded.Id)
+		assert.Equal(spantypes.BinData(blobValue), loaded.Blob)
+	}
+
+	testPointerField := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+		engine := createEngine(subTest)
+
+		type Data struct {
+			Id   *primitive.Binary
+			Blob *primitive.Binary
+		}
+
+		data := Data{
+			Id:   &primitive.Binary{Subtype: 0x3, Data: uuidValue.Bytes()},
+			Blob: &primitive.Binary{Subtype: 0x0, Data: blobValue},
+		}
+
+		buffer := &bytes.Buffer{}
+		if _, err := engine.Encode(mimetype.JSON, &data, buffer); err != nil {
+			subTest.Error(err)
+		}
+
+		loaded := Receiver{}
+		if _, err := engine.Decode(mimetype.JSON, &loaded, buffer); err != nil {
+			subTest.Error(err)
+		}
+
+		assert.Equal(uuidValue, loaded.Id)
+		assert.Equal(spantypes.BinData(blobValue), loaded.Blob)
+	}
+
+	test.Run("Value Field", testValueField)
+	test.Run("Pointer Field", testPointerField)
+}
+
+type OverflowCounts struct {
+	Small int8
+	Tiny  uint8 `json:"tiny"`
+}
+
+type OverflowHolder struct {
+	Counts []OverflowCounts
+}
+
+func TestJSONRejectOverflow(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		Receiver interface{}
+		ErrorMsg string
+	}{
+		{
+			Name:     "Int8Field",
+			Content:  `{"Small": 300}`,
+			Receiver: &OverflowCounts{},
+			ErrorMsg: "decode err: value 300 overflows int8 field Small",
+		},
+		{
+			Name:     "NegativeUint",
+			Content:  `{"tiny": -1}`,
+			Receiver: &OverflowCounts{},
+			ErrorMsg: "decode err: value -1 overflows uint8 field Tiny",
+		},
+		{
+			Name:     "Nested",
+			Content:  `{"Counts": [{"Small": 1}, {"Small": -129}]}`,
+			Receiver: &OverflowHolder{},
+			ErrorMsg: "decode err: value -129 overflows int8 field Counts[1].Small",
+		},
+		{
+			Name:     "TopLevel",
+			Content:  `99999999999`,
+			Receiver: new(int32),
+			ErrorMsg: "decode err: value 99999999999 overflows int32",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			engine := createSpanEngine(subTest)
+			engine.SetJSONRejectOverflow(true)
+
+			mimeType, err := engine.Decode(
+				mimetype.JSON, thisCase.Receiver, strings.NewReader(thisCase.Content),
+			)
+			assert.Zero(mimeType)
+			assert.EqualError(err, thisCase.ErrorMsg)
+		})
+	}
+}
+
+func TestJSONRejectOverflowInRange(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetJSONRejectOverflow(true)
+
+	loaded := OverflowCounts{}
+	mimeType, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"Small": -128, "tiny": 255}`),
+	)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal(OverflowCounts{Small: -128, Tiny: 255}, loaded)
+}
+
+func TestJSONRejectOverflowCase(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONRejectOverflow(true)
+
+	// The codec matches keys exactly, so "SMALL" is ignored rather than overflowing.
+	loaded := OverflowCounts{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"SMALL": 999}`),
+	)
+	assert.Nil(err)
+	assert.Equal(OverflowCounts{}, loaded)
+
+	engine.SetJSONCaseInsensitive(true)
+	_, err = engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"SMALL": 999}`),
+	)
+	assert.EqualError(err, "decode err: value 999 overflows int8 field Small")
+}
+
+func TestJSONRejectOverflowOff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Without the option, overflow is left to the codec, whose behavior is not ours to
+	// pin down here. Whatever it does, it should not be our overflow check.
+	loaded := OverflowCounts{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"Small": 300}`),
+	)
+	if err != nil {
+		assert.NotContains(err.Error(), "overflows int8 field Small")
+	}
+}
+
+type CaseHolder struct {
+	Name    Name
+	Names   []Name
+	ByHouse map[string]Name
+	Tagged  string `json:"tagged_field"`
+}
+
+func TestJSONCaseInsensitive(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.False(engine.JSONCaseInsensitive())
+	engine.SetJSONCaseInsensitive(true)
+	assert.True(engine.JSONCaseInsensitive())
+
+	loaded := Name{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"first":"Harry","LAST":"Potter"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(Name{First: "Harry", Last: "Potter"}, loaded)
+
+	content := `{
+		"name": {"first": "Harry"},
+		"names": [{"first": "Hermione"}, null],
+		"byhouse": {"Gryffindor": {"first": "Ron"}},
+		"TAGGED_FIELD": "tagged"
+	}`
+
+	holder := CaseHolder{}
+	_, err = engine.Decode(mimetype.JSON, &holder, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal(
+		CaseHolder{
+			Name:    Name{First: "Harry"},
+			Names:   []Name{{First: "Hermione"}, {}},
+			ByHouse: map[string]Name{"Gryffindor": {First: "Ron"}},
+			Tagged:  "tagged",
+		},
+		holder,
+	)
+}
+
+func TestJSONCaseInsensitiveExactWins(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONCaseInsensitive(true)
+
+	loaded := Name{}
+	_, err := engine.Decode(
+		mimetype.JSON,
+		&loaded,
+		strings.NewReader(`{"first": "Ignored", "First": "Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal("Harry", loaded.First)
+}
+
+type CaseTwins struct {
+	Name string
+	NAME string
+}
+
+func TestJSONCaseInsensitiveFirstWins(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONCaseInsensitive(true)
+
+	// Neither key is exact, so the first one sent is used.
+	for i := 0; i < 20; i++ {
+		loaded := Name{}
+		_, err := engine.Decode(
+			mimetype.JSON,
+			&loaded,
+			strings.NewReader(`{"FIRST": "Harry", "first": "Ron"}`),
+		)
+		assert.Nil(err)
+		assert.Equal("Harry", loaded.First)
+
+		loaded = Name{}
+		_, err = engine.Decode(
+			mimetype.JSON,
+			&loaded,
+			strings.NewReader(`{"first": "Ron", "FIRST": "Harry"}`),
+		)
+		assert.Nil(err)
+		assert.Equal("Ron", loaded.First)
+	}
+
+	// A key matching several fields ignoring case goes to the first declared.
+	twins := CaseTwins{}
+	_, err := engine.Decode(
+		mimetype.JSON, &twins, strings.NewReader(`{"name": "Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(CaseTwins{Name: "Harry"}, twins)
+}
+
+func TestJSONCaseInsensitiveOff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	loaded := Name{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"first":"Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal("", loaded.First)
+}
+
+type ExtraHouse struct {
+	Name  string                 `json:"name"`
+	Extra map[string]interface{} `json:",extra" codec:"-"`
+}
+
+type ExtraWizard struct {
+	Name   string                 `json:"name"`
+	House  ExtraHouse             `json:"house"`
+	Houses []ExtraHouse           `json:"houses"`
+	Extra  map[string]interface{} `json:",extra" codec:"-"`
+}
+
+func TestJSONCaptureExtra(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.False(engine.JSONCaptureExtra())
+	engine.SetJSONCaptureExtra(true)
+	assert.True(engine.JSONCaptureExtra())
+
+	content := `{
+		"name": "Harry",
+		"wand": "holly",
+		"pet": {"name": "Hedwig"},
+		"house": {"name": "Gryffindor", "ghost": "Nick"},
+		"houses": [{"name": "Slytherin"}, {"name": "Hufflepuff", "ghost": "Friar"}]
+	}`
+
+	loaded := ExtraWizard{}
+	_, err := engine.Decode(mimetype.JSON, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal(
+		ExtraWizard{
+			Name: "Harry",
+			House: ExtraHouse{
+				Name:  "Gryffindor",
+				Extra: map[string]interface{}{"ghost": "Nick"},
+			},
+			Houses: []ExtraHouse{
+				{Name: "Slytherin"},
+				{Name: "Hufflepuff", Extra: map[string]interface{}{"ghost": "Friar"}},
+			},
+			Extra: map[string]interface{}{
+				"wand": "holly",
+				"pet":  map[string]interface{}{"name": "Hedwig"},
+			},
+		},
+		loaded,
+	)
+}
+
+func TestJSONCaptureExtraOff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	loaded := ExtraWizard{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"name":"Harry","wand":"holly"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(ExtraWizard{Name: "Harry"}, loaded)
+}
+
+// An empty object is a valid body for any struct, decoding to its zero value whichever
+// decode options are set.
+func TestJSONEmptyObject(test *testing.T) {
+	testCases := []struct {
+		Name      string
+		Configure func(engine *encoding.SpanEngine)
+	}{
+		{Name: "Default", Configure: func(*encoding.SpanEngine) {}},
+		{
+			Name: "RejectOverflow",
+			Configure: func(engine *encoding.SpanEngine) {
+				engine.SetJSONRejectOverflow(true)
+			},
+		},
+		{
+			Name: "CaseInsensitive",
+			Configure: func(engine *encoding.SpanEngine) {
+				engine.SetJSONCaseInsensitive(true)
+			},
+		},
+		{
+			Name: "CaptureExtra",
+			Configure: func(engine *encoding.SpanEngine) {
+				engine.SetJSONCaptureExtra(true)
+			},
+		},
+		{
+			Name: "MaxListElements",
+			Configure: func(engine *encoding.SpanEngine) {
+				engine.SetMaxListElements(1)
+			},
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+			thisCase.Configure(engine)
+
+			loaded := ExtraWizard{}
+			mimeType, err := engine.Decode(
+				mimetype.JSON, &loaded, strings.NewReader(" { } "),
+			)
+			assert.Nil(err)
+			assert.Equal(mimetype.JSON, mimeType)
+			assert.Equal(ExtraWizard{}, loaded)
+
+			// Sniffed empty objects are json too.
+			loaded = ExtraWizard{}
+			mimeType, err = engine.Decode(
+				mimetype.UNKNOWN, &loaded, strings.NewReader("{}"),
+			)
+			assert.Nil(err)
+			assert.Equal(mimetype.JSON, mimeType)
+			assert.Equal(ExtraWizard{}, loaded)
+		})
+	}
+}
+
+type Spell struct {
+	Name     string        `json:"name" bson:"name" yaml:"name"`
+	Duration time.Duration `json:"duration" bson:"duration" yaml:"duration"`
+}
+
+func TestJSONDuration(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	spell := Spell{Name: "Protego", Duration: 90 * time.Minute}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, spell, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"name":"Protego","duration":"1h30m0s"}`, buffer.String())
+
+	loaded := Spell{}
+	_, err = engine.Decode(mimetype.JSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(spell, loaded)
+
+	assert.False(engine.JSONDurationNanos())
+	engine.SetJSONDurationNanos(true)
+	assert.True(engine.JSONDurationNanos())
+
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.JSON, spell, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"name":"Protego","duration":5400000000000}`, buffer.String())
+
+	// Nanosecond counts are decoded whichever way durations are written.
+	engine.SetJSONDurationNanos(false)
+	loaded = Spell{}
+	_, err = engine.Decode(mimetype.JSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(spell, loaded)
+}
+
+func TestJSONDurationInvalid(test *testing.T) {
+	engine := createSpanEngine(test)
+
+	_, err := engine.Decode(
+		mimetype.JSON, &Spell{}, strings.NewReader(`{"duration":"ninety minutes"}`),
+	)
+	if assert.Error(test, err) {
+		assert.Contains(test, err.Error(), "error parsing duration")
+	}
+}
+
+func TestJSONOrderedBSONRaw(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	uuidValue := uuid.NewV4()
+	document := bson.D{
+		{Key: "zebra", Value: "z"},
+		{Key: "id", Value: primitive.Binary{Subtype: 0x3, Data: uuidValue.Bytes()}},
+		{Key: "middle", Value: bson.D{
+			{Key: "second", Value: "b"},
+			{Key: "first", Value: "a"},
+		}},
+		{Key: "list", Value: bson.A{bson.D{
+			{Key: "y", Value: "1"},
+			{Key: "x", Value: "2"},
+		}}},
+		{Key: "apple", Value: "a"},
+	}
+	rawBytes, err := bson.Marshal(document)
+	if err != nil {
+		test.Fatal(err)
+	}
+	rawDoc := bson.Raw(rawBytes)
+
+	assert.False(engine.JSONOrderedBSONRaw())
+	engine.SetJSONOrderedBSONRaw(true)
+	assert.True(engine.JSONOrderedBSONRaw())
+
+	buffer := &bytes.Buffer{}
+	_, err = engine.Encode(mimetype.JSON, &rawDoc, buffer)
+	assert.Nil(err)
+	assert.Equal(
+		`{"zebra":"z","id":"`+uuidValue.String()+`",`+
+			`"middle":{"second":"b","first":"a"},"list":[{"y":"1","x":"2"}],`+
+			`"apple":"a"}`,
+		buffer.String(),
+	)
+
+	// The setting is copied to clones, whose extensions are their own.
+	buffer.Reset()
+	_, err = engine.Clone().Encode(mimetype.JSON, &rawDoc, buffer)
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(buffer.String(), `{"zebra":"z",`))
+
+	empty := bson.Raw{}
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.JSON, &empty, buffer)
+	assert.Nil(err)
+	assert.Equal("{}", buffer.String())
+}
+
+type Blob struct {
+	Data spantypes.BinData `json:"data"`
+}
+
+func TestJSONBinDataEncoding(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Mode     encoding.BinDataEncoding
+		Expected string
+	}{
+		{Name: "Hex", Mode: encoding.BinDataHex, Expected: `{"data":"54657374"}`},
+		{Name: "Base64", Mode: encoding.BinDataBase64, Expected: `{"data":"VGVzdA=="}`},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+			engine.SetBinDataEncoding(thisCase.Mode)
+			assert.Equal(thisCase.Mode, engine.BinDataEncoding())
+
+			blob := Blob{Data: spantypes.BinData("Test")}
+
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(mimetype.JSON, blob, buffer)
+			assert.Nil(err)
+			assert.Equal(thisCase.Expected, buffer.String())
+
+			loaded := Blob{}
+			_, err = engine.Decode(mimetype.JSON, &loaded, buffer)
+			assert.Nil(err)
+			assert.Equal(blob, loaded)
+		})
+	}
+}
+
+func TestJSONBinDataBase64(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	assert.Equal(encoding.BinDataHex, engine.BinDataEncoding())
+
+	engine.SetBinDataEncoding(encoding.BinDataBase64)
+	assert.Equal(encoding.BinDataBase64, engine.Clone().BinDataEncoding())
+
+	// BSON binary is written in the same encoding.
+	data := bson.M{"data": primitive.Binary{Subtype: 0x0, Data: []byte("Test")}}
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, data, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"data":"VGVzdA=="}`, buffer.String())
+
+	// The configured mode is expected when decoding.
+	_, err = engine.Decode(
+		mimetype.JSON, &Blob{}, strings.NewReader(`{"data":"5465737!"}`),
+	)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "could not decode base64")
+	}
+}
+
+func TestEncodeMapOrderedJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := map[string]interface{}{
+		"last":  "Potter",
+		"house": "Gryffindor",
+		"first": "Harry",
+		"age":   11,
+		"year":  1,
+	}
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeMapOrdered(
+		mimetype.JSON, content, []string{"first", "last", "missing", "first"}, buffer,
+	)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(
+		`{"first":"Harry","last":"Potter","age":11,"house":"Gryffindor","year":1}`,
+		buffer.String(),
+	)
+}
+
+// Writes every value as the same string.
+type ConstantEncoder struct{}
+
+func (encoder ConstantEncoder) Encode(
+	engine encoding.ContentEngine, writer io.Writer, content interface{},
+) error {
+	_, err := writer.Write([]byte(`"constant"`))
+	return err
+}
+
+func TestEncodeMapOrderedJSONWhole(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := map[string]interface{}{"first": "Harry", "last": "Potter"}
+	order := []string{"last", "first"}
+
+	// Type encoders for strings do not take over the keys.
+	engine.SetTypeEncoder(reflect.TypeOf(""), ConstantEncoder{})
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeMapOrdered(mimetype.JSON, content, order, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"last":"Potter","first":"Harry"}`, buffer.String())
+
+	// The size limit applies to the whole object, not each key and value.
+	engine.SetTypeEncoder(reflect.TypeOf(""), nil)
+	engine.SetMaxEncodeBytes(20)
+
+	err = engine.EncodeMapOrdered(mimetype.JSON, content, order, &bytes.Buffer{})
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "encoded output exceeds maximum of 20 bytes")
+	}
+}
+
+func TestEncodeMapOrderedBSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := map[string]interface{}{"b": "2", "c": "3", "a": "1"}
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeMapOrdered(mimetype.BSON, content, []string{"c"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	elements, err := bson.Raw(buffer.Bytes()).Elements()
+	if err != nil {
+		test.Error(err)
+	}
+
+	keys := make([]string, 0)
+	for _, element := range elements {
+		keys = append(keys, element.Key())
+	}
+	assert.Equal([]string{"c", "a", "b"}, keys)
+}
+
+func TestEncodeMapOrderedUnsupported(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	err := engine.EncodeMapOrdered(
+		mimetype.TEXT, map[string]interface{}{}, nil, &bytes.Buffer{},
+	)
+	assert.EqualError(err, "ordered map encoding not supported for text/plain")
+}
+
+func TestEncodeCanonicalVectors(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  interface{}
+		Expected string
+	}{
+		{
+			// Sample from RFC 8785 section 3.2.2.
+			Name: "RFC Sample",
+			Content: map[string]interface{}{
+				"numbers": []interface{}{
+					333333333.33333329, 1e30, 4.50, 2e-3, 0.000000000000000000000000001,
+				},
+				"string":   "€$\u000F\u000aA'B\"\\\\\"/",
+				"literals": []interface{}{nil, true, false},
+			},
+			Expected: `{"literals":[null,true,false],` +
+				`"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],` +
+				`"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			// Keys are sorted by UTF-16 code units, from RFC 8785 section 3.2.3.
+			Name: "Key Order",
+			Content: map[string]interface{}{
+				"\u20ac":     "Euro Sign",
+				"\r":         "Carriage Return",
+				"\ufb33":     "Hebrew Letter Dalet With Dagesh",
+				"1":          "One",
+				"\U0001f600": "Emoji: Grinning Face",
+				"\u0080":     "Control",
+				"\u00f6":     "Latin Small Letter O With Diaeresis",
+			},
+			Expected: `{"\r":"Carriage Return","1":"One","` + "\u0080" + `":"Control",` +
+				`"ö":"Latin Small Letter O With Diaeresis","€":"Euro Sign",` +
+				`"😀":"Emoji: Grinning Face","דּ":"Hebrew Letter Dalet With Dagesh"}`,
+		},
+		{
+			Name:     "Struct",
+			Content:  Name{Last: "Potter", First: "Harry"},
+			Expected: `{"First":"Harry","Last":"Potter"}`,
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			canonical, err := engine.EncodeCanonical(thisCase.Content)
+			if err != nil {
+				subTest.Error(err)
+			}
+			assert.Equal(thisCase.Expected, string(canonical))
+		})
+	}
+}
+
+type OmitNullWizard struct {
+	Name    string
+	Pet     *string
+	Wand    *Name
+	Friends []string
+	Year    int
+}
+
+func TestEncodeOmitNullJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := OmitNullWizard{Name: "Harry", Wand: &Name{First: "Holly"}}
+
+	withNulls := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, content, withNulls)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(
+		`{"Name":"Harry","Pet":null,"Wand":{"First":"Holly","Last":""},`+
+			`"Friends":null,"Year":0}`,
+		withNulls.String(),
+	)
+
+	omitted := &bytes.Buffer{}
+	mimeType, err := engine.EncodeOmitNull(mimetype.JSON, content, omitted)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal(
+		`{"Name":"Harry","Wand":{"First":"Holly","Last":""},"Year":0}`,
+		omitted.String(),
+	)
+}
+
+func TestEncodeOmitNullJSONListElements(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := []interface{}{nil, map[string]interface{}{"a": nil}}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.EncodeOmitNull(mimetype.JSON, content, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(`[null,{}]`, buffer.String())
+}
+
+func TestEncodeOmitNullBSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := OmitNullWizard{Name: "Harry", Friends: []string{"Ron"}}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.EncodeOmitNull(mimetype.BSON, content, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.BSON, mimeType)
+
+	document := bson.Raw(buffer.Bytes())
+	assert.Nil(document.Validate())
+
+	_, err = document.LookupErr("pet")
+	assert.Error(err)
+	_, err = document.LookupErr("wand")
+	assert.Error(err)
+	assert.Equal("Harry", document.Lookup("name").StringValue())
+	assert.Equal(int64(0), document.Lookup("year").Int64())
+}
+
+func TestEncodeOmitNullUnsupported(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	mimeType, err := engine.EncodeOmitNull(mimetype.TEXT, "text", &bytes.Buffer{})
+	assert.Zero(mimeType)
+	assert.EqualError(err, "null omission not supported for text/plain")
+}
+
+func TestObjectStreamEncoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	buffer := &bytes.Buffer{}
+	stream := engine.NewObjectStreamEncoder(buffer)
+
+	fieldCount := 1000
+	for i := 0; i < fieldCount; i++ {
+		err := stream.WriteField(
+			fmt.Sprintf("key-%v", i), Name{First: fmt.Sprintf("Wizard %v", i)},
+		)
+		if !assert.Nil(err) {
+			return
+		}
+	}
+	assert.Nil(stream.Close())
+
+	loaded := make(map[string]Name)
+	_, err := engine.Decode(mimetype.JSON, &loaded, buffer)
+	assert.Nil(err)
+	assert.Len(loaded, fieldCount)
+	assert.Equal("Wizard 999", loaded["key-999"].First)
+
+	err = stream.WriteField("late", "value")
+	assert.EqualError(err, "object stream is closed")
+}
+
+func TestObjectStreamEncoderEmpty(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	buffer := &bytes.Buffer{}
+	stream := engine.NewObjectStreamEncoder(buffer)
+	assert.Nil(stream.Close())
+	assert.Equal("{}", buffer.String())
+}
+
+func TestObjectStreamEncoderCompact(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONIndent("", "  ")
+
+	buffer := &bytes.Buffer{}
+	stream := engine.NewObjectStreamEncoder(buffer)
+	assert.Nil(stream.WriteField("harry", Name{First: "Harry", Last: "Potter"}))
+	assert.Nil(stream.WriteField("pets", []string{"Hedwig"}))
+	assert.Nil(stream.Close())
+
+	assert.Equal(
+		`{"harry":{"First":"Harry","Last":"Potter"},"pets":["Hedwig"]}`,
+		buffer.String(),
+	)
+}
+
+func TestObjectStreamEncoderNotAllowed(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.BSON})
+
+	buffer := &bytes.Buffer{}
+	stream := engine.NewObjectStreamEncoder(buffer)
+
+	notAllowed := &encoding.MimeTypeNotAllowedError{}
+	err := stream.WriteField("key", "value")
+	if assert.True(xerrors.As(err, &notAllowed)) {
+		assert.Equal(mimetype.JSON, notAllowed.MimeType)
+	}
+	assert.Equal(err, stream.Close())
+	assert.Zero(buffer.Len())
+}
+
+func TestJSONPooledAfterError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	name := Name{}
+	_, err := engine.Decode(mimetype.JSON, &name, strings.NewReader(`{"First": 1`))
+	assert.Error(err)
+
+	name = Name{}
+	_, err = engine.Decode(
+		mimetype.JSON, &name, strings.NewReader(`{"First": "Harry", "Last": "Potter"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(Name{First: "Harry", Last: "Potter"}, name)
+}
+
+func TestConcurrentJSONPool(test *testing.T) {
+	engine := createSpanEngine(test)
+
+	waitGroup := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func(worker int) {
+			defer waitGroup.Done()
+			for j := 0; j < 50; j++ {
+				sent := Name{First: fmt.Sprint(worker), Last: fmt.Sprint(j)}
+
+				buffer := &bytes.Buffer{}
+				_, err := engine.Encode(mimetype.JSON, sent, buffer)
+				assert.Nil(test, err)
+
+				received := Name{}
+				_, err = engine.Decode(mimetype.JSON, &received, buffer)
+				assert.Nil(test, err)
+				assert.Equal(test, sent, received)
+			}
+		}(i)
+	}
+
+	// Replacing the handle replaces the pool while it is in use.
+	shoutedType := reflect.TypeOf(ShoutedName(""))
+	for i := 0; i < 50; i++ {
+		err := engine.AddJSONExtensions(
+			[]*encoding.JSONExtensionOpts{
+				{ValueType: shoutedType, ExtInterface: &ShoutedNameExt{}},
+			},
+		)
+		assert.Nil(test, err)
+	}
+
+	waitGroup.Wait()
+}
+
+func TestJSONPooledOutputMatches(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	contents := []interface{}{
+		Name{First: "Harry", Last: "Potter"},
+		[]Name{{First: "Hermione"}, {Last: "Weasley"}},
+		map[string]interface{}{"house": "Gryffindor", "points": 150},
+		"Hogwarts",
+		nil,
+	}
+
+	// Encode everything twice, so the second pass re-uses pooled encoders.
+	for i := 0; i < 2; i++ {
+		for _, content := range contents {
+			pooled := &bytes.Buffer{}
+			_, err := engine.Encode(mimetype.JSON, content, pooled)
+			assert.Nil(err)
+
+			unpooled := &bytes.Buffer{}
+			err = codec.NewEncoder(unpooled, engine.JSONHandle()).Encode(content)
+			assert.Nil(err)
+
+			assert.Equal(unpooled.String(), pooled.String(), "content: %v", content)
+		}
+	}
+}
+
+func TestJSONIndent(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	prefix, indent := engine.JSONIndent()
+	assert.Equal("", prefix)
+	assert.Equal("", indent)
+
+	name := Name{First: "Harry", Last: "Potter"}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, name, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"First":"Harry","Last":"Potter"}`, buffer.String())
+
+	engine.SetJSONIndent("", "  ")
+	prefix, indent = engine.JSONIndent()
+	assert.Equal("", prefix)
+	assert.Equal("  ", indent)
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		buffer.Reset()
+		_, err = thisEngine.Encode(mimetype.JSON, name, buffer)
+		assert.Nil(err)
+		assert.Equal(
+			"{\n  \"First\": \"Harry\",\n  \"Last\": \"Potter\"\n}", buffer.String(),
+		)
+
+		loaded := Name{}
+		_, err = thisEngine.Decode(mimetype.JSON, &loaded, buffer)
+		assert.Nil(err)
+		assert.Equal(name, loaded)
+	}
+
+	engine.SetJSONIndent("", "")
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.JSON, name, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"First":"Harry","Last":"Potter"}`, buffer.String())
+}
+
+func TestJSONIndentPrefix(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONIndent("// ", "\t")
+
+	data := []Name{{First: "Harry", Last: "Potter"}}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, data, buffer)
+	assert.Nil(err)
+	assert.Equal(
+		"[\n// \t{\n// \t\t\"First\": \"Harry\",\n// \t\t\"Last\": \"Potter\"\n// \t}\n// ]",
+		buffer.String(),
+	)
+}
+
+type OwlPost struct {
+	Sender    string
+	Delivered time.Time
+	Returned  *time.Time
+}
+
+func TestJSONTimeLayout(test *testing.T) {
+	delivered := time.Date(1991, 7, 31, 12, 30, 15, 123456789, time.UTC)
+	returned := time.Date(1991, 8, 1, 0, 0, 0, 0, time.UTC)
+	post := OwlPost{Sender: "Hagrid", Delivered: delivered, Returned: &returned}
+
+	testCases := []struct {
+		Layout   string
+		Expected string
+		Loaded   OwlPost
+	}{
+		{
+			Layout: "",
+			Expected: `{"Sender":"Hagrid","Delivered":"1991-07-31T12:30:15.123456789Z",` +
+				`"Returned":"1991-08-01T00:00:00Z"}`,
+			Loaded: post,
+		},
+		{
+			Layout: time.RFC1123,
+			Expected: `{"Sender":"Hagrid","Delivered":"Wed, 31 Jul 1991 12:30:15 UTC",` +
+				`"Returned":"Thu, 01 Aug 1991 00:00:00 UTC"}`,
+			Loaded: OwlPost{
+				Sender:    "Hagrid",
+				Delivered: delivered.Truncate(time.Second),
+				Returned:  &returned,
+			},
+		},
+		{
+			Layout: encoding.TimeLayoutEpochMillis,
+			Expected: `{"Sender":"Hagrid","Delivered":680963415123,` +
+				`"Returned":681004800000}`,
+			Loaded: OwlPost{
+				Sender:    "Hagrid",
+				Delivered: delivered.Truncate(time.Millisecond),
+				Returned:  &returned,
+			},
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Layout, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+			engine.SetTimeLayout(thisCase.Layout)
+			assert.Equal(thisCase.Layout, engine.Clone().TimeLayout())
+
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(mimetype.JSON, post, buffer)
+			assert.Nil(err)
+			assert.Equal(thisCase.Expected, buffer.String())
+
+			loaded := OwlPost{}
+			_, err = engine.Decode(mimetype.JSON, &loaded, buffer)
+			assert.Nil(err)
+			assert.True(thisCase.Loaded.Delivered.Equal(loaded.Delivered))
+			if assert.NotNil(loaded.Returned) {
+				assert.True(thisCase.Loaded.Returned.Equal(*loaded.Returned))
+			}
+		})
+	}
+}
+
+func TestJSONTimeMalformed(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetTimeLayout(time.RFC1123)
+
+	loaded := OwlPost{}
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"Delivered": "1991-07-31"}`),
+	)
+	if assert.Error(err) {
+		assert.Contains(
+			err.Error(),
+			`error parsing time "1991-07-31" with layout "`+time.RFC1123+`"`,
+		)
+	}
+
+	_, err = engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"Delivered": true}`),
+	)
+	assert.Error(err)
+}
+
+func TestJSONCanonical(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	assert.False(engine.JSONCanonical())
+
+	engine.SetJSONCanonical(true)
+	assert.True(engine.JSONCanonical())
+	assert.True(engine.Clone().JSONCanonical())
+
+	points := map[string]interface{}{
+		"Slytherin":  472,
+		"Ravenclaw":  426,
+		"Hufflepuff": 352,
+		"Gryffindor": map[string]interface{}{"Harry": 50, "Hermione": 100, "Ron": 20},
+	}
+
+	first := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, points, first)
+	assert.Nil(err)
+	assert.Equal(
+		`{"Gryffindor":{"Harry":50,"Hermione":100,"Ron":20},"Hufflepuff":352,`+
+			`"Ravenclaw":426,"Slytherin":472}`,
+		first.String(),
+	)
+
+	// Map iteration order is random, so encode a few times.
+	for i := 0; i < 10; i++ {
+		again := &bytes.Buffer{}
+		_, err = engine.Encode(mimetype.JSON, points, again)
+		assert.Nil(err)
+		assert.Equal(first.Bytes(), again.Bytes())
+	}
+
+	// Extensions still apply to the replaced handle.
+	id := uuid.NewV4()
+	buffer := &bytes.Buffer{}
+	_, err = engine.Encode(mimetype.JSON, map[string]interface{}{"id": id}, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"id":"`+id.String()+`"}`, buffer.String())
+
+	engine.SetJSONCanonical(false)
+	assert.False(engine.JSONCanonical())
+}
+
+// Converts a Go field name like "FirstName" to "first_name".
+func toSnakeCase(fieldName string) string {
+	builder := strings.Builder{}
+	for index, char := range fieldName {
+		if unicode.IsUpper(char) {
+			if index > 0 {
+				builder.WriteByte('_')
+			}
+			char = unicode.ToLower(char)
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+type WandCore struct {
+	CoreMaterial string
+}
+
+type NamedWizard struct {
+	FirstName  string
+	LastName   string
+	HouseName  string `json:"House"`
+	WandCore   *WandCore
+	PastWands  []WandCore
+	PetsByName map[string]WandCore
+}
+
+func TestJSONFieldNamer(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	assert.Nil(engine.JSONFieldNamer())
+
+	engine.SetJSONFieldNamer(toSnakeCase)
+	assert.NotNil(engine.JSONFieldNamer())
+
+	wizard := NamedWizard{
+		FirstName: "Harry",
+		LastName:  "Potter",
+		HouseName: "Gryffindor",
+		WandCore:  &WandCore{CoreMaterial: "Phoenix Feather"},
+		PastWands: []WandCore{{CoreMaterial: "Unicorn Hair"}},
+		PetsByName: map[string]WandCore{
+			"HedwigTheOwl": {CoreMaterial: "Feather"},
+		},
+	}
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		buffer := &bytes.Buffer{}
+		_, err := thisEngine.Encode(mimetype.JSON, &wizard, buffer)
+		assert.Nil(err)
+
+		// Tagged fields and map keys keep their names, and field order is kept.
+		assert.Equal(
+			`{"first_name":"Harry","last_name":"Potter","House":"Gryffindor",`+
+				`"wand_core":{"core_material":"Phoenix Feather"},`+
+				`"past_wands":[{"core_material":"Unicorn Hair"}],`+
+				`"pets_by_name":{"HedwigTheOwl":{"core_material":"Feather"}}}`,
+			buffer.String(),
+		)
+	}
+
+	engine.SetJSONFieldNamer(nil)
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, WandCore{CoreMaterial: "Holly"}, buffer)
+	assert.Nil(err)
+	assert.Equal(`{"CoreMaterial":"Holly"}`, buffer.String())
+}
+
+func TestJSONFieldNamerIndent(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONFieldNamer(toSnakeCase)
+	engine.SetJSONIndent("", "  ")
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(
+		mimetype.JSON, []WandCore{{CoreMaterial: "Holly"}}, buffer,
+	)
+	assert.Nil(err)
+	assert.Equal("[\n  {\n    \"core_material\": \"Holly\"\n  }\n]", buffer.String())
+}
+
+type HousePoints struct {
+	House  string
+	Points int
+	Cup    bool
+}
+
+type PointsLedger struct {
+	Year  int
+	Total HousePoints `json:"total"`
+}
+
+func TestDecodeCollectErrors(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := `{"Year": 1992, "total": {"House": "Gryffindor", "Points": "many", ` +
+		`"Cup": "yes"}}`
+
+	loaded := PointsLedger{}
+	errs := engine.DecodeCollectErrors(
+		mimetype.JSON, &loaded, strings.NewReader(content),
+	)
+	if !assert.Len(errs, 2) {
+		return
+	}
+
+	fields := make([]string, 0)
+	for _, err := range errs {
+		fieldErr := &encoding.FieldDecodeError{}
+		if assert.True(xerrors.As(err, &fieldErr)) {
+			fields = append(fields, fieldErr.Field)
+			assert.Contains(err.Error(), "field "+fieldErr.Field+": ")
+		}
+	}
+	assert.Equal([]string{"total.Points", "total.Cup"}, fields)
+
+	// Fields which decode are still set.
+	assert.Equal(1992, loaded.Year)
+	assert.Equal("Gryffindor", loaded.Total.House)
+	assert.Equal(0, loaded.Total.Points)
+}
+
+func TestDecodeCollectErrorsNone(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	loaded := PointsLedger{}
+	errs := engine.DecodeCollectErrors(
+		mimetype.JSON, &loaded, strings.NewReader(`{"Year": 1992}`),
+	)
+	assert.Nil(errs)
+	assert.Equal(1992, loaded.Year)
+
+	// Content which is not an object is decoded whole.
+	errs = engine.DecodeCollectErrors(
+		mimetype.JSON, &loaded, strings.NewReader(`["Gryffindor"]`),
+	)
+	assert.Len(errs, 1)
+}
+
+const benchmarkJSONName = `{"First": "Harry", "Last": "Potter"}`
+
+func BenchmarkJSONDecodeSmall(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	content := []byte(benchmarkJSONName)
+
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		name := Name{}
+		_, _ = engine.Decode(mimetype.JSON, &name, bytes.NewReader(content))
+	}
+}
+
+// Decodes with a new codec.Decoder per call, as the engine did before decoders were
+// pooled, for comparison with BenchmarkJSONDecodeSmall.
+func BenchmarkJSONDecodeSmallUnpooled(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	content := []byte(benchmarkJSONName)
+
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		name := Name{}
+		decoder := codec.NewDecoder(bytes.NewReader(content), engine.JSONHandle())
+		_ = decoder.Decode(&name)
+	}
+}
+
+func BenchmarkJSONEncodeReuse(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	name := Name{First: "Harry", Last: "Potter"}
+	buffer := &bytes.Buffer{}
+
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		buffer.Reset()
+		_, _ = engine.Encode(mimetype.JSON, name, buffer)
+	}
+}
+
+// Encodes with a new codec.Encoder per call, for comparison with
+// BenchmarkJSONEncodeReuse.
+func BenchmarkJSONEncodeSmallUnpooled(bench *testing.B) {
+	engine, _ := encoding.NewContentEngine(false)
+	name := Name{First: "Harry", Last: "Potter"}
+	buffer := &bytes.Buffer{}
+
+	bench.ReportAllocs()
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		buffer.Reset()
+		_ = codec.NewEncoder(buffer, engine.JSONHandle()).Encode(name)
+	}
+}
@@ -0,0 +1,148 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spantypes"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMsgpackBasicRoundTrip(test *testing.T) {
+	RoundTripName(test, mimetype.MSGPACK, mimetype.MSGPACK)
+}
+
+func TestMsgpackListRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{
+		{First: "Harry", Last: "Potter"},
+		{First: "Hermione", Last: "Granger"},
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.MSGPACK, data, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.MSGPACK, mimeType)
+
+	var loaded []Name
+	_, err = engine.Decode(mimetype.MSGPACK, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(data, loaded)
+}
+
+type MsgpackWizard struct {
+	Id       uuid.UUID
+	Wand     spantypes.BinData
+	Duration time.Duration
+	Pet      *uuid.UUID
+}
+
+func TestMsgpackExtensions(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	pet := uuid.NewV4()
+	wizard := MsgpackWizard{
+		Id:       uuid.NewV4(),
+		Wand:     spantypes.BinData{0xde, 0xad, 0xbe, 0xef},
+		Duration: 90 * time.Minute,
+		Pet:      &pet,
+	}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.MSGPACK, wizard, buffer)
+	assert.Nil(err)
+
+	loaded := MsgpackWizard{}
+	_, err = engine.Decode(mimetype.MSGPACK, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(wizard, loaded)
+}
+
+func TestMsgpackUntyped(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(
+		mimetype.MSGPACK, map[string]interface{}{"house": map[string]interface{}{
+			"name": "Gryffindor",
+		}}, buffer,
+	)
+	assert.Nil(err)
+
+	// Strings and objects decode as they would from json.
+	loaded := make(map[string]interface{})
+	_, err = engine.Decode(mimetype.MSGPACK, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(
+		map[string]interface{}{"house": map[string]interface{}{"name": "Gryffindor"}},
+		loaded,
+	)
+}
+
+// Wraps strings in angle brackets.
+type bracketExt struct{}
+
+func (bracketExt) ConvertExt(value interface{}) interface{} {
+	return "<" + string(value.(Bracketed)) + ">"
+}
+
+func (bracketExt) UpdateExt(dest interface{}, value interface{}) {
+	text := value.(string)
+	*dest.(*Bracketed) = Bracketed(text[1 : len(text)-1])
+}
+
+type Bracketed string
+
+func TestMsgpackAddedExtension(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	err := engine.AddJSONExtensions([]*encoding.JSONExtensionOpts{
+		{ValueType: reflect.TypeOf(Bracketed("")), ExtInterface: bracketExt{}},
+	})
+	assert.Nil(err)
+
+	type Receiver struct {
+		Value Bracketed
+	}
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		buffer := &bytes.Buffer{}
+		_, err = thisEngine.Encode(mimetype.MSGPACK, Receiver{Value: "Harry"}, buffer)
+		assert.Nil(err)
+		assert.Contains(buffer.String(), "<Harry>")
+
+		loaded := Receiver{}
+		_, err = thisEngine.Decode(mimetype.MSGPACK, &loaded, buffer)
+		assert.Nil(err)
+		assert.Equal(Bracketed("Harry"), loaded.Value)
+	}
+}
+
+func TestMsgpackSniff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{{First: "Harry", Last: "Potter"}}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.MSGPACK, data, buffer)
+	assert.Nil(err)
+
+	var loaded []Name
+	mimeType, err := engine.Decode(mimetype.UNKNOWN, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.MSGPACK, mimeType)
+	assert.Equal(data, loaded)
+}
@@ -0,0 +1,105 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNDJSONBasicRoundTrip(test *testing.T) {
+	RoundTripName(test, mimetype.NDJSON, mimetype.NDJSON)
+}
+
+func TestNDJSONListRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{
+		{First: "Harry", Last: "Potter"},
+		{First: "Hermione", Last: "Granger"},
+		{First: "Ron", Last: "Weasley"},
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.NDJSON, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.NDJSON, mimeType)
+
+	// One compact document per line, each terminated by a newline.
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Len(lines, 4)
+	assert.Equal(`{"First":"Harry","Last":"Potter"}`, lines[0])
+	assert.Equal("", lines[3])
+
+	var loaded []Name
+	mimeType, err = engine.Decode(mimetype.NDJSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.NDJSON, mimeType)
+	assert.Equal(data, loaded)
+}
+
+func TestNDJSONDecodeSkipsEmptyLines(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "\n{\"First\": \"Harry\"}\n\n  \r\n{\"First\": \"Ron\"}"
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.NDJSON, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal([]Name{{First: "Harry"}, {First: "Ron"}}, loaded)
+
+	loaded = nil
+	_, err = engine.Decode(mimetype.NDJSON, &loaded, strings.NewReader("\n\n"))
+	assert.Nil(err)
+	assert.Len(loaded, 0)
+}
+
+func TestNDJSONDecodeError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "{\"First\": \"Harry\"}\n{\"First\": \n"
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.NDJSON, &loaded, strings.NewReader(content))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "error decoding ndjson document 2")
+	}
+}
+
+func TestNDJSONMaxListElements(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetMaxListElements(1)
+
+	content := "{\"First\": \"Harry\"}\n{\"First\": \"Ron\"}\n"
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.NDJSON, &loaded, strings.NewReader(content))
+	assert.Error(err)
+}
+
+func TestNDJSONSniffList(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "{\"First\": \"Harry\"}\n{\"First\": \"Ron\"}\n"
+
+	var loaded []Name
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(content),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.NDJSON, mimeType)
+	assert.Equal([]Name{{First: "Harry"}, {First: "Ron"}}, loaded)
+}
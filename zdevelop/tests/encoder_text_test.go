@@ -6,11 +6,13 @@ package tests
 import (
 	"bou.ke/monkey"
 	"bytes"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/xerrors"
 	"io"
 	"reflect"
 	"github.com/illuscio-dev/spantools-go/mimetype"
+	"strings"
 	"testing"
 )
 
@@ -37,3 +39,300 @@ func TestPanickedReader(test *testing.T) {
 	assert.Zero(mimeType)
 	assert.EqualError(err, "decode err: mock reader error")
 }
+
+func TestTextEncodeBool(test *testing.T) {
+	engine := createEngine(test)
+
+	trueValue := true
+
+	cases := []struct {
+		content  interface{}
+		expected string
+	}{
+		{true, "true"},
+		{false, "false"},
+		{&trueValue, "true"},
+	}
+
+	for _, thisCase := range cases {
+		buffer := &bytes.Buffer{}
+
+		mimeType, err := engine.Encode(mimetype.TEXT, thisCase.content, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		assert.Equal(test, mimetype.TEXT, mimeType)
+		assert.Equal(test, thisCase.expected, buffer.String())
+	}
+}
+
+func TestTextEncodeNil(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	var nilString *string
+
+	for _, content := range []interface{}{nil, nilString} {
+		buffer := &bytes.Buffer{}
+
+		_, err := engine.Encode(mimetype.TEXT, content, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+		assert.Equal("", buffer.String())
+	}
+
+	engine.SetTextNil("null")
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.TEXT, nil, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal("null", buffer.String())
+}
+
+func TestTextDecodeBool(test *testing.T) {
+	engine := createEngine(test)
+
+	for _, expected := range []bool{true, false} {
+		buffer := &bytes.Buffer{}
+		_, err := engine.Encode(mimetype.TEXT, expected, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		loaded := !expected
+		mimeType, err := engine.Decode(mimetype.TEXT, &loaded, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		assert.Equal(test, mimetype.TEXT, mimeType)
+		assert.Equal(test, expected, loaded)
+	}
+}
+
+func TestTextDecodeBoolError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	loaded := false
+	mimeType, err := engine.Decode(
+		mimetype.TEXT, &loaded, bytes.NewBufferString("yes"),
+	)
+
+	assert.Zero(mimeType)
+	assert.EqualError(err, "decode err: text 'yes' is not a valid boolean")
+}
+
+func TestTextDecodeEmpty(test *testing.T) {
+	engine := createEngine(test)
+
+	loaded := "not empty"
+	_, err := engine.Decode(mimetype.TEXT, &loaded, &bytes.Buffer{})
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(test, "", loaded)
+}
+
+func TestTextTrimWhitespace(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Trim     bool
+		Expected string
+	}{
+		{Name: "Off", Trim: false, Expected: "hello\n"},
+		{Name: "On", Trim: true, Expected: "hello"},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			engine := createSpanEngine(subTest)
+			engine.SetTrimTextWhitespace(thisCase.Trim)
+
+			var loaded string
+			mimeType, err := engine.Decode(
+				mimetype.TEXT, &loaded, strings.NewReader("hello\n"),
+			)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			assert.Equal(mimetype.TEXT, mimeType)
+			assert.Equal(thisCase.Expected, loaded)
+		})
+	}
+}
+
+func TestTextTrimWhitespaceBool(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetTrimTextWhitespace(true)
+
+	var loaded bool
+	_, err := engine.Decode(mimetype.TEXT, &loaded, strings.NewReader(" true\r\n"))
+	assert.Nil(err)
+	assert.True(loaded)
+}
+
+// Marshals itself to text as "house:<name>".
+type TextHouse struct {
+	Name string
+}
+
+func (house TextHouse) MarshalText() ([]byte, error) {
+	if house.Name == "" {
+		return nil, xerrors.New("house has no name")
+	}
+	return []byte("house:" + house.Name), nil
+}
+
+func (house *TextHouse) UnmarshalText(text []byte) error {
+	if !strings.HasPrefix(string(text), "house:") {
+		return xerrors.Errorf("'%s' is not a house", text)
+	}
+	house.Name = strings.TrimPrefix(string(text), "house:")
+	return nil
+}
+
+func TestTextEncodeTextMarshaler(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	contents := []interface{}{TextHouse{"Gryffindor"}, &TextHouse{"Gryffindor"}}
+	for _, content := range contents {
+		buffer := &bytes.Buffer{}
+		_, err := engine.Encode(mimetype.TEXT, content, buffer)
+		assert.Nil(err)
+		assert.Equal("house:Gryffindor", buffer.String())
+	}
+
+	_, err := engine.Encode(mimetype.TEXT, TextHouse{}, &bytes.Buffer{})
+	assert.EqualError(err, "encode err: house has no name")
+}
+
+func TestTextDecodeTextUnmarshaler(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetTrimTextWhitespace(true)
+
+	house := TextHouse{}
+	mimeType, err := engine.Decode(
+		mimetype.TEXT, &house, strings.NewReader(" house:Ravenclaw\n"),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.TEXT, mimeType)
+	assert.Equal(TextHouse{"Ravenclaw"}, house)
+
+	_, err = engine.Decode(mimetype.TEXT, &house, strings.NewReader("Azkaban"))
+	assert.EqualError(err, "decode err: 'Azkaban' is not a house")
+}
+
+func TestTextDecodeUnsupportedReceiver(test *testing.T) {
+	engine := createEngine(test)
+
+	_, err := engine.Decode(mimetype.TEXT, new(int), strings.NewReader("1"))
+	assert.EqualError(
+		test,
+		err,
+		"decode err: content receiver must be a string pointer to receive a string, "+
+			"or a bool pointer to receive a bool.",
+	)
+}
+
+// Amount of money in cents.
+type Money int
+
+func formatMoney(content interface{}) (string, error) {
+	cents := int(content.(Money))
+	if cents < 0 {
+		return "", xerrors.New("money cannot be negative")
+	}
+	return fmt.Sprintf("$%d.%02d", cents/100, cents%100), nil
+}
+
+func parseMoney(text string) (interface{}, error) {
+	var dollars, cents int
+	if _, err := fmt.Sscanf(text, "$%d.%d", &dollars, &cents); err != nil {
+		return nil, xerrors.Errorf("'%v' is not money: %w", text, err)
+	}
+	return Money(dollars*100 + cents), nil
+}
+
+func TestTextFormatter(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.RegisterTextFormatter(reflect.TypeOf(Money(0)), formatMoney)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.TEXT, Money(1234), buffer)
+	assert.Nil(err)
+	assert.Equal("$12.34", buffer.String())
+
+	// Only the exact type is matched.
+	money := Money(1234)
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.TEXT, &money, buffer)
+	assert.Nil(err)
+	assert.NotEqual("$12.34", buffer.String())
+
+	_, err = engine.Encode(mimetype.TEXT, Money(-1), &bytes.Buffer{})
+	assert.EqualError(err, "encode err: money cannot be negative")
+
+	// Clones keep the formatter, removing it leaves the clone unchanged.
+	clone := engine.Clone()
+	engine.RegisterTextFormatter(reflect.TypeOf(Money(0)), nil)
+
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.TEXT, Money(1234), buffer)
+	assert.Nil(err)
+	assert.Equal("1234", buffer.String())
+
+	buffer.Reset()
+	_, err = clone.Encode(mimetype.TEXT, Money(1234), buffer)
+	assert.Nil(err)
+	assert.Equal("$12.34", buffer.String())
+}
+
+func TestTextParser(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.RegisterTextParser(reflect.TypeOf(Money(0)), parseMoney)
+
+	money := Money(0)
+	_, err := engine.Decode(mimetype.TEXT, &money, strings.NewReader("$12.34"))
+	assert.Nil(err)
+	assert.Equal(Money(1234), money)
+
+	_, err = engine.Decode(mimetype.TEXT, &money, strings.NewReader("twelve"))
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "'twelve' is not money")
+	}
+
+	engine.RegisterTextParser(reflect.TypeOf(Money(0)), nil)
+	_, err = engine.Decode(mimetype.TEXT, &money, strings.NewReader("$12.34"))
+	assert.Error(err)
+}
+
+func TestTextParserWrongType(test *testing.T) {
+	engine := createSpanEngine(test)
+	engine.RegisterTextParser(
+		reflect.TypeOf(Money(0)),
+		func(text string) (interface{}, error) { return text, nil },
+	)
+
+	money := Money(0)
+	_, err := engine.Decode(mimetype.TEXT, &money, strings.NewReader("$12.34"))
+	assert.EqualError(
+		test,
+		err,
+		"decode err: text parser returned string, which cannot be set on *tests.Money",
+	)
+}
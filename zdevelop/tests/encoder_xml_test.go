@@ -0,0 +1,195 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spantypes"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestXMLBasicRoundTrip(test *testing.T) {
+	RoundTripName(test, mimetype.XML, mimetype.XML)
+}
+
+func TestXMLEncodeStruct(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.XML, Name{First: "Harry", Last: "Potter"}, buffer)
+	assert.Nil(err)
+	assert.Equal(
+		"<Name><First>Harry</First><Last>Potter</Last></Name>", buffer.String(),
+	)
+}
+
+func TestXMLListRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{
+		{First: "Harry", Last: "Potter"},
+		{First: "Hermione", Last: "Granger"},
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.XML, data, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.XML, mimeType)
+	assert.Equal(
+		"<list>"+
+			"<Name><First>Harry</First><Last>Potter</Last></Name>"+
+			"<Name><First>Hermione</First><Last>Granger</Last></Name>"+
+			"</list>",
+		buffer.String(),
+	)
+
+	var loaded []Name
+	_, err = engine.Decode(mimetype.XML, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(data, loaded)
+}
+
+func TestXMLListRoot(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	assert.Equal("list", engine.XMLListRoot())
+
+	engine.SetXMLListRoot("names")
+	assert.Equal("names", engine.XMLListRoot())
+	assert.Equal("names", engine.Clone().XMLListRoot())
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.XML, []Name{{First: "Harry"}}, buffer)
+	assert.Nil(err)
+	assert.Equal(
+		"<names><Name><First>Harry</First><Last></Last></Name></names>",
+		buffer.String(),
+	)
+
+	engine.SetXMLListRoot("")
+	assert.Equal("list", engine.XMLListRoot())
+}
+
+func TestXMLListDecodeAnyRoot(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := `<?xml version="1.0"?>
+<students>
+	<Name><First>Harry</First></Name>
+	<!-- Ron is late. -->
+	<Name><First>Ron</First></Name>
+</students>`
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.XML, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal([]Name{{First: "Harry"}, {First: "Ron"}}, loaded)
+}
+
+func TestXMLListEmpty(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.XML, []Name{}, buffer)
+	assert.Nil(err)
+	assert.Equal("<list></list>", buffer.String())
+
+	var loaded []Name
+	_, err = engine.Decode(mimetype.XML, &loaded, buffer)
+	assert.Nil(err)
+	assert.Empty(loaded)
+}
+
+func TestXMLListNoRoot(test *testing.T) {
+	engine := createEngine(test)
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.XML, &loaded, strings.NewReader("  "))
+	assert.EqualError(test, err, "decode err: xml content has no root element")
+}
+
+func TestXMLMaxListElements(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetMaxListElements(1)
+
+	content := "<list><Name><First>Harry</First></Name><Name></Name></list>"
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.XML, &loaded, strings.NewReader(content))
+	assert.Error(err)
+}
+
+type XMLWizard struct {
+	Id    uuid.UUID         `xml:"id,attr"`
+	Name  string            `xml:"name"`
+	Wand  spantypes.BinData `xml:"wand"`
+	House string            `xml:"house,omitempty"`
+}
+
+func TestXMLUUIDAndBinData(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	wizard := XMLWizard{
+		Id:   uuid.NewV4(),
+		Name: "Harry",
+		Wand: spantypes.BinData{0xde, 0xad, 0xbe, 0xef},
+	}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.XML, wizard, buffer)
+	assert.Nil(err)
+
+	// UUIDs and BinData are written as their text, like in json.
+	assert.Equal(
+		`<XMLWizard id="`+wizard.Id.String()+`">`+
+			"<name>Harry</name><wand>deadbeef</wand></XMLWizard>",
+		buffer.String(),
+	)
+
+	loaded := XMLWizard{}
+	_, err = engine.Decode(mimetype.XML, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(wizard, loaded)
+}
+
+func TestXMLSniff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "\n<Name><First>Harry</First><Last>Potter</Last></Name>"
+
+	loaded := Name{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(content),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.XML, mimeType)
+	assert.Equal(Name{First: "Harry", Last: "Potter"}, loaded)
+}
+
+func TestXMLSniffTagHint(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := `<XMLWizard id="` + uuid.NewV4().String() + `">` +
+		"<name>Harry</name></XMLWizard>"
+
+	loaded := XMLWizard{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(content),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.XML, mimeType)
+	assert.Equal("Harry", loaded.Name)
+}
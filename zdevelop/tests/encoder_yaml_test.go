@@ -0,0 +1,141 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spantypes"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestYAMLBasicRoundTrip(test *testing.T) {
+	RoundTripName(test, mimetype.YAML, mimetype.YAML)
+}
+
+func TestYAMLListRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	data := []Name{
+		{First: "Harry", Last: "Potter"},
+		{First: "Hermione", Last: "Granger"},
+		{First: "Ron", Last: "Weasley"},
+	}
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.YAML, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.YAML, mimeType)
+
+	// Each element is written as its own document.
+	assert.Equal(2, strings.Count(buffer.String(), "---\n"))
+
+	var loaded []Name
+	mimeType, err = engine.Decode(mimetype.YAML, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.YAML, mimeType)
+	assert.Equal(data, loaded)
+}
+
+func TestYAMLDecodeSequenceDocument(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "- first: Harry\n- first: Hermione\n"
+
+	var loaded []Name
+	_, err := engine.Decode(mimetype.YAML, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal([]Name{{First: "Harry"}, {First: "Hermione"}}, loaded)
+}
+
+func TestYAMLBinDataAndUUID(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	type Receiver struct {
+		Id   uuid.UUID
+		Data spantypes.BinData
+	}
+
+	data := Receiver{Id: uuid.NewV4(), Data: spantypes.BinData("Test Data.")}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.YAML, data, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// Represented as strings, matching json.
+	assert.Contains(buffer.String(), "id: "+data.Id.String())
+	assert.Contains(buffer.String(), "data: 5465737420446174612e")
+
+	loaded := Receiver{}
+	_, err = engine.Decode(mimetype.YAML, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(data, loaded)
+}
+
+func TestYAMLDecodeInterfaceMaps(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "name:\n  first: Harry\nhouses:\n- house: Gryffindor\n"
+
+	var loaded interface{}
+	_, err := engine.Decode(mimetype.YAML, &loaded, strings.NewReader(content))
+	assert.Nil(err)
+	assert.Equal(
+		map[string]interface{}{
+			"name": map[string]interface{}{"first": "Harry"},
+			"houses": []interface{}{
+				map[string]interface{}{"house": "Gryffindor"},
+			},
+		},
+		loaded,
+	)
+}
+
+func TestYAMLSniffed(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	content := "first: Harry\nlast: Potter\n"
+
+	loaded := Name{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(content),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.YAML, mimeType)
+	assert.Equal(Name{First: "Harry", Last: "Potter"}, loaded)
+}
+
+func TestYAMLDuration(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	spell := Spell{Name: "Protego", Duration: 90 * time.Minute}
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.YAML, spell, buffer)
+	assert.Nil(err)
+	assert.Equal("name: Protego\nduration: 1h30m0s\n", buffer.String())
+
+	loaded := Spell{}
+	_, err = engine.Decode(mimetype.YAML, &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(spell, loaded)
+}
@@ -0,0 +1,173 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// Compresses content with the compressor newWriter returns.
+func compressContent(
+	test *testing.T, content string, newWriter func(io.Writer) io.WriteCloser,
+) []byte {
+	buffer := &bytes.Buffer{}
+	compressor := newWriter(buffer)
+	if _, err := compressor.Write([]byte(content)); err != nil {
+		test.Fatal(err)
+	}
+	if err := compressor.Close(); err != nil {
+		test.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func newGzipWriter(writer io.Writer) io.WriteCloser {
+	return gzip.NewWriter(writer)
+}
+
+func newZlibWriter(writer io.Writer) io.WriteCloser {
+	return zlib.NewWriter(writer)
+}
+
+func newIdentityWriter(writer io.Writer) io.WriteCloser {
+	return &nopWriteCloser{writer}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestDecodeWithEncoding(test *testing.T) {
+	testCases := []struct {
+		Name            string
+		ContentEncoding string
+		NewWriter       func(io.Writer) io.WriteCloser
+	}{
+		{"Gzip", "gzip", newGzipWriter},
+		{"LegacyGzip", "x-gzip", newGzipWriter},
+		{"IgnoresCase", " GZIP ", newGzipWriter},
+		{"Deflate", "deflate", newZlibWriter},
+		{"Identity", "identity", newIdentityWriter},
+		{"Blank", "", newIdentityWriter},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			engine := createSpanEngine(subTest)
+			content := compressContent(subTest, "Harry Potter", thisCase.NewWriter)
+
+			loaded := ""
+			mimeType, err := engine.DecodeWithEncoding(
+				mimetype.TEXT, thisCase.ContentEncoding, &loaded, bytes.NewReader(content),
+			)
+			assert.Nil(subTest, err)
+			assert.Equal(subTest, mimetype.TEXT, mimeType)
+			assert.Equal(subTest, "Harry Potter", loaded)
+		})
+	}
+}
+
+func TestEncodeWithEncoding(test *testing.T) {
+	testCases := []struct {
+		Name            string
+		ContentEncoding string
+		NewReader       func(io.Reader) (io.Reader, error)
+	}{
+		{
+			"Gzip",
+			"gzip",
+			func(reader io.Reader) (io.Reader, error) { return gzip.NewReader(reader) },
+		},
+		{
+			"Deflate",
+			"deflate",
+			func(reader io.Reader) (io.Reader, error) { return zlib.NewReader(reader) },
+		},
+		{
+			"Identity",
+			"",
+			func(reader io.Reader) (io.Reader, error) { return reader, nil },
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			buffer := &bytes.Buffer{}
+			mimeType, err := engine.EncodeWithEncoding(
+				mimetype.TEXT, thisCase.ContentEncoding, "Harry Potter", buffer,
+			)
+			assert.Nil(err)
+			assert.Equal(mimetype.TEXT, mimeType)
+
+			decompressor, err := thisCase.NewReader(buffer)
+			if !assert.Nil(err) {
+				subTest.FailNow()
+			}
+			content, err := ioutil.ReadAll(decompressor)
+			assert.Nil(err)
+			assert.Equal("Harry Potter", string(content))
+		})
+	}
+}
+
+func TestContentEncodingUnsupported(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	reader := strings.NewReader("Harry Potter")
+	_, err := engine.DecodeWithEncoding(mimetype.TEXT, "br", new(string), reader)
+
+	unsupported := &encoding.UnsupportedEncodingError{}
+	assert.True(xerrors.As(err, &unsupported))
+	assert.Equal("br", unsupported.ContentEncoding)
+	assert.EqualError(err, "unsupported content encoding: 'br'")
+	assert.Equal(len("Harry Potter"), reader.Len())
+
+	buffer := &bytes.Buffer{}
+	_, err = engine.EncodeWithEncoding(mimetype.TEXT, "br", "Harry Potter", buffer)
+	assert.True(xerrors.As(err, &unsupported))
+	assert.Zero(buffer.Len())
+}
+
+func TestDecodeWithEncodingCorrupt(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	_, err := engine.DecodeWithEncoding(
+		mimetype.TEXT, "gzip", new(string), strings.NewReader("Harry Potter"),
+	)
+	assert.True(xerrors.Is(err, gzip.ErrHeader))
+}
+
+func TestDecodeWithEncodingMaxBytes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetMaxDecodeBytes(16)
+
+	// The limit applies to the decompressed content.
+	content := compressContent(test, strings.Repeat("a", 1<<10), newGzipWriter)
+
+	_, err := engine.DecodeWithEncoding(
+		mimetype.TEXT, "gzip", new(string), bytes.NewReader(content),
+	)
+	tooLarge := &encoding.PayloadTooLargeError{}
+	assert.True(xerrors.As(err, &tooLarge))
+}
@@ -0,0 +1,80 @@
+//go:build go1.18
+
+package tests
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"testing"
+)
+
+// Mimetypes registered by default on a new engine, which the fuzzer decodes against.
+var fuzzMimeTypes = []mimetype.MimeType{
+	mimetype.JSON,
+	mimetype.BSON,
+	mimetype.TEXT,
+	mimetype.GOB,
+	mimetype.NDJSON,
+	mimetype.UNKNOWN,
+}
+
+// Returns fresh receivers of each shape the fuzzer decodes into.
+func fuzzReceivers() []interface{} {
+	return []interface{}{
+		&Name{},
+		&[]Name{},
+		&map[string]interface{}{},
+		new(string),
+		new(bool),
+	}
+}
+
+/*
+FuzzDecode feeds arbitrary bytes to Decode for every default mimetype and receiver
+shape. Malformed content must always come back as an error: a panic that escapes the
+engine fails the fuzzer.
+
+The seed corpus is built below from valid encodings of a Name value, plus a few
+truncated and empty inputs. Run the fuzzer with:
+
+	go test ./zdevelop/tests -run '^$' -fuzz FuzzDecode
+
+Any failing input the fuzzer finds is written to testdata/fuzz/FuzzDecode in this
+directory. Commit those files alongside the fix so the case is re-run as a regular test
+by every future "go test".
+*/
+func FuzzDecode(fuzz *testing.F) {
+	engine, err := encoding.NewContentEngine(true)
+	if err != nil {
+		fuzz.Fatal(err)
+	}
+
+	fuzz.Add([]byte{})
+	fuzz.Add([]byte("true"))
+	fuzz.Add([]byte("{"))
+
+	seed := Name{First: "Harry", Last: "Potter"}
+	for _, mimeType := range fuzzMimeTypes[:len(fuzzMimeTypes)-1] {
+		buffer := &bytes.Buffer{}
+		_, err := engine.Encode(mimeType, seed, buffer)
+		if err != nil {
+			continue
+		}
+		fuzz.Add(buffer.Bytes())
+		fuzz.Add(buffer.Bytes()[:buffer.Len()/2])
+	}
+
+	fuzz.Fuzz(func(test *testing.T, data []byte) {
+		for _, mimeType := range fuzzMimeTypes {
+			for _, receiver := range fuzzReceivers() {
+				decodedType, err := engine.Decode(
+					mimeType, receiver, bytes.NewReader(data),
+				)
+				if err == nil && decodedType == mimetype.UNKNOWN {
+					test.Errorf("decode of %v returned no error or mimetype", mimeType)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,385 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStreamGzipBSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	count := 5000
+	data := make([]Name, count)
+	for i := range data {
+		data[i] = Name{First: fmt.Sprintf("Wizard %v", i), Last: "Potter"}
+	}
+
+	encoded := new(bytes.Buffer)
+	_, err := engine.Encode(mimetype.BSON, data, encoded)
+	if !assert.Nil(err) {
+		return
+	}
+
+	compressed := new(bytes.Buffer)
+	gzipWriter := gzip.NewWriter(compressed)
+	_, err = gzipWriter.Write(encoded.Bytes())
+	assert.Nil(err)
+	assert.Nil(gzipWriter.Close())
+
+	gzipReader, err := gzip.NewReader(compressed)
+	if !assert.Nil(err) {
+		return
+	}
+
+	calls := 0
+	err = engine.DecodeStream(
+		mimetype.BSON,
+		gzipReader,
+		Name{},
+		func(element interface{}) error {
+			assert.Equal(&data[calls], element)
+			calls++
+			return nil
+		},
+	)
+
+	assert.Nil(err)
+	assert.Equal(count, calls)
+}
+
+func TestDecodeStreamJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := `[{"first": "Harry"}, {"first": "Hermione"}, {"first": "Ron"}]`
+
+	var received []string
+	err := engine.DecodeStream(
+		mimetype.JSON,
+		strings.NewReader(content),
+		&Name{},
+		func(element interface{}) error {
+			received = append(received, element.(*Name).First)
+			return nil
+		},
+	)
+
+	assert.Nil(err)
+	assert.Equal([]string{"Harry", "Hermione", "Ron"}, received)
+}
+
+func TestDecodeStreamCallbackError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	calls := 0
+	err := engine.DecodeStream(
+		mimetype.JSON,
+		strings.NewReader(`[{"first": "Harry"}, {"first": "Hermione"}]`),
+		Name{},
+		func(element interface{}) error {
+			calls++
+			return fmt.Errorf("stop")
+		},
+	)
+
+	assert.EqualError(err, "stop")
+	assert.Equal(1, calls)
+}
+
+func TestDecodeStreamErrors(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		MimeType mimetype.MimeType
+		Content  []byte
+		Example  interface{}
+		ErrorMsg string
+	}{
+		{
+			Name:     "NotList",
+			MimeType: mimetype.JSON,
+			Content:  []byte(`{"first": "Harry"}`),
+			Example:  Name{},
+			ErrorMsg: "decode err: json content is not a list",
+		},
+		{
+			Name:     "TruncatedBSON",
+			MimeType: mimetype.BSON,
+			Content:  []byte{0x20, 0x00, 0x00, 0x00, 0x02},
+			Example:  Name{},
+			ErrorMsg: "decode err: error reading bson document:",
+		},
+		{
+			Name:     "NilExample",
+			MimeType: mimetype.JSON,
+			Content:  []byte("[]"),
+			Example:  nil,
+			ErrorMsg: "stream element example cannot be nil",
+		},
+		{
+			Name:     "Unsupported",
+			MimeType: mimetype.TEXT,
+			Content:  []byte("Harry"),
+			Example:  "",
+			ErrorMsg: "stream decoding not supported for text/plain",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			engine := createSpanEngine(subTest)
+			err := engine.DecodeStream(
+				thisCase.MimeType,
+				bytes.NewReader(thisCase.Content),
+				thisCase.Example,
+				func(element interface{}) error { return nil },
+			)
+			if assert.Error(subTest, err) {
+				assert.Contains(subTest, err.Error(), thisCase.ErrorMsg)
+			}
+		})
+	}
+}
+
+func TestDecodeStreamEmpty(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	err := engine.DecodeStream(
+		mimetype.BSON,
+		bytes.NewReader(nil),
+		Name{},
+		func(element interface{}) error {
+			test.Error("unexpected element")
+			return nil
+		},
+	)
+	assert.Nil(err)
+}
+
+type FactoryWizard struct {
+	Type string `json:"type" bson:"type"`
+	Name string `json:"name" bson:"name"`
+}
+
+type FactoryOwl struct {
+	Type  string `json:"type" bson:"type"`
+	Color string `json:"color" bson:"color"`
+}
+
+// Returns the receiver for a list element by the value of its "type" field.
+func newFactoryElement(discriminator string) interface{} {
+	switch discriminator {
+	case "wizard":
+		return &FactoryWizard{}
+	case "owl":
+		return &FactoryOwl{}
+	}
+	return nil
+}
+
+func jsonElementFactory(peek []byte) interface{} {
+	discriminator := struct {
+		Type string `json:"type"`
+	}{}
+	_ = json.Unmarshal(peek, &discriminator)
+	return newFactoryElement(discriminator.Type)
+}
+
+func bsonElementFactory(peek []byte) interface{} {
+	discriminator, _ := bson.Raw(peek).Lookup("type").StringValueOK()
+	return newFactoryElement(discriminator)
+}
+
+var factoryElements = []interface{}{
+	&FactoryWizard{Type: "wizard", Name: "Harry"},
+	&FactoryOwl{Type: "owl", Color: "white"},
+	&FactoryWizard{Type: "wizard", Name: "Hermione"},
+}
+
+func TestDecodeManyFactoryJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := `[
+		{"type": "wizard", "name": "Harry"},
+		{"type": "owl", "color": "white"},
+		{"type": "wizard", "name": "Hermione"}
+	]`
+
+	var received []interface{}
+	err := engine.DecodeManyFactory(
+		mimetype.JSON,
+		strings.NewReader(content),
+		jsonElementFactory,
+		func(element interface{}) { received = append(received, element) },
+	)
+
+	assert.Nil(err)
+	assert.Equal(factoryElements, received)
+}
+
+func TestDecodeManyFactoryBSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	encoded := new(bytes.Buffer)
+	_, err := engine.Encode(mimetype.BSON, factoryElements, encoded)
+	if !assert.Nil(err) {
+		return
+	}
+
+	var received []interface{}
+	err = engine.DecodeManyFactory(
+		mimetype.BSON,
+		encoded,
+		bsonElementFactory,
+		func(element interface{}) { received = append(received, element) },
+	)
+
+	assert.Nil(err)
+	assert.Equal(factoryElements, received)
+}
+
+func TestDecodeManyFactoryNoReceiver(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := `[{"type": "wizard", "name": "Harry"}, {"type": "dragon"}]`
+
+	var received []interface{}
+	err := engine.DecodeManyFactory(
+		mimetype.JSON,
+		strings.NewReader(content),
+		jsonElementFactory,
+		func(element interface{}) { received = append(received, element) },
+	)
+
+	assert.EqualError(err, "decode err: no receiver for element 1")
+	assert.Len(received, 1)
+}
+
+func TestDecodeStreamNDJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := "{\"first\": \"Harry\"}\n\n{\"first\": \"Hermione\"}\n"
+
+	var received []string
+	err := engine.DecodeStream(
+		mimetype.NDJSON,
+		strings.NewReader(content),
+		Name{},
+		func(element interface{}) error {
+			received = append(received, element.(*Name).First)
+			return nil
+		},
+	)
+
+	assert.Nil(err)
+	assert.Equal([]string{"Harry", "Hermione"}, received)
+}
+
+func TestTranscodeStreamBSONToNDJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	count := 1000
+	data := make([]Name, count)
+	for i := range data {
+		data[i] = Name{First: fmt.Sprintf("Wizard %v", i), Last: "Potter"}
+	}
+
+	encoded := new(bytes.Buffer)
+	_, err := engine.Encode(mimetype.BSON, data, encoded)
+	if !assert.Nil(err) {
+		return
+	}
+
+	ndjson := new(bytes.Buffer)
+	err = engine.TranscodeStream(mimetype.BSON, mimetype.NDJSON, encoded, ndjson)
+	if !assert.Nil(err) {
+		return
+	}
+	assert.Equal(count, strings.Count(ndjson.String(), "\n"))
+
+	var fromNDJSON []Name
+	_, err = engine.Decode(mimetype.NDJSON, &fromNDJSON, bytes.NewReader(ndjson.Bytes()))
+	assert.Nil(err)
+	assert.Equal(data, fromNDJSON)
+
+	// And back again.
+	bsonList := new(bytes.Buffer)
+	err = engine.TranscodeStream(mimetype.NDJSON, mimetype.BSON, ndjson, bsonList)
+	if !assert.Nil(err) {
+		return
+	}
+
+	var fromBSON []Name
+	_, err = engine.Decode(mimetype.BSON, &fromBSON, bsonList)
+	assert.Nil(err)
+	assert.Equal(data, fromBSON)
+}
+
+func TestTranscodeStreamJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	content := "{\"first\": \"Harry\"}\n{\"first\": \"Ron\"}\n"
+
+	buffer := new(bytes.Buffer)
+	err := engine.TranscodeStream(
+		mimetype.NDJSON, mimetype.JSON, strings.NewReader(content), buffer,
+	)
+	assert.Nil(err)
+	assert.Equal(`[{"first":"Harry"},{"first":"Ron"}]`, buffer.String())
+
+	buffer.Reset()
+	err = engine.TranscodeStream(
+		mimetype.NDJSON, mimetype.JSON, strings.NewReader(""), buffer,
+	)
+	assert.Nil(err)
+	assert.Equal("[]", buffer.String())
+}
+
+func TestTranscodeStreamNDJSONIndent(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetJSONIndent("", "  ")
+
+	content := `[{"first": "Harry"}, {"pets": ["Hedwig"]}]`
+
+	// Each element stays on its own line, as NDJSON requires.
+	buffer := new(bytes.Buffer)
+	err := engine.TranscodeStream(
+		mimetype.JSON, mimetype.NDJSON, strings.NewReader(content), buffer,
+	)
+	assert.Nil(err)
+	assert.Equal("{\"first\":\"Harry\"}\n{\"pets\":[\"Hedwig\"]}\n", buffer.String())
+}
+
+func TestTranscodeStreamUnsupported(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	err := engine.TranscodeStream(
+		mimetype.JSON, mimetype.TEXT, strings.NewReader("[]"), new(bytes.Buffer),
+	)
+	assert.EqualError(err, "stream encoding not supported for text/plain")
+
+	err = engine.TranscodeStream(
+		mimetype.TEXT, mimetype.JSON, strings.NewReader("Harry"), new(bytes.Buffer),
+	)
+	assert.EqualError(err, "stream decoding not supported for text/plain")
+}
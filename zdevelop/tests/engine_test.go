@@ -6,14 +6,24 @@ package tests
 import (
 	"bou.ke/monkey"
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/ugorji/go/codec"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
 	"golang.org/x/xerrors"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"github.com/illuscio-dev/spantools-go/encoding"
 	"github.com/illuscio-dev/spantools-go/mimetype"
+	uuid "github.com/satori/go.uuid"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -37,6 +47,11 @@ func (encoder *PanickyEncoder) Decode(
 }
 
 func createEngine(test *testing.T) encoding.ContentEngine {
+	return createSpanEngine(test)
+}
+
+// Returns the concrete engine for tests that need to change engine-level settings.
+func createSpanEngine(test *testing.T) *encoding.SpanEngine {
 	engine, err := encoding.NewContentEngine(true)
 	if err != nil {
 		test.Error(err)
@@ -59,6 +74,11 @@ func TestCreateEngineDefault(test *testing.T) {
 	assert.Equal(true, engine.Handles(mimetype.JSON))
 	assert.Equal(true, engine.Handles(mimetype.BSON))
 	assert.Equal(true, engine.Handles(mimetype.TEXT))
+	assert.Equal(true, engine.Handles(mimetype.YAML))
+	assert.Equal(true, engine.Handles(mimetype.FORM))
+	assert.Equal(true, engine.Handles(mimetype.NDJSON))
+	assert.Equal(true, engine.Handles(mimetype.XML))
+	assert.Equal(true, engine.Handles(mimetype.MSGPACK))
 
 	assert.Equal(false, engine.Handles(mimetype.MimeType("text/csv")))
 
@@ -305,6 +325,69 @@ func TestSniffFailsError(test *testing.T) {
 	)
 }
 
+func TestDecodeSniff(test *testing.T) {
+	testCases := []struct {
+		Content  string
+		MimeType mimetype.MimeType
+	}{
+		{Content: `{"First": "Harry"}`, MimeType: mimetype.JSON},
+		{Content: "<Name><First>Harry</First></Name>", MimeType: mimetype.XML},
+		{Content: "First: Harry", MimeType: mimetype.YAML},
+	}
+
+	engine := createSpanEngine(test)
+
+	for _, thisCase := range testCases {
+		test.Run(string(thisCase.MimeType), func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			loaded := Name{}
+			mimeType, err := engine.DecodeSniff(
+				&loaded, strings.NewReader(thisCase.Content),
+			)
+			assert.Nil(err)
+			assert.Equal(thisCase.MimeType, mimeType)
+			assert.Equal("Harry", loaded.First)
+		})
+	}
+}
+
+func TestDecodeSniffFails(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	mimeType, err := engine.DecodeSniff(&Name{}, strings.NewReader("not a name"))
+	assert.Equal(mimetype.UNKNOWN, mimeType)
+
+	sniffErr := &encoding.SniffError{}
+	if assert.True(xerrors.As(err, &sniffErr)) {
+		assert.Error(sniffErr.Attempts()[mimetype.JSON])
+		assert.Error(sniffErr.Attempts()[mimetype.YAML])
+	}
+}
+
+func TestSniffErrorAttempts(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	receiver := &Name{}
+	_, err := engine.Decode(
+		mimetype.UNKNOWN, receiver, bytes.NewBufferString("not json or bson"),
+	)
+
+	sniffErr := &encoding.SniffError{}
+	if !assert.True(xerrors.As(err, &sniffErr)) {
+		return
+	}
+
+	attempts := sniffErr.Attempts()
+	assert.Error(attempts[mimetype.JSON])
+	assert.Error(attempts[mimetype.BSON])
+	assert.Contains(err.Error(), "could not sniff content: ")
+	assert.Contains(err.Error(), string(mimetype.JSON)+": ")
+	assert.Contains(err.Error(), string(mimetype.BSON)+": ")
+}
+
 func TestSniffErrorReadingBytes(test *testing.T) {
 	assert := assert.New(test)
 
@@ -482,3 +565,1807 @@ func TestExtendEngine(test *testing.T) {
 		"MyAwesomeApp says: 'some message'.", buffer.String(),
 	)
 }
+
+func TestExtendEngineDefaultText(test *testing.T) {
+	assert := assert.New(test)
+
+	engine, err := encoding.NewContentEngine(false)
+	if err != nil {
+		panic(err)
+	}
+
+	ourEngine := &CustomEngine{SpanEngine: engine, AppName: "MyAwesomeApp"}
+	ourEngine.SetPassedEngine(ourEngine)
+
+	// The default text encoder still works when passed a wrapped engine.
+	for _, content := range []interface{}{"some message", true, nil} {
+		buffer := new(bytes.Buffer)
+		_, err = ourEngine.Encode(mimetype.TEXT, content, buffer)
+		assert.Nil(err)
+	}
+
+	buffer := new(bytes.Buffer)
+	_, err = ourEngine.Encode(mimetype.TEXT, true, buffer)
+	assert.Nil(err)
+	assert.Equal("true", buffer.String())
+}
+
+func TestStringTransform(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetStringTransform(strings.TrimSpace)
+
+	type Wizard struct {
+		Name    *Name
+		Pets    []string
+		Details map[string]interface{}
+		house   string
+	}
+
+	data := Wizard{
+		Name:    &Name{First: "  Harry", Last: "Potter\n"},
+		Pets:    []string{" Hedwig "},
+		Details: map[string]interface{}{"wand": "\tHolly ", "age": 11},
+		house:   " Gryffindor ",
+	}
+
+	for _, mimeType := range []mimetype.MimeType{mimetype.JSON, mimetype.UNKNOWN} {
+		buffer := &bytes.Buffer{}
+		_, err := engine.Encode(mimetype.JSON, data, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		loaded := Wizard{}
+		_, err = engine.Decode(mimeType, &loaded, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		assert.Equal(&Name{First: "Harry", Last: "Potter"}, loaded.Name)
+		assert.Equal([]string{"Hedwig"}, loaded.Pets)
+		assert.Equal("Holly", loaded.Details["wand"])
+	}
+}
+
+func TestStringTransformNil(test *testing.T) {
+	engine := createSpanEngine(test)
+	engine.SetStringTransform(strings.TrimSpace)
+	engine.SetStringTransform(nil)
+
+	buffer := bytes.NewBufferString(`{"First": " Harry ", "Last": "Potter"}`)
+
+	loaded := Name{}
+	_, err := engine.Decode(mimetype.JSON, &loaded, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(test, " Harry ", loaded.First)
+}
+
+func TestSniffOnUnregistered(test *testing.T) {
+	jsonBody := `{"First": "Harry", "Last": "Potter"}`
+
+	testOptionOn := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+
+		engine := createSpanEngine(subTest)
+		engine.SetSniffOnUnregistered(true)
+		assert.True(engine.SniffOnUnregistered())
+
+		loaded := Name{}
+		mimeType, err := engine.Decode(
+			"application/json5", &loaded, bytes.NewBufferString(jsonBody),
+		)
+		if err != nil {
+			subTest.Error(err)
+		}
+
+		assert.Equal(mimetype.JSON, mimeType)
+		assert.Equal(Name{First: "Harry", Last: "Potter"}, loaded)
+	}
+
+	testOptionOff := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+
+		engine := createSpanEngine(subTest)
+		assert.False(engine.SniffOnUnregistered())
+
+		loaded := Name{}
+		mimeType, err := engine.Decode(
+			"application/json5", &loaded, bytes.NewBufferString(jsonBody),
+		)
+
+		assert.Zero(mimeType)
+		assert.EqualError(err, "no decoder for application/json5")
+	}
+
+	testSniffingDisabled := func(subTest *testing.T) {
+		assert := assert.New(subTest)
+
+		engine, err := encoding.NewContentEngine(false)
+		if err != nil {
+			subTest.Error(err)
+		}
+		engine.SetSniffOnUnregistered(true)
+
+		loaded := Name{}
+		mimeType, err := engine.Decode(
+			"application/json5", &loaded, bytes.NewBufferString(jsonBody),
+		)
+
+		assert.Zero(mimeType)
+		assert.EqualError(err, "no decoder for application/json5")
+	}
+
+	test.Run("Option On", testOptionOn)
+	test.Run("Option Off", testOptionOff)
+	test.Run("Sniffing Disabled", testSniffingDisabled)
+}
+
+// Records calls made to an encoding.Logger.
+type LogRecord struct {
+	Level     string
+	Msg       string
+	KeyValues []interface{}
+}
+
+func TestLoggerInvoked(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetSniffOnUnregistered(true)
+
+	records := make([]LogRecord, 0)
+	engine.SetLogger(func(level string, msg string, keyValues ...interface{}) {
+		records = append(records, LogRecord{level, msg, keyValues})
+	})
+
+	// Falling back to sniffing an unregistered mimetype is a non-fatal condition we
+	// should get warned about.
+	loaded := Name{}
+	_, err := engine.Decode(
+		"application/json5",
+		&loaded,
+		bytes.NewBufferString(`{"First": "Harry", "Last": "Potter"}`),
+	)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(
+		[]LogRecord{
+			{
+				Level:     encoding.LogLevelWarn,
+				Msg:       "no decoder for mimetype, falling back to sniffing",
+				KeyValues: []interface{}{"mimetype", mimetype.MimeType("application/json5")},
+			},
+		},
+		records,
+	)
+}
+
+func TestLoggerDefaultNoop(test *testing.T) {
+	engine := createSpanEngine(test)
+	engine.SetSniffOnUnregistered(true)
+	engine.SetLogger(nil)
+
+	loaded := Name{}
+	_, err := engine.Decode(
+		"application/json5",
+		&loaded,
+		bytes.NewBufferString(`{"First": "Harry", "Last": "Potter"}`),
+	)
+	if err != nil {
+		test.Error(err)
+	}
+}
+
+func TestDecodeCounting(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		MimeType mimetype.MimeType
+		Decode   mimetype.MimeType
+	}{
+		{Name: "JSON", MimeType: mimetype.JSON, Decode: mimetype.JSON},
+		{Name: "BSON", MimeType: mimetype.BSON, Decode: mimetype.BSON},
+		{Name: "Sniffed", MimeType: mimetype.JSON, Decode: mimetype.UNKNOWN},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			records := make([]LogRecord, 0)
+			engine.SetLogger(func(level string, msg string, keyValues ...interface{}) {
+				records = append(records, LogRecord{level, msg, keyValues})
+			})
+
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(
+				thisCase.MimeType, Name{First: "Harry", Last: "Potter"}, buffer,
+			)
+			if err != nil {
+				subTest.Error(err)
+			}
+			contentSize := int64(buffer.Len())
+
+			loaded := Name{}
+			mimeType, consumed, err := engine.DecodeCounting(
+				thisCase.Decode, &loaded, buffer,
+			)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			assert.Equal(thisCase.MimeType, mimeType)
+			assert.Equal(contentSize, consumed)
+			assert.Equal(
+				[]LogRecord{
+					{
+						Level:     encoding.LogLevelDebug,
+						Msg:       "decoded content",
+						KeyValues: []interface{}{"mimetype", mimeType, "bytes", consumed},
+					},
+				},
+				records,
+			)
+		})
+	}
+}
+
+func TestReadContentLength(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Offset   int64
+		Unset    bool
+		ErrorMsg string
+	}{
+		{Name: "Matching", Offset: 0},
+		{Name: "Unset", Unset: true},
+		{
+			Name:     "Short",
+			Offset:   1,
+			ErrorMsg: "content is shorter than Content-Length of %v bytes",
+		},
+		{
+			Name:     "Long",
+			Offset:   -1,
+			ErrorMsg: "content is longer than Content-Length of %v bytes",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			data := Name{First: "Harry", Last: "Potter"}
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(mimetype.JSON, data, buffer)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			contentLength := int64(buffer.Len()) + thisCase.Offset
+			if thisCase.Unset {
+				contentLength = -1
+			}
+
+			loaded := Name{}
+			mimeType, err := engine.ReadContent(
+				mimetype.JSON, &loaded, buffer, contentLength,
+			)
+
+			if thisCase.ErrorMsg != "" {
+				assert.Zero(mimeType)
+				assert.EqualError(err, fmt.Sprintf(thisCase.ErrorMsg, contentLength))
+				return
+			}
+
+			assert.Nil(err)
+			assert.Equal(mimetype.JSON, mimeType)
+			assert.Equal(data, loaded)
+		})
+	}
+}
+
+// Decoder which records the mimetypes it is called for, and succeeds unless Fail is
+// set.
+type RecordingDecoder struct {
+	MimeType mimetype.MimeType
+	Attempts *[]mimetype.MimeType
+	Fail     bool
+}
+
+func (decoder *RecordingDecoder) Decode(
+	engine encoding.ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	*decoder.Attempts = append(*decoder.Attempts, decoder.MimeType)
+	if decoder.Fail {
+		return xerrors.New("recording decoder failed")
+	}
+	return nil
+}
+
+// RecordingDecoder which declares it cannot sniff any content.
+type NoSniffDecoder struct {
+	RecordingDecoder
+}
+
+func (decoder *NoSniffDecoder) CanSniff(peek []byte) bool {
+	return false
+}
+
+type JSONTaggedName struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+func TestSniffTagHints(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Receiver interface{}
+		Expected mimetype.MimeType
+	}{
+		{Name: "JSONTags", Receiver: &JSONTaggedName{}, Expected: mimetype.JSON},
+		{
+			Name: "MostTagsWin",
+			Receiver: &struct {
+				First string `bson:"first"`
+				Last  string `bson:"last" json:"last"`
+			}{},
+			Expected: mimetype.BSON,
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			attempts := make([]mimetype.MimeType, 0)
+			for _, mimeType := range []mimetype.MimeType{
+				mimetype.JSON, mimetype.BSON, mimetype.TEXT, mimetype.GOB,
+			} {
+				engine.SetDecoder(
+					mimeType, &RecordingDecoder{MimeType: mimeType, Attempts: &attempts},
+				)
+			}
+
+			// Repeat to make sure the hint is respected every time.
+			for i := 0; i < 20; i++ {
+				mimeType, err := engine.Decode(
+					mimetype.UNKNOWN, thisCase.Receiver, strings.NewReader("{}"),
+				)
+				assert.Nil(err)
+				assert.Equal(thisCase.Expected, mimeType)
+			}
+
+			assert.Len(attempts, 20)
+		})
+	}
+}
+
+func TestSniffTagHintsDisabled(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.True(engine.SniffTagHints())
+	engine.SetSniffTagHints(false)
+	assert.False(engine.SniffTagHints())
+
+	loaded := JSONTaggedName{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(`{"first": "Harry"}`),
+	)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal("Harry", loaded.First)
+}
+
+func TestSniffOrder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Text and yaml accept most content, so go last. Form is not sniffed.
+	assert.Equal(
+		[]mimetype.MimeType{
+			mimetype.JSON, mimetype.BSON, mimetype.GOB, mimetype.NDJSON, mimetype.XML,
+			mimetype.MSGPACK, mimetype.YAML, mimetype.TEXT,
+		},
+		engine.SniffOrder(),
+	)
+
+	// New decoders are attempted in registration order.
+	attempts := make([]mimetype.MimeType, 0)
+	custom := mimetype.MimeType("text/x-custom")
+	engine.SetDecoder(custom, &RecordingDecoder{MimeType: custom, Attempts: &attempts})
+	assert.Equal(
+		[]mimetype.MimeType{
+			mimetype.JSON, mimetype.BSON, mimetype.GOB, mimetype.NDJSON, mimetype.XML,
+			mimetype.MSGPACK, custom, mimetype.YAML, mimetype.TEXT,
+		},
+		engine.SniffOrder(),
+	)
+
+	engine.SetSniffOrder([]mimetype.MimeType{custom, mimetype.TEXT, "text/csv"})
+	assert.Equal(
+		[]mimetype.MimeType{
+			custom, mimetype.TEXT, mimetype.JSON, mimetype.BSON, mimetype.GOB,
+			mimetype.NDJSON, mimetype.XML, mimetype.MSGPACK, mimetype.YAML,
+		},
+		engine.SniffOrder(),
+	)
+
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &Name{}, strings.NewReader(`{"First": "Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(custom, mimeType)
+	assert.Equal([]mimetype.MimeType{custom}, attempts)
+
+	engine.SetSniffOrder(nil)
+	assert.Equal(mimetype.JSON, engine.SniffOrder()[0])
+}
+
+func TestRemoveEncoderDecoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.RemoveEncoder(mimetype.BSON)
+	assert.False(engine.HandlesEncode(mimetype.BSON))
+	assert.True(engine.HandlesDecode(mimetype.BSON))
+
+	_, err := engine.Encode(mimetype.BSON, Name{First: "Harry"}, &bytes.Buffer{})
+	assert.EqualError(err, "no encoder for application/bson")
+
+	engine.RemoveDecoder(mimetype.BSON)
+	assert.False(engine.HandlesDecode(mimetype.BSON))
+	assert.NotContains(engine.SniffOrder(), mimetype.BSON)
+
+	// Removed decoders are not attempted when sniffing, even if asked for first.
+	engine.SetSniffOrder([]mimetype.MimeType{mimetype.BSON})
+	assert.NotContains(engine.SniffOrder(), mimetype.BSON)
+
+	_, err = engine.Decode(
+		mimetype.UNKNOWN, &Name{}, strings.NewReader("not any known format"),
+	)
+	sniffErr := &encoding.SniffError{}
+	if assert.True(xerrors.As(err, &sniffErr)) {
+		assert.NotContains(sniffErr.Attempts(), mimetype.BSON)
+	}
+
+	// Removing an unregistered mimetype does nothing.
+	engine.RemoveEncoder("text/csv")
+	engine.RemoveDecoder("text/csv")
+
+	// Re-registering goes to the end of the default order.
+	engine.SetDecoder(mimetype.BSON, &PanickyEncoder{})
+	assert.True(engine.HandlesDecode(mimetype.BSON))
+	assert.Equal(
+		[]mimetype.MimeType{
+			mimetype.BSON, mimetype.JSON, mimetype.GOB, mimetype.NDJSON, mimetype.XML,
+			mimetype.MSGPACK, mimetype.YAML, mimetype.TEXT,
+		},
+		engine.SniffOrder(),
+	)
+	engine.SetSniffOrder(nil)
+	assert.Equal(
+		[]mimetype.MimeType{
+			mimetype.JSON, mimetype.GOB, mimetype.NDJSON, mimetype.XML, mimetype.MSGPACK,
+			mimetype.BSON, mimetype.YAML, mimetype.TEXT,
+		},
+		engine.SniffOrder(),
+	)
+}
+
+func TestSniffValidatorSkipsDecoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	attempts := make([]mimetype.MimeType, 0)
+	engine.SetDecoder(
+		mimetype.TEXT,
+		&NoSniffDecoder{
+			RecordingDecoder{MimeType: mimetype.TEXT, Attempts: &attempts},
+		},
+	)
+	engine.SetDecoder(
+		mimetype.BSON,
+		&RecordingDecoder{MimeType: mimetype.BSON, Attempts: &attempts, Fail: true},
+	)
+
+	_, err := engine.Decode(
+		mimetype.UNKNOWN, &Name{}, strings.NewReader("arbitrary text"),
+	)
+
+	sniffErr := &encoding.SniffError{}
+	if !assert.True(xerrors.As(err, &sniffErr)) {
+		return
+	}
+
+	// The text decoder is never run, but its rejection is still reported.
+	assert.Equal([]mimetype.MimeType{mimetype.BSON}, attempts)
+	assert.EqualError(
+		sniffErr.Attempts()[mimetype.TEXT], "content rejected by sniff validator",
+	)
+}
+
+func TestSniffValidatorJSON(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	_, err := engine.Decode(
+		mimetype.UNKNOWN, &Name{}, strings.NewReader("First: Harry"),
+	)
+
+	sniffErr := &encoding.SniffError{}
+	if !assert.True(xerrors.As(err, &sniffErr)) {
+		return
+	}
+	assert.EqualError(
+		sniffErr.Attempts()[mimetype.JSON], "content rejected by sniff validator",
+	)
+
+	loaded := Name{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(" \n{\"First\": \"Harry\"}"),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal("Harry", loaded.First)
+}
+
+func TestMaxListElements(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		MimeType mimetype.MimeType
+		Count    int
+		ErrorMsg string
+	}{
+		{Name: "JSON At Cap", MimeType: mimetype.JSON, Count: 3},
+		{
+			Name:     "JSON Over Cap",
+			MimeType: mimetype.JSON,
+			Count:    4,
+			ErrorMsg: "decode err: list exceeds maximum of 3 elements",
+		},
+		{Name: "BSON At Cap", MimeType: mimetype.BSON, Count: 3},
+		{
+			Name:     "BSON Over Cap",
+			MimeType: mimetype.BSON,
+			Count:    4,
+			ErrorMsg: "decode err: list exceeds maximum of 3 elements",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			engine := createSpanEngine(subTest)
+			engine.SetMaxListElements(3)
+
+			names := make([]Name, thisCase.Count)
+			for i := range names {
+				names[i] = Name{First: "Harry", Last: "Potter"}
+			}
+
+			buffer := &bytes.Buffer{}
+			_, err := engine.Encode(thisCase.MimeType, names, buffer)
+			if err != nil {
+				subTest.Error(err)
+			}
+
+			loaded := make([]Name, 0)
+			mimeType, err := engine.Decode(thisCase.MimeType, &loaded, buffer)
+
+			if thisCase.ErrorMsg != "" {
+				assert.Zero(mimeType)
+				assert.EqualError(err, thisCase.ErrorMsg)
+				return
+			}
+
+			assert.Nil(err)
+			assert.Equal(thisCase.MimeType, mimeType)
+			assert.Equal(names, loaded)
+		})
+	}
+}
+
+func TestMaxListElementsRawJSON(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetMaxListElements(3)
+
+	loaded := make([]int, 0)
+	_, err := engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader("[1, [2, 3, 4, 5], 3, {}]"),
+	)
+	assert.EqualError(err, "decode err: list exceeds maximum of 3 elements")
+
+	// Nested lists are not counted against the maximum.
+	loaded = make([]int, 0)
+	_, err = engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader("[1, [2, 3, 4, 5], 3]"),
+	)
+	if err != nil {
+		assert.NotContains(err.Error(), "list exceeds maximum")
+	}
+
+	// 0 is unlimited.
+	engine.SetMaxListElements(0)
+	loaded = make([]int, 0)
+	_, err = engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader("[1, 2, 3, 4, 5]"),
+	)
+	assert.Nil(err)
+}
+
+func TestExtensionFor(test *testing.T) {
+	testCases := []struct {
+		MimeType  mimetype.MimeType
+		Extension string
+		Found     bool
+	}{
+		{MimeType: mimetype.JSON, Extension: ".json", Found: true},
+		{MimeType: mimetype.BSON, Extension: ".bson", Found: true},
+		{MimeType: mimetype.TEXT, Extension: ".txt", Found: true},
+		{MimeType: mimetype.GOB, Extension: ".gob", Found: true},
+		{MimeType: mimetype.YAML, Extension: ".yaml", Found: true},
+		{MimeType: mimetype.NDJSON, Extension: ".ndjson", Found: true},
+		{MimeType: mimetype.XML, Extension: ".xml", Found: true},
+		{MimeType: mimetype.MSGPACK, Extension: ".msgpack", Found: true},
+		{MimeType: "text/csv", Extension: "", Found: false},
+	}
+
+	engine := createSpanEngine(test)
+
+	for _, thisCase := range testCases {
+		test.Run(string(thisCase.MimeType), func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			extension, found := engine.ExtensionFor(thisCase.MimeType)
+			assert.Equal(thisCase.Extension, extension)
+			assert.Equal(thisCase.Found, found)
+		})
+	}
+}
+
+func TestExtensionForCustomEncoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Encoders which do not implement FileExtensioner have no extension.
+	engine.SetEncoder("text/csv", &PanickyEncoder{})
+
+	extension, found := engine.ExtensionFor("text/csv")
+	assert.Equal("", extension)
+	assert.False(found)
+}
+
+func TestDecodeWithCachedType(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Only BSON succeeds, so a full sniff attempts decoders until it reaches BSON.
+	attempts := make([]mimetype.MimeType, 0)
+	for _, mimeType := range []mimetype.MimeType{
+		mimetype.JSON, mimetype.BSON, mimetype.TEXT, mimetype.GOB,
+	} {
+		engine.SetDecoder(
+			mimeType,
+			&RecordingDecoder{
+				MimeType: mimeType,
+				Attempts: &attempts,
+				Fail:     mimeType != mimetype.BSON,
+			},
+		)
+	}
+
+	_, cached := engine.CachedType("client-1")
+	assert.False(cached)
+
+	mimeType, err := engine.DecodeWithCachedType(
+		"client-1", &Name{}, strings.NewReader("content"),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Contains(attempts, mimetype.BSON)
+
+	cachedType, cached := engine.CachedType("client-1")
+	assert.True(cached)
+	assert.Equal(mimetype.BSON, cachedType)
+
+	// The second call for the key goes straight to the cached type.
+	attempts = attempts[:0]
+	mimeType, err = engine.DecodeWithCachedType(
+		"client-1", &Name{}, strings.NewReader("content"),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal([]mimetype.MimeType{mimetype.BSON}, attempts)
+
+	// Other keys still sniff.
+	_, cached = engine.CachedType("client-2")
+	assert.False(cached)
+
+	engine.ForgetCachedType("client-1")
+	_, cached = engine.CachedType("client-1")
+	assert.False(cached)
+}
+
+func TestDecodeWithCachedTypeFallback(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.TEXT, "some text", buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// Cache JSON for the client, then send text which JSON cannot decode.
+	attempts := make([]mimetype.MimeType, 0)
+	engine.SetDecoder(
+		mimetype.JSON,
+		&RecordingDecoder{MimeType: mimetype.JSON, Attempts: &attempts},
+	)
+	_, err = engine.DecodeWithCachedType("client", &Name{}, strings.NewReader("{}"))
+	assert.Nil(err)
+
+	engine.SetDecoder(
+		mimetype.JSON,
+		&RecordingDecoder{MimeType: mimetype.JSON, Attempts: &attempts, Fail: true},
+	)
+
+	var loaded string
+	mimeType, err := engine.DecodeWithCachedType("client", &loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.TEXT, mimeType)
+	assert.Equal("some text", loaded)
+
+	cachedType, _ := engine.CachedType("client")
+	assert.Equal(mimetype.TEXT, cachedType)
+}
+
+// Sets a field on a *Name receiver, then fails. Never sniffed.
+type PartialDecoder struct{}
+
+func (decoder PartialDecoder) Decode(
+	engine encoding.ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	contentReceiver.(*Name).Last = "Partial"
+	return xerrors.New("partial decoder failed")
+}
+
+func (decoder PartialDecoder) CanSniff(peek []byte) bool {
+	return false
+}
+
+func TestDecodeWithCachedTypeFreshReceiver(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	_, err := engine.DecodeWithCachedType(
+		"client", &Name{}, strings.NewReader(`{"First": "Harry"}`),
+	)
+	assert.Nil(err)
+
+	// The cached JSON attempt fails part way through, and the sniff picks BSON.
+	attempts := make([]mimetype.MimeType, 0)
+	engine.SetDecoder(mimetype.JSON, PartialDecoder{})
+	engine.SetDecoder(
+		mimetype.BSON,
+		&RecordingDecoder{MimeType: mimetype.BSON, Attempts: &attempts},
+	)
+
+	loaded := &Name{}
+	mimeType, err := engine.DecodeWithCachedType(
+		"client", loaded, strings.NewReader("content"),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal("", loaded.Last)
+}
+
+// Writes []byte content to the writer as-is.
+type RawBytesEncoder struct{}
+
+func (encoder RawBytesEncoder) Encode(
+	engine encoding.ContentEngine, writer io.Writer, content interface{},
+) error {
+	_, err := writer.Write(content.([]byte))
+	return err
+}
+
+func TestSetTypeEncoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.SetTypeEncoder(reflect.TypeOf([]byte{}), RawBytesEncoder{})
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(mimetype.JSON, []byte("raw content"), buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal("raw content", buffer.String())
+
+	// Other types still use the mimetype encoder.
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.TEXT, "text content", buffer)
+	assert.Nil(err)
+	assert.Equal("text content", buffer.String())
+
+	// Removing the type encoder falls back to the mimetype encoder.
+	engine.SetTypeEncoder(reflect.TypeOf([]byte{}), nil)
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.TEXT, []byte("raw content"), buffer)
+	assert.Nil(err)
+	assert.NotEqual("raw content", buffer.String())
+}
+
+func TestCanEncode(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.Nil(engine.CanEncode(mimetype.BSON, Name{First: "Harry"}))
+
+	err := engine.CanEncode(mimetype.BSON, "top-level string")
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "encode err:")
+	}
+
+	err = engine.CanEncode("text/csv", Name{})
+	assert.EqualError(err, "no encoder for text/csv")
+}
+
+func TestMaxEncodeBytes(test *testing.T) {
+	names := make([]Name, 1000)
+	for i := range names {
+		names[i] = Name{First: "Harry", Last: "Potter"}
+	}
+
+	testCases := []struct {
+		Name     string
+		MimeType mimetype.MimeType
+		Content  interface{}
+	}{
+		{Name: "JSON", MimeType: mimetype.JSON, Content: names},
+		{Name: "BSON", MimeType: mimetype.BSON, Content: names},
+		{Name: "Text", MimeType: mimetype.TEXT, Content: strings.Repeat("a", 1000)},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			engine.SetMaxEncodeBytes(100)
+			_, err := engine.Encode(thisCase.MimeType, thisCase.Content, &bytes.Buffer{})
+			if assert.Error(err) {
+				assert.Contains(
+					err.Error(), "encoded output exceeds maximum of 100 bytes",
+				)
+			}
+
+			engine.SetMaxEncodeBytes(1000000)
+			buffer := &bytes.Buffer{}
+			_, err = engine.Encode(thisCase.MimeType, thisCase.Content, buffer)
+			assert.Nil(err)
+			assert.NotZero(buffer.Len())
+		})
+	}
+}
+
+// Marshals itself to and from bson only.
+type BsonOnlyName struct {
+	First string
+}
+
+func (name BsonOnlyName) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(bson.M{"first": name.First})
+}
+
+func (name *BsonOnlyName) UnmarshalBSON(data []byte) error {
+	name.First = bson.Raw(data).Lookup("first").StringValue()
+	return nil
+}
+
+// Marshals itself to and from both bson and json.
+type BsonAndJSONName struct {
+	BsonOnlyName
+}
+
+func (name BsonAndJSONName) MarshalJSON() ([]byte, error) {
+	return []byte(`{"first": "` + name.First + `"}`), nil
+}
+
+func TestPickContentMimeTypeBsonOnly(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	testCases := []struct {
+		Name     string
+		Content  interface{}
+		Encoding bool
+		Expected mimetype.MimeType
+	}{
+		{"BsonOnlyEncode", BsonOnlyName{}, true, mimetype.BSON},
+		{"BsonOnlyPointerEncode", &BsonOnlyName{}, true, mimetype.BSON},
+		{"BsonOnlyDecode", &BsonOnlyName{}, false, mimetype.BSON},
+		{"BsonAndJSONEncode", BsonAndJSONName{}, true, mimetype.JSON},
+		{"BsonAndJSONDecode", &BsonAndJSONName{}, false, mimetype.UNKNOWN},
+		{"PlainDecode", &Name{}, false, mimetype.UNKNOWN},
+	}
+
+	for _, thisCase := range testCases {
+		picked := engine.PickContentMimeType(
+			mimetype.UNKNOWN, thisCase.Content, thisCase.Encoding,
+		)
+		assert.Equal(thisCase.Expected, picked, thisCase.Name)
+	}
+}
+
+func TestBsonOnlyRoundTripUnknown(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.Encode(
+		mimetype.UNKNOWN, BsonOnlyName{First: "Harry"}, buffer,
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+
+	loaded := &BsonOnlyName{}
+	mimeType, err = engine.Decode(mimetype.UNKNOWN, loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(mimetype.BSON, mimeType)
+	assert.Equal("Harry", loaded.First)
+}
+
+type ResponseEnvelope struct {
+	Data interface{}            `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
+func TestEncodeEnvelope(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.SetEncodeEnvelope(func(content interface{}) interface{} {
+		return &ResponseEnvelope{
+			Data: content,
+			Meta: map[string]interface{}{"version": 1},
+		}
+	})
+	engine.SetDecodeUnenvelope(func(contentReceiver interface{}) interface{} {
+		return &ResponseEnvelope{Data: contentReceiver}
+	})
+
+	buffer := &bytes.Buffer{}
+	_, err := engine.Encode(mimetype.JSON, Name{First: "Harry", Last: "Potter"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// The envelope is on the wire.
+	raw := make(map[string]interface{})
+	assert.Nil(json.Unmarshal(buffer.Bytes(), &raw))
+	assert.Contains(raw, "data")
+	assert.Contains(raw, "meta")
+
+	loaded := &Name{}
+	_, err = engine.Decode(mimetype.JSON, loaded, buffer)
+	assert.Nil(err)
+	assert.Equal(&Name{First: "Harry", Last: "Potter"}, loaded)
+
+	// Removing the envelope goes back to plain content.
+	engine.SetEncodeEnvelope(nil)
+	engine.SetDecodeUnenvelope(nil)
+
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.JSON, Name{First: "Ron"}, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.NotContains(buffer.String(), "data")
+}
+
+// Sets the ResponseEnvelope envelope on engine.
+func setResponseEnvelope(engine *encoding.SpanEngine) {
+	engine.SetEncodeEnvelope(func(content interface{}) interface{} {
+		return &ResponseEnvelope{
+			Data: content,
+			Meta: map[string]interface{}{"version": 1},
+		}
+	})
+	engine.SetDecodeUnenvelope(func(contentReceiver interface{}) interface{} {
+		return &ResponseEnvelope{Data: contentReceiver}
+	})
+}
+
+func TestEncodeEnvelopeMapOrdered(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	setResponseEnvelope(engine)
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeMapOrdered(
+		mimetype.JSON,
+		map[string]interface{}{"first": "Harry", "last": "Potter"},
+		[]string{"last", "first"},
+		buffer,
+	)
+	assert.Nil(err)
+
+	// The object is enveloped once, as a whole.
+	assert.Equal(
+		`{"data":{"last":"Potter","first":"Harry"},"meta":{"version":1}}`,
+		buffer.String(),
+	)
+}
+
+func TestEncodeEnvelopeBSONWithID(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	setResponseEnvelope(engine)
+
+	buffer := &bytes.Buffer{}
+	err := engine.EncodeBSONWithID(Name{First: "Harry"}, buffer)
+	if !assert.Nil(err) {
+		return
+	}
+
+	// The id is injected into the content, not the envelope.
+	document := bson.Raw(buffer.Bytes())
+	_, err = document.LookupErr("_id")
+	assert.Error(err)
+
+	idValue, err := document.LookupErr("data", "_id")
+	if assert.Nil(err) {
+		assert.False(idValue.ObjectID().IsZero())
+	}
+	assert.Equal(int32(1), document.Lookup("meta", "version").Int32())
+}
+
+func TestDecodeUnenvelopeCachedType(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	setResponseEnvelope(engine)
+
+	content := `{"data": {"First": "Harry"}, "meta": {"version": 1}}`
+
+	// Both the sniffed and the cached decode unwrap the envelope.
+	for i := 0; i < 2; i++ {
+		loaded := &Name{}
+		mimeType, err := engine.DecodeWithCachedType(
+			"owlery", loaded, strings.NewReader(content),
+		)
+		assert.Nil(err)
+		assert.Equal(mimetype.JSON, mimeType)
+		assert.Equal("Harry", loaded.First)
+	}
+}
+
+func TestDecodeUnenvelopeManyInto(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	setResponseEnvelope(engine)
+
+	content := `{"data": [{"First": "Harry"}, {"First": "Ron"}]}`
+
+	loaded := []Name{{First: "Hermione", Last: "Granger"}}
+	_, err := engine.DecodeManyInto(
+		mimetype.JSON, &loaded, strings.NewReader(content),
+	)
+	assert.Nil(err)
+	assert.Equal([]Name{{First: "Harry"}, {First: "Ron"}}, loaded)
+}
+
+// Encodes float64 content to two decimal places.
+type RoundedFloatEncoder struct{}
+
+func (encoder RoundedFloatEncoder) Encode(
+	engine encoding.ContentEngine, writer io.Writer, content interface{},
+) error {
+	_, err := io.WriteString(writer, strconv.FormatFloat(content.(float64), 'f', 2, 64))
+	return err
+}
+
+func (encoder RoundedFloatEncoder) Decode(
+	engine encoding.ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	var content strings.Builder
+	if _, err := io.Copy(&content, reader); err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseFloat(content.String(), 64)
+	*contentReceiver.(*float64) = value
+	return err
+}
+
+func TestEncodeToBytes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	encoded, err := engine.EncodeToBytes(mimetype.TEXT, "Harry Potter")
+	assert.Nil(err)
+	assert.Equal([]byte("Harry Potter"), encoded)
+
+	encoded, err = engine.EncodeToBytes("text/csv", Name{})
+	assert.EqualError(err, "no encoder for text/csv")
+	assert.Nil(encoded)
+}
+
+// Decoder which reads all of its content, then fails.
+type DrainingDecoder struct{}
+
+func (decoder DrainingDecoder) Decode(
+	engine encoding.ContentEngine, reader io.Reader, contentReceiver interface{},
+) error {
+	_, _ = io.Copy(ioutil.Discard, reader)
+	return xerrors.New("draining decoder failed")
+}
+
+func TestDecodeBytes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	loaded := ""
+	assert.Nil(engine.DecodeBytes(mimetype.TEXT, &loaded, []byte("Harry Potter")))
+	assert.Equal("Harry Potter", loaded)
+
+	// When sniffing, each decoder is attempted with all of the content.
+	var draining mimetype.MimeType = "text/x-draining"
+	var rounded mimetype.MimeType = "text/x-rounded"
+	engine.SetDecoder(draining, DrainingDecoder{})
+	engine.SetDecoder(rounded, RoundedFloatEncoder{})
+	engine.SetSniffOrder([]mimetype.MimeType{draining, rounded})
+
+	data := []byte("1.25")
+	var value float64
+	assert.Nil(engine.DecodeBytes(mimetype.UNKNOWN, &value, data))
+	assert.Equal(1.25, value)
+	assert.Equal([]byte("1.25"), data)
+
+	err := engine.DecodeBytes("text/csv", &value, data)
+	assert.EqualError(err, "no decoder for text/csv")
+}
+
+func TestRoundTripCheck(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	equal, err := engine.RoundTripCheck(mimetype.JSON, Name{First: "Harry"})
+	assert.Nil(err)
+	assert.True(equal)
+
+	equal, err = engine.RoundTripCheck(mimetype.BSON, &Name{First: "Harry"})
+	assert.Nil(err)
+	assert.True(equal)
+
+	var rounded mimetype.MimeType = "text/x-rounded"
+	engine.SetEncoder(rounded, RoundedFloatEncoder{})
+	engine.SetDecoder(rounded, RoundedFloatEncoder{})
+
+	equal, err = engine.RoundTripCheck(rounded, 1.25)
+	assert.Nil(err)
+	assert.True(equal)
+
+	equal, err = engine.RoundTripCheck(rounded, 3.14159)
+	assert.Nil(err)
+	assert.False(equal)
+
+	_, err = engine.RoundTripCheck("text/csv", Name{})
+	assert.EqualError(err, "no encoder for text/csv")
+
+	_, err = engine.RoundTripCheck(mimetype.JSON, nil)
+	assert.EqualError(err, "cannot round trip nil content")
+}
+
+// Encoded by ShoutedNameExt as an upper-case string.
+type ShoutedName string
+
+type ShoutedNameExt struct{}
+
+func (ext *ShoutedNameExt) ConvertExt(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case ShoutedName:
+		return strings.ToUpper(string(typed))
+	case *ShoutedName:
+		return strings.ToUpper(string(*typed))
+	}
+	return value
+}
+
+func (ext *ShoutedNameExt) UpdateExt(dest interface{}, value interface{}) {
+	*dest.(*ShoutedName) = ShoutedName(value.(string))
+}
+
+func TestClone(test *testing.T) {
+	assert := assert.New(test)
+
+	engine := createSpanEngine(test)
+	engine.SetMaxEncodeBytes(8)
+
+	clone := engine.Clone()
+	assert.Equal(engine.SniffType(), clone.SniffType())
+	assert.Equal(engine.SniffOrder(), clone.SniffOrder())
+
+	// Settings are carried over.
+	err := clone.CanEncode(mimetype.TEXT, "longer than eight bytes")
+	assert.Error(err)
+	clone.SetMaxEncodeBytes(0)
+
+	// Encoders registered on the clone are not registered on the original.
+	clone.SetEncoder("text/csv", RawBytesEncoder{})
+
+	buffer := &bytes.Buffer{}
+	_, err = clone.Encode("text/csv", []byte("raw content"), buffer)
+	assert.Nil(err)
+	assert.Equal("raw content", buffer.String())
+
+	_, err = engine.Encode("text/csv", []byte("raw content"), buffer)
+	assert.EqualError(err, "no encoder for text/csv")
+	engine.SetMaxEncodeBytes(0)
+
+	// Nor are json extensions.
+	err = clone.AddJSONExtensions([]*encoding.JSONExtensionOpts{
+		{ValueType: reflect.TypeOf(ShoutedName("")), ExtInterface: &ShoutedNameExt{}},
+	})
+	assert.Nil(err)
+
+	buffer.Reset()
+	_, err = clone.Encode(mimetype.JSON, ShoutedName("harry"), buffer)
+	assert.Nil(err)
+	assert.Equal(`"HARRY"`, buffer.String())
+
+	buffer.Reset()
+	_, err = engine.Encode(mimetype.JSON, ShoutedName("harry"), buffer)
+	assert.Nil(err)
+	assert.Equal(`"harry"`, buffer.String())
+
+	// Default extensions are bound to the clone's settings, not the original's.
+	clone.SetLenientUUID(true)
+	content := `{"ID": "not-a-uuid"}`
+
+	receiver := &struct{ ID uuid.UUID }{}
+	_, err = clone.Decode(mimetype.JSON, receiver, strings.NewReader(content))
+	assert.Nil(err)
+
+	_, err = engine.Decode(mimetype.JSON, receiver, strings.NewReader(content))
+	assert.Error(err)
+}
+
+// Encodes ShoutedName to bson as an upper-case string.
+type ShoutedNameCodec struct{}
+
+func (codec *ShoutedNameCodec) EncodeValue(
+	_ bsoncodec.EncodeContext, writer bsonrw.ValueWriter, value reflect.Value,
+) error {
+	return writer.WriteString(strings.ToUpper(value.String()))
+}
+
+func (codec *ShoutedNameCodec) DecodeValue(
+	_ bsoncodec.DecodeContext, reader bsonrw.ValueReader, value reflect.Value,
+) error {
+	decoded, err := reader.ReadString()
+	value.SetString(decoded)
+	return err
+}
+
+// Run with -race to check that registering encoders, decoders, extensions and codecs
+// is safe while other goroutines encode and decode.
+func TestConcurrentRegistration(test *testing.T) {
+	engine := createSpanEngine(test)
+	content := map[string]interface{}{"first": "Harry", "last": "Potter"}
+	mimeTypes := []mimetype.MimeType{mimetype.JSON, mimetype.BSON, mimetype.TEXT}
+
+	waitGroup := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for j := 0; j < 50; j++ {
+				buffer := &bytes.Buffer{}
+				_, err := engine.Encode(mimeTypes[j%len(mimeTypes)], content, buffer)
+				assert.Nil(test, err)
+
+				// Sniffing walks the decoders while they are being changed.
+				_, _ = engine.Decode(mimetype.UNKNOWN, &map[string]interface{}{}, buffer)
+				engine.HandlesDecode("text/csv")
+			}
+		}()
+	}
+
+	shoutedType := reflect.TypeOf(ShoutedName(""))
+	for i := 0; i < 50; i++ {
+		engine.SetEncoder("text/csv", &RawBytesEncoder{})
+		engine.SetDecoder("text/csv", &PanickyEncoder{})
+		engine.RemoveDecoder("text/csv")
+
+		err := engine.AddBSONCodecs(
+			[]*encoding.BsonCodecOpts{{ValueType: shoutedType, Codec: &ShoutedNameCodec{}}},
+		)
+		assert.Nil(test, err)
+
+		err = engine.AddJSONExtensions(
+			[]*encoding.JSONExtensionOpts{
+				{ValueType: shoutedType, ExtInterface: &ShoutedNameExt{}},
+			},
+		)
+		assert.Nil(test, err)
+	}
+
+	waitGroup.Wait()
+	assert.True(test, engine.HandlesEncode("text/csv"))
+}
+
+func TestDecodeLimited(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Content  string
+		MaxBytes int64
+		Exceeds  bool
+	}{
+		{Name: "UnderLimit", Content: "Harry", MaxBytes: 6},
+		{Name: "AtLimit", Content: "Harry", MaxBytes: 5},
+		{Name: "OverLimit", Content: "Harry Potter", MaxBytes: 5, Exceeds: true},
+		{Name: "Unlimited", Content: "Harry Potter", MaxBytes: 0},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			engine := createSpanEngine(subTest)
+
+			loaded := ""
+			mimeType, err := engine.DecodeLimited(
+				mimetype.TEXT, &loaded, strings.NewReader(thisCase.Content),
+				thisCase.MaxBytes,
+			)
+
+			if !thisCase.Exceeds {
+				assert.Nil(err)
+				assert.Equal(mimetype.TEXT, mimeType)
+				assert.Equal(thisCase.Content, loaded)
+				return
+			}
+
+			tooLarge := &encoding.PayloadTooLargeError{}
+			if assert.True(xerrors.As(err, &tooLarge)) {
+				assert.Equal(thisCase.MaxBytes, tooLarge.Max)
+			}
+			assert.EqualError(err, "payload exceeds 5 bytes")
+		})
+	}
+}
+
+func TestMaxDecodeBytes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.Equal(int64(0), engine.MaxDecodeBytes())
+	engine.SetMaxDecodeBytes(16)
+	assert.Equal(int64(16), engine.MaxDecodeBytes())
+
+	// Sniffing stops reading as soon as the limit is passed, rather than buffering the
+	// whole payload.
+	reader := strings.NewReader(strings.Repeat("a", 1<<20))
+	_, err := engine.Decode(mimetype.UNKNOWN, &Name{}, reader)
+	assert.EqualError(err, "payload exceeds 16 bytes")
+	assert.Equal(1<<20-17, reader.Len())
+
+	_, err = engine.DecodeWithCachedType(
+		"client", &Name{}, strings.NewReader(strings.Repeat("a", 17)),
+	)
+	tooLarge := &encoding.PayloadTooLargeError{}
+	assert.True(xerrors.As(err, &tooLarge))
+
+	loaded := ""
+	_, err = engine.Decode(mimetype.TEXT, &loaded, strings.NewReader("Harry Potter"))
+	assert.Nil(err)
+	assert.Equal("Harry Potter", loaded)
+}
+
+type WizardV1 struct {
+	Name string `json:"name"`
+}
+
+type WizardV2 struct {
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Name  string `json:"name"`
+}
+
+func TestDecodeVersioned(test *testing.T) {
+	registry := map[string]reflect.Type{
+		"v1": reflect.TypeOf(WizardV1{}),
+		"v2": reflect.TypeOf(&WizardV2{}),
+	}
+	content := `{"name": "Harry Potter", "first": "Harry", "last": "Potter"}`
+
+	engine := createSpanEngine(test)
+
+	test.Run("v1", func(subTest *testing.T) {
+		loaded, err := engine.DecodeVersioned(
+			mimetype.JSON, "v1", registry, strings.NewReader(content),
+		)
+		assert.Nil(subTest, err)
+		assert.Equal(subTest, WizardV1{Name: "Harry Potter"}, loaded)
+	})
+
+	test.Run("v2", func(subTest *testing.T) {
+		loaded, err := engine.DecodeVersioned(
+			mimetype.JSON, "v2", registry, strings.NewReader(content),
+		)
+		assert.Nil(subTest, err)
+		assert.Equal(
+			subTest,
+			&WizardV2{First: "Harry", Last: "Potter", Name: "Harry Potter"},
+			loaded,
+		)
+	})
+}
+
+func TestDecodeVersionedUnknown(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	reader := strings.NewReader(`{"name": "Harry Potter"}`)
+	loaded, err := engine.DecodeVersioned(
+		mimetype.JSON, "v3", map[string]reflect.Type{}, reader,
+	)
+	assert.Nil(loaded)
+	assert.EqualError(err, "no receiver type registered for version 'v3'")
+	assert.Equal(len(`{"name": "Harry Potter"}`), reader.Len())
+}
+
+func TestDecodeVersionedError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	registry := map[string]reflect.Type{"": reflect.TypeOf(WizardV1{})}
+	loaded, err := engine.DecodeVersioned(
+		mimetype.TEXT, "", registry, strings.NewReader("Harry Potter"),
+	)
+	assert.Nil(loaded)
+	assert.Error(err)
+}
+
+// Decoder which cancels its context, records the attempt, then fails, as if it were
+// interrupted mid-decode.
+type CancellingDecoder struct {
+	RecordingDecoder
+	Cancel context.CancelFunc
+}
+
+func (decoder *CancellingDecoder) DecodeContext(
+	ctx context.Context,
+	engine encoding.ContentEngine,
+	reader io.Reader,
+	contentReceiver interface{},
+) error {
+	decoder.Cancel()
+	_ = decoder.RecordingDecoder.Decode(engine, reader, contentReceiver)
+	return ctx.Err()
+}
+
+func TestDecodeContext(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	attempts := make([]mimetype.MimeType, 0)
+	custom := mimetype.MimeType("text/x-custom")
+	engine.SetDecoder(custom, &RecordingDecoder{MimeType: custom, Attempts: &attempts})
+
+	// Decoders which are not context aware are still used.
+	mimeType, err := engine.DecodeContext(
+		context.Background(), custom, &Name{}, strings.NewReader("Harry"),
+	)
+	assert.Nil(err)
+	assert.Equal(custom, mimeType)
+	assert.Equal([]mimetype.MimeType{custom}, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The decoder is not called once the context is done.
+	_, err = engine.DecodeContext(ctx, custom, &Name{}, strings.NewReader("Harry"))
+	assert.Equal(context.Canceled, err)
+	_, err = engine.DecodeContext(
+		ctx, mimetype.UNKNOWN, &Name{}, strings.NewReader("Harry"),
+	)
+	assert.Equal(context.Canceled, err)
+	assert.Equal([]mimetype.MimeType{custom}, attempts)
+}
+
+func TestDecodeContextSniffCancelled(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	attempts := make([]mimetype.MimeType, 0)
+	cancelling := mimetype.MimeType("text/x-cancelling")
+	custom := mimetype.MimeType("text/x-custom")
+	engine.SetDecoder(cancelling, &CancellingDecoder{
+		RecordingDecoder: RecordingDecoder{MimeType: cancelling, Attempts: &attempts},
+		Cancel:           cancel,
+	})
+	engine.SetDecoder(custom, &RecordingDecoder{MimeType: custom, Attempts: &attempts})
+	engine.SetSniffOrder([]mimetype.MimeType{cancelling, custom})
+
+	// Sniffing stops once the context is cancelled by the first decoder.
+	mimeType, err := engine.DecodeContext(
+		ctx, mimetype.UNKNOWN, &Name{}, strings.NewReader("Harry"),
+	)
+	assert.Equal(context.Canceled, err)
+	assert.Equal(mimetype.UNKNOWN, mimeType)
+	assert.Equal([]mimetype.MimeType{cancelling}, attempts)
+}
+
+type ctxKey string
+
+// Encoder which writes the value of the "house" key of its context.
+type ContextValueEncoder struct{}
+
+func (encoder ContextValueEncoder) Encode(
+	engine encoding.ContentEngine, writer io.Writer, content interface{},
+) error {
+	_, err := io.WriteString(writer, "no context")
+	return err
+}
+
+func (encoder ContextValueEncoder) EncodeContext(
+	ctx context.Context,
+	engine encoding.ContentEngine,
+	writer io.Writer,
+	content interface{},
+) error {
+	_, err := fmt.Fprint(writer, ctx.Value(ctxKey("house")))
+	return err
+}
+
+func TestEncodeContext(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	custom := mimetype.MimeType("text/x-custom")
+	engine.SetEncoder(custom, ContextValueEncoder{})
+
+	ctx := context.WithValue(context.Background(), ctxKey("house"), "Gryffindor")
+	buffer := &bytes.Buffer{}
+	mimeType, err := engine.EncodeContext(ctx, custom, Name{}, buffer)
+	assert.Nil(err)
+	assert.Equal(custom, mimeType)
+	assert.Equal("Gryffindor", buffer.String())
+
+	// Encode() passes a background context.
+	buffer.Reset()
+	_, err = engine.Encode(custom, Name{}, buffer)
+	assert.Nil(err)
+	assert.Equal("<nil>", buffer.String())
+
+	// Encoders which are not context aware are still used.
+	buffer.Reset()
+	_, err = engine.EncodeContext(ctx, mimetype.TEXT, "Harry", buffer)
+	assert.Nil(err)
+	assert.Equal("Harry", buffer.String())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	buffer.Reset()
+	_, err = engine.EncodeContext(cancelled, custom, Name{}, buffer)
+	assert.Equal(context.Canceled, err)
+	assert.Empty(buffer.String())
+}
+
+func TestDecodeContextMaxDecodeBytes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetMaxDecodeBytes(5)
+
+	ctx := encoding.WithMaxDecodeBytes(context.Background(), 16)
+	maxBytes, ok := encoding.MaxDecodeBytesFromContext(ctx)
+	assert.True(ok)
+	assert.Equal(int64(16), maxBytes)
+
+	// The limit in the context replaces the engine's for the call.
+	loaded := ""
+	_, err := engine.DecodeContext(
+		ctx, mimetype.TEXT, &loaded, strings.NewReader("Harry Potter"),
+	)
+	assert.Nil(err)
+	assert.Equal("Harry Potter", loaded)
+
+	_, err = engine.DecodeContext(
+		ctx, mimetype.TEXT, &loaded, strings.NewReader("Harry James Potter"),
+	)
+	tooLarge := &encoding.PayloadTooLargeError{}
+	if assert.True(xerrors.As(err, &tooLarge)) {
+		assert.Equal(int64(16), tooLarge.Max)
+	}
+
+	// Without a limit in the context, the engine's is used.
+	_, ok = encoding.MaxDecodeBytesFromContext(context.Background())
+	assert.False(ok)
+	_, err = engine.DecodeContext(
+		context.Background(), mimetype.TEXT, &loaded, strings.NewReader("Harry Potter"),
+	)
+	assert.EqualError(err, "payload exceeds 5 bytes")
+
+	// A limit of 0 in the context is unlimited.
+	unlimited := context.WithValue(
+		context.Background(), encoding.MaxDecodeBytesKey, int64(0),
+	)
+	_, err = engine.DecodeContext(
+		unlimited, mimetype.TEXT, &loaded, strings.NewReader("Harry James Potter"),
+	)
+	assert.Nil(err)
+	assert.Equal(int64(5), engine.MaxDecodeBytes())
+}
+
+func TestDefaultEncoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Unset, unregistered mimetypes still error.
+	assert.Nil(engine.DefaultEncoder())
+	_, err := engine.Encode("text/csv", []byte("Harry,Potter"), &bytes.Buffer{})
+	assert.EqualError(err, "no encoder for text/csv")
+
+	engine.SetDefaultEncoder(RawBytesEncoder{})
+	assert.Equal(RawBytesEncoder{}, engine.DefaultEncoder())
+	assert.False(engine.HandlesEncode("text/csv"))
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		buffer := &bytes.Buffer{}
+		mimeType, err := thisEngine.Encode("text/csv", []byte("Harry,Potter"), buffer)
+		assert.Nil(err)
+		assert.Equal(mimetype.MimeType("text/csv"), mimeType)
+		assert.Equal("Harry,Potter", buffer.String())
+	}
+
+	// Registered encoders are still used for their mimetype.
+	buffer := &bytes.Buffer{}
+	_, err = engine.Encode(mimetype.JSON, Name{First: "Harry"}, buffer)
+	assert.Nil(err)
+	assert.Contains(buffer.String(), `"Harry"`)
+
+	engine.SetDefaultEncoder(nil)
+	_, err = engine.Encode("text/csv", []byte("Harry,Potter"), &bytes.Buffer{})
+	assert.EqualError(err, "no encoder for text/csv")
+}
+
+func TestDefaultDecoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Unset, unregistered mimetypes still error.
+	assert.Nil(engine.DefaultDecoder())
+	_, err := engine.Decode("text/csv", &Name{}, strings.NewReader("Harry,Potter"))
+	assert.EqualError(err, "no decoder for text/csv")
+
+	var attempts []mimetype.MimeType
+	decoder := &RecordingDecoder{MimeType: "default", Attempts: &attempts}
+	engine.SetDefaultDecoder(decoder)
+	assert.Equal(decoder, engine.DefaultDecoder())
+	assert.False(engine.HandlesDecode("text/csv"))
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		mimeType, err := thisEngine.Decode(
+			"text/csv", &Name{}, strings.NewReader("Harry,Potter"),
+		)
+		assert.Nil(err)
+		assert.Equal(mimetype.MimeType("text/csv"), mimeType)
+	}
+	assert.Equal([]mimetype.MimeType{"default", "default"}, attempts)
+
+	// Registered decoders are still used for their mimetype.
+	loaded := Name{}
+	_, err = engine.Decode(
+		mimetype.JSON, &loaded, strings.NewReader(`{"First": "Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal("Harry", loaded.First)
+	assert.Len(attempts, 2)
+
+	engine.SetDefaultDecoder(nil)
+	_, err = engine.Decode("text/csv", &Name{}, strings.NewReader("Harry,Potter"))
+	assert.EqualError(err, "no decoder for text/csv")
+}
+
+func TestAllowedMimeTypes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	assert.Empty(engine.AllowedMimeTypes())
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.JSON})
+	assert.Equal([]mimetype.MimeType{mimetype.JSON}, engine.AllowedMimeTypes())
+
+	for _, thisEngine := range []*encoding.SpanEngine{engine, engine.Clone()} {
+		// BSON is still registered, but not allowed.
+		assert.True(thisEngine.Handles(mimetype.BSON))
+
+		_, err := thisEngine.Encode(mimetype.BSON, Name{First: "Harry"}, &bytes.Buffer{})
+		assert.EqualError(err, "mimetype not allowed: 'application/bson'")
+
+		notAllowed := &encoding.MimeTypeNotAllowedError{}
+		_, err = thisEngine.Decode(mimetype.BSON, &Name{}, &bytes.Buffer{})
+		if assert.True(xerrors.As(err, &notAllowed)) {
+			assert.Equal(mimetype.BSON, notAllowed.MimeType)
+		}
+
+		errs := thisEngine.DecodeCollectErrors(mimetype.BSON, &Name{}, &bytes.Buffer{})
+		if assert.Len(errs, 1) {
+			assert.True(xerrors.As(errs[0], &notAllowed))
+		}
+
+		// Allowed mimetypes are unaffected.
+		buffer := &bytes.Buffer{}
+		_, err = thisEngine.Encode(mimetype.JSON, Name{First: "Harry"}, buffer)
+		assert.Nil(err)
+
+		loaded := Name{}
+		_, err = thisEngine.Decode(mimetype.JSON, &loaded, buffer)
+		assert.Nil(err)
+		assert.Equal("Harry", loaded.First)
+	}
+
+	engine.SetAllowedMimeTypes(nil)
+	_, err := engine.Encode(mimetype.BSON, Name{First: "Harry"}, &bytes.Buffer{})
+	assert.Nil(err)
+}
+
+func TestAllowedMimeTypesCollectErrors(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.BSON})
+
+	loaded := Name{}
+	errs := engine.DecodeCollectErrors(
+		mimetype.JSON, &loaded, strings.NewReader(`{"First": "Harry"}`),
+	)
+
+	notAllowed := &encoding.MimeTypeNotAllowedError{}
+	if assert.Len(errs, 1) && assert.True(xerrors.As(errs[0], &notAllowed)) {
+		assert.Equal(mimetype.JSON, notAllowed.MimeType)
+	}
+	assert.Equal("", loaded.First)
+}
+
+func TestAllowedMimeTypesSniff(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.BSON})
+	assert.Equal([]mimetype.MimeType{mimetype.BSON}, engine.SniffOrder())
+
+	// JSON content is not sniffed as JSON, as only BSON may be decoded.
+	_, err := engine.Decode(
+		mimetype.UNKNOWN, &Name{}, strings.NewReader(`{"First": "Harry"}`),
+	)
+	assert.Error(err)
+
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.JSON})
+	loaded := Name{}
+	mimeType, err := engine.Decode(
+		mimetype.UNKNOWN, &loaded, strings.NewReader(`{"First": "Harry"}`),
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal("Harry", loaded.First)
+}
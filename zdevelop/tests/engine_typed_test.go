@@ -0,0 +1,70 @@
+//go:build go1.18
+// +build go1.18
+
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"bytes"
+	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestTypedRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	testName := Name{
+		First: "Harry",
+		Last:  "Potter",
+	}
+
+	for _, mimeType := range []mimetype.MimeType{mimetype.JSON, mimetype.BSON} {
+		buffer := &bytes.Buffer{}
+
+		err := encoding.EncodeTyped(engine, mimeType, testName, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		// loaded is a Name, not an interface{}, so fields can be accessed without a
+		// type assertion.
+		loaded, err := encoding.DecodeTyped[Name](engine, mimeType, buffer)
+		if err != nil {
+			test.Error(err)
+		}
+
+		assert.Equal(testName, loaded)
+		assert.Equal("Harry", loaded.First)
+		assert.Equal("Potter", loaded.Last)
+	}
+}
+
+func TestTypedDecodePointer(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := bytes.NewBufferString(`{"First": "Harry", "Last": "Potter"}`)
+
+	loaded, err := encoding.DecodeTyped[*Name](engine, mimetype.JSON, buffer)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(&Name{First: "Harry", Last: "Potter"}, loaded)
+}
+
+func TestTypedDecodeError(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	buffer := bytes.NewBufferString("not json")
+
+	loaded, err := encoding.DecodeTyped[Name](engine, "text/csv", buffer)
+	assert.EqualError(err, "no decoder for text/csv")
+	assert.Equal(Name{}, loaded)
+}
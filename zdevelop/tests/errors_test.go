@@ -4,14 +4,19 @@ package tests
 // the preferred method of using multiple asserts in a test.
 
 import (
+	"encoding/json"
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/xerrors"
+	"io"
 	"net/http"
 	"reflect"
 	"github.com/illuscio-dev/spantools-go/encoding"
+	"github.com/illuscio-dev/spantools-go/mimetype"
 	"github.com/illuscio-dev/spantools-go/spanerrors"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Creates a consistent test error for multiple tests
@@ -121,6 +126,20 @@ func TestSpanErrorMessage(test *testing.T) {
 	)
 }
 
+func TestSpanErrorVerbose(test *testing.T) {
+	assert := assert.New(test)
+
+	spanErr := createTestError()
+	assert.Equal(
+		"ResponseValidationError (1005) - test message: some source error",
+		spanErr.VerboseError(),
+	)
+	assert.Equal("ResponseValidationError (1005) - test message", spanErr.Error())
+
+	noSource := spanerrors.APIError.New("no source", nil, nil)
+	assert.Equal(noSource.Error(), noSource.VerboseError())
+}
+
 func TestSpanLogMessage(test *testing.T) {
 	sourceErr := xerrors.New("some source error")
 
@@ -144,10 +163,97 @@ func TestSpanLogMessage(test *testing.T) {
 		test, logMessage, "PANIC STACK:",
 	)
 	assert.Contains(
-		test, logMessage, "runtime/debug.Stack(",
+		test, logMessage, "tests.TestSpanLogMessage(",
 	)
 }
 
+func createTestErrorFromHelper() *spanerrors.SpanError {
+	return spanerrors.APIError.New("helper error", nil, nil)
+}
+
+func TestSpanErrorCallerStack(test *testing.T) {
+	assert := assert.New(test)
+
+	fields := createTestErrorFromHelper().LogFields()
+	stack := fields["stack"].(string)
+
+	// The first frame of the stack is the function which called New(), not debug.Stack()
+	// or the spanerrors package.
+	lines := strings.Split(stack, "\n")
+	if !assert.True(len(lines) > 1) {
+		return
+	}
+	assert.Contains(lines[1], "tests.createTestErrorFromHelper(")
+	assert.Contains(stack, "tests.TestSpanErrorCallerStack(")
+	assert.NotContains(stack, "runtime/debug.Stack(")
+	assert.NotContains(stack, "spanerrors.")
+}
+
+func TestSpanErrorPanicCallerStack(test *testing.T) {
+	assert := assert.New(test)
+
+	defer func() {
+		spanErr := recover().(*spanerrors.SpanError)
+		stack := spanErr.LogFields()["stack"].(string)
+
+		lines := strings.Split(stack, "\n")
+		if !assert.True(len(lines) > 1) {
+			return
+		}
+		assert.Contains(lines[1], "tests.TestSpanErrorPanicCallerStack(")
+		assert.NotContains(stack, "spanerrors.(*SpanErrorType).Panic(")
+	}()
+
+	spanerrors.APIError.Panic("panicked error", nil, nil)
+}
+
+func TestSpanErrorWrapCallerStack(test *testing.T) {
+	assert := assert.New(test)
+
+	errs := []*spanerrors.SpanError{
+		spanerrors.Wrap(spanerrors.APIError, "wrapped", io.EOF),
+		spanerrors.FromError(io.EOF),
+	}
+
+	for _, spanErr := range errs {
+		stack := spanErr.LogFields()["stack"].(string)
+		lines := strings.Split(stack, "\n")
+		if !assert.True(len(lines) > 1) {
+			continue
+		}
+		assert.Contains(lines[1], "tests.TestSpanErrorWrapCallerStack(")
+	}
+}
+
+func TestSpanLogFields(test *testing.T) {
+	assert := assert.New(test)
+
+	spanErr := createTestError()
+	fields := spanErr.LogFields()
+
+	assert.Len(fields, 6)
+	assert.Equal("ResponseValidationError", fields["name"])
+	assert.Equal(1005, fields["code"])
+	assert.Equal(spanErr.Id.String(), fields["id"])
+	assert.Equal("test message", fields["message"])
+	assert.Equal("some source error", fields["source"])
+
+	stack, ok := fields["stack"].(string)
+	assert.True(ok)
+	assert.NotEmpty(stack)
+	assert.Contains(stack, "tests.createTestError(")
+}
+
+func TestSpanLogFieldsNoSource(test *testing.T) {
+	assert := assert.New(test)
+
+	spanErr := spanerrors.APIError.New("no source", nil, nil)
+	fields := spanErr.LogFields()
+
+	assert.NotContains(fields, "source")
+	assert.Equal("no source", fields["message"])
+}
+
 func TestToHeaders(test *testing.T) {
 	assert := assert.New(test)
 
@@ -167,6 +273,72 @@ func TestToHeaders(test *testing.T) {
 	assert.Equal("{\"key\":\"value\"}", testReq.Header.Get("error-data"))
 }
 
+// Strips "internal_id" from error data and renames "table" to "resource".
+func renameErrorData(data map[string]interface{}) map[string]interface{} {
+	delete(data, "internal_id")
+	if table, ok := data["table"]; ok {
+		delete(data, "table")
+		data["resource"] = table
+	}
+	return data
+}
+
+func TestErrorDataFilter(test *testing.T) {
+	assert := assert.New(test)
+
+	spanerrors.Serialization.SetErrorDataFilter(renameErrorData)
+	defer spanerrors.Serialization.SetErrorDataFilter(nil)
+	assert.NotNil(spanerrors.Serialization.ErrorDataFilter())
+
+	errorData := map[string]interface{}{
+		"internal_id": 42, "table": "wizards", "key": "value",
+	}
+	spanErr := spanerrors.RequestValidationError.New("bad wizard", errorData, nil)
+
+	testReq := http.Request{Header: make(http.Header)}
+	if err := spanErr.ToHeader(testReq.Header, createEngine(test)); err != nil {
+		test.Fatal(err)
+	}
+	assert.Equal(
+		`{"key":"value","resource":"wizards"}`, testReq.Header.Get("error-data"),
+	)
+	assert.NotContains(testReq.Header.Get("error-data"), "internal_id")
+
+	body, err := json.Marshal(spanErr)
+	if err != nil {
+		test.Fatal(err)
+	}
+	loaded := &spanerrors.SpanError{}
+	assert.Nil(json.Unmarshal(body, loaded))
+	assert.Equal(
+		map[string]interface{}{"key": "value", "resource": "wizards"}, loaded.ErrorData,
+	)
+
+	// The error's own data is left untouched for logging.
+	assert.Equal(
+		map[string]interface{}{"internal_id": 42, "table": "wizards", "key": "value"},
+		spanErr.ErrorData,
+	)
+}
+
+func TestErrorDataFilterRemovesAll(test *testing.T) {
+	assert := assert.New(test)
+
+	spanerrors.Serialization.SetErrorDataFilter(
+		func(map[string]interface{}) map[string]interface{} { return nil },
+	)
+	defer spanerrors.Serialization.SetErrorDataFilter(nil)
+
+	spanErr, testReq, engine := setupHeadersTest(test)
+	if err := spanErr.ToHeader(testReq.Header, engine); err != nil {
+		test.Fatal(err)
+	}
+
+	_, hasData := testReq.Header["Error-Data"]
+	assert.False(hasData)
+	assert.Equal("1005", testReq.Header.Get("error-code"))
+}
+
 func TestFromHeaders(test *testing.T) {
 	assert := assert.New(test)
 
@@ -190,6 +362,83 @@ func TestFromHeaders(test *testing.T) {
 	assert.Equal(spanErr.ErrorData, errLoaded.ErrorData)
 }
 
+func TestRetryAfterHeaders(test *testing.T) {
+	assert := assert.New(test)
+	_, testReq, engine := setupHeadersTest(test)
+
+	spanErr := spanerrors.APILimitError.New("slow down", nil, nil)
+	spanErr.RetryAfter = 90 * time.Second
+
+	err := spanErr.ToHeader(testReq.Header, engine)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal("90", testReq.Header.Get("Retry-After"))
+
+	errLoaded, _, err := spanerrors.ErrorFromHeaders(
+		testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+	)
+	assert.Nil(err)
+	assert.Equal(90*time.Second, errLoaded.RetryAfter)
+}
+
+func TestRetryAfterHeadersValues(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Value    string
+		Expected time.Duration
+	}{
+		{Name: "Missing", Value: "", Expected: 0},
+		{Name: "Malformed", Value: "soon", Expected: 0},
+		{Name: "Negative", Value: "-5", Expected: 0},
+		{
+			Name:     "PastDate",
+			Value:    "Wed, 21 Oct 2015 07:28:00 GMT",
+			Expected: 0,
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+			spanErr, testReq, engine := setupHeadersTest(subTest)
+
+			err := spanErr.ToHeader(testReq.Header, engine)
+			if err != nil {
+				subTest.Error(err)
+			}
+			assert.Empty(testReq.Header.Get("Retry-After"))
+			testReq.Header.Set("Retry-After", thisCase.Value)
+
+			errLoaded, _, err := spanerrors.ErrorFromHeaders(
+				testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+			)
+			assert.Nil(err)
+			assert.Equal(thisCase.Expected, errLoaded.RetryAfter)
+		})
+	}
+
+	test.Run("FutureDate", func(subTest *testing.T) {
+		assert := assert.New(subTest)
+		spanErr, testReq, engine := setupHeadersTest(subTest)
+
+		err := spanErr.ToHeader(testReq.Header, engine)
+		if err != nil {
+			subTest.Error(err)
+		}
+		retryAt := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+		testReq.Header.Set("Retry-After", retryAt)
+
+		errLoaded, _, err := spanerrors.ErrorFromHeaders(
+			testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+		)
+		assert.Nil(err)
+		assert.InDelta(
+			time.Hour.Seconds(), errLoaded.RetryAfter.Seconds(), 2,
+		)
+	})
+}
+
 type badType string
 
 type jsonExtBadType struct{}
@@ -366,3 +615,317 @@ func TestCustomErrorFromHeader(test *testing.T) {
 	assert.Nil(err)
 	assert.EqualError(spanErr.SpanErrorType, CustomErrorType.Error())
 }
+
+func TestSpanErrorJSONRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+
+	spanErr := createTestError()
+
+	encoded, err := json.Marshal(spanErr)
+	if err != nil {
+		test.Error(err)
+	}
+
+	raw := make(map[string]interface{})
+	err = json.Unmarshal(encoded, &raw)
+	if err != nil {
+		test.Error(err)
+	}
+	assert.Equal(
+		map[string]interface{}{
+			"name":      "ResponseValidationError",
+			"code":      float64(1005),
+			"http_code": float64(400),
+			"message":   "test message",
+			"id":        spanErr.Id.String(),
+			"data":      map[string]interface{}{"key": "value"},
+		},
+		raw,
+	)
+
+	loaded := &spanerrors.SpanError{}
+	err = json.Unmarshal(encoded, loaded)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.Equal(spanerrors.ResponseValidationError, loaded.SpanErrorType)
+	assert.Equal(spanErr.Id, loaded.Id)
+	assert.Equal(spanErr.Message, loaded.Message)
+	assert.Equal(spanErr.ErrorData, loaded.ErrorData)
+	assert.Nil(loaded.Unwrap())
+}
+
+func TestSpanErrorJSONHttpCode(test *testing.T) {
+	assert := assert.New(test)
+
+	spanErr := spanerrors.ServerError.WithHttpCode(503).New("unavailable", nil, nil)
+
+	encoded, err := json.Marshal(spanErr)
+	if err != nil {
+		test.Error(err)
+	}
+
+	loaded := &spanerrors.SpanError{}
+	err = json.Unmarshal(encoded, loaded)
+	if err != nil {
+		test.Error(err)
+	}
+
+	assert.True(loaded.IsType(spanerrors.ServerError))
+	assert.Equal(503, loaded.HttpCode())
+}
+
+func TestSpanErrorJSONUnknownCode(test *testing.T) {
+	assert := assert.New(test)
+
+	content := `{"name": "Mystery", "code": 9999, "http_code": 400}`
+
+	loaded := &spanerrors.SpanError{}
+	err := json.Unmarshal([]byte(content), loaded)
+	assert.EqualError(err, "no known error for code 9999")
+}
+
+func TestWrapError(test *testing.T) {
+	assert := assert.New(test)
+
+	sourceErr := xerrors.New("database unavailable")
+	spanErr := spanerrors.Wrap(spanerrors.ServerError, "could not load", sourceErr)
+
+	assert.True(spanErr.IsType(spanerrors.ServerError))
+	assert.Equal("could not load", spanErr.Message)
+	assert.Nil(spanErr.ErrorData)
+	assert.NotEqual(uuid.Nil, spanErr.Id)
+	assert.True(xerrors.Is(spanErr, sourceErr))
+}
+
+func TestFromError(test *testing.T) {
+	assert := assert.New(test)
+
+	existing := createTestError()
+
+	test.Run("PlainError", func(subTest *testing.T) {
+		sourceErr := xerrors.New("some plain error")
+		spanErr := spanerrors.FromError(sourceErr)
+
+		assert.True(spanErr.IsType(spanerrors.APIError))
+		assert.Equal("some plain error", spanErr.Message)
+		assert.Equal(sourceErr, spanErr.Unwrap())
+	})
+
+	test.Run("SpanError", func(subTest *testing.T) {
+		assert.Same(existing, spanerrors.FromError(existing))
+	})
+
+	test.Run("WrappedSpanError", func(subTest *testing.T) {
+		wrapped := xerrors.Errorf("handler failed: %w", existing)
+		assert.Same(existing, spanerrors.FromError(wrapped))
+	})
+
+	test.Run("Nil", func(subTest *testing.T) {
+		assert.Nil(spanerrors.FromError(nil))
+	})
+}
+
+func createTestMultiError() *spanerrors.MultiSpanError {
+	return spanerrors.NewMultiSpanError(
+		spanerrors.RequestValidationError.New(
+			"first name is required", map[string]interface{}{"field": "first"}, nil,
+		),
+		spanerrors.RequestValidationError.New(
+			"last name is required", map[string]interface{}{"field": "last"}, nil,
+		),
+	)
+}
+
+func assertMultiErrorsEqual(
+	test *testing.T,
+	expected *spanerrors.MultiSpanError,
+	loaded *spanerrors.MultiSpanError,
+) {
+	assert := assert.New(test)
+	if !assert.Len(loaded.Errors, len(expected.Errors)) {
+		return
+	}
+
+	for i, spanErr := range expected.Errors {
+		assert.Equal(spanErr.Error(), loaded.Errors[i].Error())
+		assert.Equal(spanErr.Id, loaded.Errors[i].Id)
+		assert.Equal(spanErr.ErrorData, loaded.Errors[i].ErrorData)
+	}
+}
+
+func TestMultiSpanErrorMessage(test *testing.T) {
+	assert.Equal(
+		test,
+		"2 errors: RequestValidationError (1003) - first name is required; "+
+			"RequestValidationError (1003) - last name is required",
+		createTestMultiError().Error(),
+	)
+}
+
+func TestMultiSpanErrorJSONRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+	multiErr := createTestMultiError()
+
+	encoded, err := json.Marshal(multiErr)
+	if !assert.Nil(err) {
+		return
+	}
+
+	loaded := &spanerrors.MultiSpanError{}
+	assert.Nil(json.Unmarshal(encoded, loaded))
+	assertMultiErrorsEqual(test, multiErr, loaded)
+}
+
+func TestMultiSpanErrorHeaders(test *testing.T) {
+	assert := assert.New(test)
+	_, testReq, engine := setupHeadersTest(test)
+	multiErr := createTestMultiError()
+
+	err := multiErr.ToHeader(testReq.Header, engine)
+	if err != nil {
+		test.Error(err)
+	}
+
+	// The first error is written as a single error for clients which only handle one.
+	assert.Equal("first name is required", testReq.Header.Get("error-message"))
+	assert.NotEmpty(testReq.Header.Get("error-list"))
+
+	loaded, hasErr, err := spanerrors.MultiErrorFromHeaders(
+		testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+	)
+	assert.Nil(err)
+	assert.True(hasErr)
+	assertMultiErrorsEqual(test, multiErr, loaded)
+}
+
+func TestMultiSpanErrorFromSingleHeaders(test *testing.T) {
+	assert := assert.New(test)
+	spanErr, testReq, engine := setupHeadersTest(test)
+
+	err := spanErr.ToHeader(testReq.Header, engine)
+	if err != nil {
+		test.Error(err)
+	}
+
+	loaded, hasErr, err := spanerrors.MultiErrorFromHeaders(
+		testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+	)
+	assert.Nil(err)
+	assert.True(hasErr)
+	if assert.Len(loaded.Errors, 1) {
+		assert.Equal(spanErr.Id, loaded.Errors[0].Id)
+	}
+}
+
+// Removes error types added to the default index by a test.
+func forgetErrorTypes(errorTypes []*spanerrors.SpanErrorType) {
+	for _, errorType := range errorTypes {
+		delete(spanerrors.ErrorTypeCodeIndex, errorType.ApiCode())
+	}
+}
+
+func TestLoadErrorTypes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createEngine(test)
+
+	catalog := `[
+		{"name": "WandError", "api_code": 3001, "http_code": 400},
+		{"name": "PotionError", "api_code": 3002, "http_code": 500}
+	]`
+
+	var defs []spanerrors.ErrorTypeDef
+	_, err := engine.Decode(mimetype.JSON, &defs, strings.NewReader(catalog))
+	if !assert.Nil(err) {
+		return
+	}
+
+	errorTypes, err := spanerrors.LoadErrorTypes(defs)
+	defer forgetErrorTypes(errorTypes)
+	if !assert.Nil(err) || !assert.Len(errorTypes, 2) {
+		return
+	}
+
+	assert.Equal("WandError", errorTypes[0].Name())
+	assert.Equal(3001, errorTypes[0].ApiCode())
+	assert.Equal(400, errorTypes[0].HttpCode())
+	assert.Equal("PotionError", errorTypes[1].Name())
+
+	assert.Same(errorTypes[0], spanerrors.ErrorTypeCodeIndex[3001])
+	assert.Same(errorTypes[1], spanerrors.ErrorTypeCodeIndex[3002])
+
+	// Loaded types can be resolved from headers like the defaults.
+	spanErr, testReq, _ := setupHeadersTest(test)
+	spanErr.SpanErrorType = errorTypes[1]
+	if err := spanErr.ToHeader(testReq.Header, engine); err != nil {
+		test.Error(err)
+	}
+
+	loaded, _, err := spanerrors.ErrorFromHeaders(
+		testReq.Header, engine, spanerrors.ErrorTypeCodeIndex,
+	)
+	assert.Nil(err)
+	assert.True(loaded.IsType(errorTypes[1]))
+}
+
+func TestLoadErrorTypesCollisions(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Defs     []spanerrors.ErrorTypeDef
+		ErrorMsg string
+	}{
+		{
+			Name: "DefaultCode",
+			Defs: []spanerrors.ErrorTypeDef{
+				{Name: "WandError", ApiCode: 1000, HttpCode: 400},
+			},
+			ErrorMsg: "api code 1000 of WandError is already used by APIError",
+		},
+		{
+			Name: "DefaultName",
+			Defs: []spanerrors.ErrorTypeDef{
+				{Name: "ServerError", ApiCode: 3001, HttpCode: 500},
+			},
+			ErrorMsg: "error type name ServerError is already used",
+		},
+		{
+			Name: "SharedCode",
+			Defs: []spanerrors.ErrorTypeDef{
+				{Name: "WandError", ApiCode: 3001, HttpCode: 400},
+				{Name: "PotionError", ApiCode: 3001, HttpCode: 400},
+			},
+			ErrorMsg: "api code 3001 of PotionError is already used by WandError",
+		},
+		{
+			Name: "SharedName",
+			Defs: []spanerrors.ErrorTypeDef{
+				{Name: "WandError", ApiCode: 3001, HttpCode: 400},
+				{Name: "WandError", ApiCode: 3002, HttpCode: 400},
+			},
+			ErrorMsg: "error type name WandError is already used",
+		},
+		{
+			Name: "NoName",
+			Defs: []spanerrors.ErrorTypeDef{
+				{Name: "WandError", ApiCode: 3001, HttpCode: 400},
+				{ApiCode: 3002, HttpCode: 400},
+			},
+			ErrorMsg: "error type definition 1 has no name",
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert := assert.New(subTest)
+
+			errorTypes, err := spanerrors.LoadErrorTypes(thisCase.Defs)
+			assert.Nil(errorTypes)
+			assert.EqualError(err, thisCase.ErrorMsg)
+
+			// Nothing is added when any definition is invalid.
+			assert.NotContains(spanerrors.ErrorTypeCodeIndex, 3001)
+			assert.NotContains(spanerrors.ErrorTypeCodeIndex, 3002)
+		})
+	}
+}
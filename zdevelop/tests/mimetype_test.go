@@ -97,6 +97,81 @@ func TestFromYaml(test *testing.T) {
 	test.Run("YAML From Header", testFromHeader)
 }
 
+func TestFromNDJSON(test *testing.T) {
+	stringValues := []string{
+		"ndjson",
+		"x-ndjson",
+		"application/x-ndjson",
+		"application/X-NDJSON",
+	}
+	testFromString := func(subTest *testing.T) {
+		ParameterizeFromString(test, stringValues, mimetype.NDJSON)
+	}
+	testFromHeader := func(subTest *testing.T) {
+		ParameterizeFromHeader(test, stringValues, mimetype.NDJSON)
+	}
+
+	test.Run("NDJSON From String", testFromString)
+	test.Run("NDJSON From Header", testFromHeader)
+}
+
+func TestFromXML(test *testing.T) {
+	stringValues := []string{
+		"xml",
+		"XML",
+		"x-xml",
+		"application/xml",
+		"application/X-XML",
+		"text/xml",
+		"text/xml; charset=utf-8",
+	}
+	testFromString := func(subTest *testing.T) {
+		ParameterizeFromString(test, stringValues, mimetype.XML)
+	}
+	testFromHeader := func(subTest *testing.T) {
+		ParameterizeFromHeader(test, stringValues, mimetype.XML)
+	}
+
+	test.Run("XML From String", testFromString)
+	test.Run("XML From Header", testFromHeader)
+}
+
+func TestFromMsgpack(test *testing.T) {
+	stringValues := []string{
+		"msgpack",
+		"x-msgpack",
+		"application/msgpack",
+		"application/x-msgpack",
+		"application/X-MSGPACK",
+	}
+	testFromString := func(subTest *testing.T) {
+		ParameterizeFromString(test, stringValues, mimetype.MSGPACK)
+	}
+	testFromHeader := func(subTest *testing.T) {
+		ParameterizeFromHeader(test, stringValues, mimetype.MSGPACK)
+	}
+
+	test.Run("MSGPACK From String", testFromString)
+	test.Run("MSGPACK From Header", testFromHeader)
+}
+
+func TestFromForm(test *testing.T) {
+	stringValues := []string{
+		"application/x-www-form-urlencoded",
+		"application/X-WWW-FORM-URLENCODED",
+		"www-form-urlencoded",
+	}
+	testFromString := func(subTest *testing.T) {
+		ParameterizeFromString(test, stringValues, mimetype.FORM)
+	}
+	testFromHeader := func(subTest *testing.T) {
+		ParameterizeFromHeader(test, stringValues, mimetype.FORM)
+	}
+
+	test.Run("FORM From String", testFromString)
+	test.Run("FORM From Header", testFromHeader)
+}
+
 func TestFromText(test *testing.T) {
 	stringValues := []string{
 		"text",
@@ -143,3 +218,332 @@ func TestFromStringOther(test *testing.T) {
 	test.Run("Other From String", testFromString)
 	test.Run("Other From Header", testFromHeader)
 }
+
+func TestParseAccept(test *testing.T) {
+	assert := assert.New(test)
+
+	entries := mimetype.ParseAccept(
+		"text/plain;q=0.5, application/x-json;q=0.8, application/bson, */*;q=0.1",
+	)
+
+	expected := []mimetype.AcceptEntry{
+		{MimeType: mimetype.BSON, Quality: 1, Params: map[string]string{}},
+		{MimeType: mimetype.JSON, Quality: 0.8, Params: map[string]string{}},
+		{MimeType: mimetype.TEXT, Quality: 0.5, Params: map[string]string{}},
+		{MimeType: "*/*", Quality: 0.1, Params: map[string]string{}},
+	}
+
+	assert.Equal(expected, entries)
+}
+
+func TestParseAcceptParams(test *testing.T) {
+	assert := assert.New(test)
+
+	entries := mimetype.ParseAccept("text/plain; charset=utf-8; q=bad, ,")
+
+	assert.Len(entries, 1)
+	assert.Equal(mimetype.TEXT, entries[0].MimeType)
+	assert.Equal(0.0, entries[0].Quality)
+	assert.Equal(map[string]string{"charset": "utf-8"}, entries[0].Params)
+}
+
+func TestAcceptParserCached(test *testing.T) {
+	assert := assert.New(test)
+
+	accept := "application/json;q=0.5, application/bson"
+	parser := mimetype.NewAcceptParser(10)
+
+	first := parser.Parse(accept)
+	assert.Equal(1, parser.Len())
+	assert.Equal(mimetype.ParseAccept(accept), first)
+
+	// Modifying a returned result must not alter the cache.
+	first[0].MimeType = mimetype.YAML
+
+	second := parser.Parse(accept)
+	assert.Equal(1, parser.Len())
+	assert.Equal(mimetype.ParseAccept(accept), second)
+}
+
+func TestAcceptParserCachedParams(test *testing.T) {
+	assert := assert.New(test)
+
+	accept := "text/plain; charset=utf-8"
+	parser := mimetype.NewAcceptParser(10)
+
+	first := parser.Parse(accept)
+	first[0].Params["charset"] = "latin-1"
+
+	second := parser.Parse(accept)
+	assert.Equal(map[string]string{"charset": "utf-8"}, second[0].Params)
+}
+
+func TestFromAcceptHeaderCachedParams(test *testing.T) {
+	assert := assert.New(test)
+
+	header := make(http.Header)
+	header.Set("Accept", "application/json; version=2")
+
+	first := mimetype.FromAcceptHeader(header)
+	first[0].Params["version"] = "3"
+
+	second := mimetype.FromAcceptHeader(header)
+	assert.Equal(map[string]string{"version": "2"}, second[0].Params)
+}
+
+func TestAcceptParserEvicts(test *testing.T) {
+	assert := assert.New(test)
+
+	parser := mimetype.NewAcceptParser(2)
+
+	parser.Parse("application/json")
+	parser.Parse("application/bson")
+	parser.Parse("application/json")
+	parser.Parse("text/plain")
+	assert.Equal(2, parser.Len())
+
+	entries := parser.Parse("application/json")
+	assert.Equal(mimetype.JSON, entries[0].MimeType)
+	assert.Equal(2, parser.Len())
+}
+
+func TestAcceptParserNoCache(test *testing.T) {
+	assert := assert.New(test)
+
+	parser := mimetype.NewAcceptParser(0)
+	entries := parser.Parse("application/json")
+
+	assert.Equal(mimetype.JSON, entries[0].MimeType)
+	assert.Equal(0, parser.Len())
+}
+
+const benchmarkAccept = "text/html, application/xhtml+xml, application/xml;q=0.9, " +
+	"application/json;q=0.8, application/bson;q=0.7, */*;q=0.1"
+
+func BenchmarkParseAcceptUncached(bench *testing.B) {
+	parser := mimetype.NewAcceptParser(0)
+	for i := 0; i < bench.N; i++ {
+		parser.Parse(benchmarkAccept)
+	}
+}
+
+func BenchmarkParseAcceptCached(bench *testing.B) {
+	parser := mimetype.NewAcceptParser(128)
+	for i := 0; i < bench.N; i++ {
+		parser.Parse(benchmarkAccept)
+	}
+}
+
+func TestFromHeaderAll(test *testing.T) {
+	testSingle := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json")
+
+		assert.Equal(subTest, mimetype.JSON, mimetype.FromHeader(header))
+		assert.Equal(
+			subTest, []mimetype.MimeType{mimetype.JSON}, mimetype.FromHeaderAll(header),
+		)
+	}
+
+	testCommaJoined := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Set("Content-Type", " , application/bson, application/json")
+
+		assert.Equal(subTest, mimetype.BSON, mimetype.FromHeader(header))
+		assert.Equal(
+			subTest,
+			[]mimetype.MimeType{mimetype.BSON, mimetype.JSON},
+			mimetype.FromHeaderAll(header),
+		)
+	}
+
+	testMultipleHeaders := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Add("Content-Type", "")
+		header.Add("Content-Type", "application/yaml")
+		header.Add("Content-Type", "text/plain")
+
+		assert.Equal(subTest, mimetype.YAML, mimetype.FromHeader(header))
+		assert.Equal(
+			subTest,
+			[]mimetype.MimeType{mimetype.YAML, mimetype.TEXT},
+			mimetype.FromHeaderAll(header),
+		)
+	}
+
+	testEmpty := func(subTest *testing.T) {
+		header := make(http.Header)
+
+		assert.Equal(subTest, mimetype.UNKNOWN, mimetype.FromHeader(header))
+		assert.Empty(subTest, mimetype.FromHeaderAll(header))
+	}
+
+	test.Run("Single Content-Type", testSingle)
+	test.Run("Comma Joined Content-Type", testCommaJoined)
+	test.Run("Multiple Content-Type Headers", testMultipleHeaders)
+	test.Run("Empty Content-Type", testEmpty)
+}
+
+func TestFromStringParams(test *testing.T) {
+	assert := assert.New(test)
+
+	assert.Equal(mimetype.JSON, mimetype.FromString("application/json; charset=utf-8"))
+	assert.Equal(mimetype.JSON, mimetype.FromString("application/JSON; charset=UTF-8"))
+	assert.Equal(mimetype.YAML, mimetype.FromString(" application/x-yaml ;"))
+	assert.Equal(mimetype.TEXT, mimetype.FromString("text/plain;charset=utf-8"))
+	assert.Equal(
+		mimetype.MimeType("text/csv"), mimetype.FromString("text/csv; header=present"),
+	)
+	assert.Equal(mimetype.UNKNOWN, mimetype.FromString("; charset=utf-8"))
+}
+
+func TestFromHeaderWithParams(test *testing.T) {
+	testCharset := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Set("Content-Type", "application/JSON; charset=UTF-8")
+
+		mimeType, params := mimetype.FromHeaderWithParams(header)
+		assert.Equal(subTest, mimetype.JSON, mimeType)
+		assert.Equal(subTest, map[string]string{"charset": "UTF-8"}, params)
+		assert.Equal(subTest, mimetype.JSON, mimetype.FromHeader(header))
+		assert.Equal(
+			subTest, []mimetype.MimeType{mimetype.JSON}, mimetype.FromHeaderAll(header),
+		)
+	}
+
+	testQuoted := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Set("Content-Type", `text/plain; Charset="utf-8"; format=flowed`)
+
+		mimeType, params := mimetype.FromHeaderWithParams(header)
+		assert.Equal(subTest, mimetype.TEXT, mimeType)
+		assert.Equal(
+			subTest, map[string]string{"charset": "utf-8", "format": "flowed"}, params,
+		)
+	}
+
+	testFirstValid := func(subTest *testing.T) {
+		header := make(http.Header)
+		header.Add("Content-Type", "; charset=ascii")
+		header.Add("Content-Type", "application/bson; version=1, application/json")
+
+		mimeType, params := mimetype.FromHeaderWithParams(header)
+		assert.Equal(subTest, mimetype.BSON, mimeType)
+		assert.Equal(subTest, map[string]string{"version": "1"}, params)
+	}
+
+	testEmpty := func(subTest *testing.T) {
+		mimeType, params := mimetype.FromHeaderWithParams(make(http.Header))
+		assert.Equal(subTest, mimetype.UNKNOWN, mimeType)
+		assert.Empty(subTest, params)
+	}
+
+	test.Run("Charset", testCharset)
+	test.Run("Quoted", testQuoted)
+	test.Run("First Valid", testFirstValid)
+	test.Run("Empty", testEmpty)
+}
+
+func TestDetect(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Data     []byte
+		Expected mimetype.MimeType
+	}{
+		{
+			Name:     "JSON",
+			Data:     []byte(` {"first": "Harry", "last": "Potter"}`),
+			Expected: mimetype.JSON,
+		},
+		{
+			Name:     "JSONList",
+			Data:     []byte(`[1, 2, 3]`),
+			Expected: mimetype.JSON,
+		},
+		{
+			Name: "BSON",
+			// {"a": "b"}
+			Data: []byte{
+				0x0e, 0x00, 0x00, 0x00, 0x02, 'a', 0x00,
+				0x02, 0x00, 0x00, 0x00, 'b', 0x00, 0x00,
+			},
+			Expected: mimetype.BSON,
+		},
+		{
+			Name:     "PNG",
+			Data:     []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR"),
+			Expected: mimetype.MimeType("image/png"),
+		},
+		{
+			Name:     "Text",
+			Data:     []byte("Mischief managed."),
+			Expected: mimetype.TEXT,
+		},
+		{
+			Name:     "InvalidJSON",
+			Data:     []byte(`{"first": `),
+			Expected: mimetype.TEXT,
+		},
+		{
+			Name:     "Binary",
+			Data:     []byte{0x00, 0x01, 0x02, 0x03},
+			Expected: mimetype.MimeType("application/octet-stream"),
+		},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			assert.Equal(subTest, thisCase.Expected, mimetype.Detect(thisCase.Data))
+		})
+	}
+}
+
+func TestNegotiate(test *testing.T) {
+	supported := []mimetype.MimeType{mimetype.JSON, mimetype.YAML, mimetype.TEXT}
+
+	testCases := []struct {
+		Name     string
+		Accept   []string
+		Expected mimetype.MimeType
+	}{
+		{"Absent", nil, mimetype.JSON},
+		{"Exact", []string{"text/plain"}, mimetype.TEXT},
+		{"Alias", []string{"application/x-yaml"}, mimetype.YAML},
+		{
+			"Quality",
+			[]string{"application/json;q=0.8, application/yaml;q=0.9"},
+			mimetype.YAML,
+		},
+		{"AnyType", []string{"*/*"}, mimetype.JSON},
+		{"TypeWildcard", []string{"text/*, application/*;q=0.5"}, mimetype.TEXT},
+		{"SubtypeWildcard", []string{"application/*"}, mimetype.JSON},
+		{"MultipleHeaders", []string{"image/png", "text/plain;q=0.2"}, mimetype.TEXT},
+		{"NoMatch", []string{"image/png, text/html"}, mimetype.UNKNOWN},
+		{"Refused", []string{"application/*;q=0, text/plain;q=0"}, mimetype.UNKNOWN},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			header := make(http.Header)
+			for _, accept := range thisCase.Accept {
+				header.Add("Accept", accept)
+			}
+
+			negotiated := mimetype.Negotiate(header, supported)
+			assert.Equal(subTest, thisCase.Expected, negotiated)
+		})
+	}
+}
+
+func TestNegotiateSupportedAlias(test *testing.T) {
+	assert := assert.New(test)
+
+	header := make(http.Header)
+	header.Set("Accept", "application/yaml")
+
+	supported := []mimetype.MimeType{mimetype.JSON, "application/x-yaml"}
+	assert.Equal(
+		mimetype.MimeType("application/x-yaml"), mimetype.Negotiate(header, supported),
+	)
+	assert.Equal(mimetype.UNKNOWN, mimetype.Negotiate(header, nil))
+}
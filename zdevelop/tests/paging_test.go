@@ -4,6 +4,7 @@ package tests
 // the preferred method of using multiple asserts in a test.
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"github.com/illuscio-dev/spantools-go/models"
@@ -190,3 +191,216 @@ func TestPagingLimitRespError(test *testing.T) {
 
 	assert.EqualError(err, "paging-limit is not int")
 }
+
+const pagingBody = `{
+	"paging": {
+		"offset": 10,
+		"limit": 50,
+		"total-items": 200,
+		"total-pages": 4,
+		"current-page": 2,
+		"next": "www.api/some/page3",
+		"previous": "www.api/some/page1"
+	},
+	"data": [{"First": "Harry"}]
+}`
+
+func expectedBodyPaging() *models.PagingResp {
+	return &models.PagingResp{
+		PagingReq: &models.PagingReq{
+			Offset: 10,
+			Limit:  50,
+		},
+		TotalItems:  200,
+		TotalPages:  4,
+		CurrentPage: 2,
+		Next:        "www.api/some/page3",
+		Previous:    "www.api/some/page1",
+	}
+}
+
+func TestPagingFromBodyRaw(test *testing.T) {
+	assert := assert.New(test)
+
+	loaded, err := models.PagingFromBody([]byte(pagingBody), 50)
+	assert.Nil(err)
+	assert.Equal(expectedBodyPaging(), loaded)
+
+	loaded, err = models.PagingFromBody(json.RawMessage(pagingBody), 50)
+	assert.Nil(err)
+	assert.Equal(expectedBodyPaging(), loaded)
+}
+
+func TestPagingFromBodyDecoded(test *testing.T) {
+	assert := assert.New(test)
+
+	envelope := struct {
+		Paging map[string]interface{} `json:"paging"`
+		Data   []Name                 `json:"data"`
+	}{}
+	if err := json.Unmarshal([]byte(pagingBody), &envelope); err != nil {
+		test.Fatal(err)
+	}
+	assert.Equal([]Name{{First: "Harry"}}, envelope.Data)
+
+	loaded, err := models.PagingFromBody(
+		map[string]interface{}{"paging": envelope.Paging}, 50,
+	)
+	assert.Nil(err)
+	assert.Equal(expectedBodyPaging(), loaded)
+
+	// Objects decoded from yaml have interface keys.
+	loaded, err = models.PagingFromBody(
+		map[interface{}]interface{}{
+			"paging": map[interface{}]interface{}{"offset": 10, "limit": 20},
+		},
+		50,
+	)
+	assert.Nil(err)
+	assert.Equal(10, loaded.Offset)
+	assert.Equal(20, loaded.Limit)
+}
+
+func TestPagingFromBodyDefaults(test *testing.T) {
+	assert := assert.New(test)
+
+	loaded, err := models.PagingFromBody([]byte(`{"paging": {}}`), 50)
+	assert.Nil(err)
+	assert.Equal(
+		&models.PagingResp{
+			PagingReq:   &models.PagingReq{Offset: 0, Limit: 50},
+			TotalItems:  -1,
+			TotalPages:  -1,
+			CurrentPage: -1,
+		},
+		loaded,
+	)
+}
+
+func TestPagingFromBodyErrors(test *testing.T) {
+	assert := assert.New(test)
+
+	_, err := models.PagingFromBody([]byte(`{"data": []}`), 50)
+	assert.EqualError(err, "body has no paging object")
+
+	_, err = models.PagingFromBody([]byte(`{"paging": {"limit": 1.5}}`), 50)
+	assert.EqualError(err, "paging-limit is not int")
+
+	_, err = models.PagingFromBody([]byte(`{"paging": `), 50)
+	assert.Error(err)
+
+	_, err = models.PagingFromBody("not a body", 50)
+	assert.EqualError(err, "body of type string is not an object")
+}
+
+func TestCursorPagingReqRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+
+	pagingReq := &models.CursorPagingReq{
+		Cursor: "b2Zmc2V0OjUw",
+		Limit:  50,
+	}
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	pagingReq.ToParams(reqTest.Header)
+	assert.Equal("b2Zmc2V0OjUw", reqTest.Header.Get("paging-cursor"))
+	assert.Equal("50", reqTest.Header.Get("paging-limit"))
+
+	loaded, err := models.CursorPagingReqFromParams(reqTest.Header, 20)
+
+	assert.Nil(err)
+	assert.Equal(pagingReq, loaded)
+}
+
+func TestCursorPagingReqDefaults(test *testing.T) {
+	assert := assert.New(test)
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	(&models.CursorPagingReq{}).ToParams(reqTest.Header)
+	assert.Empty(reqTest.Header)
+
+	loaded, err := models.CursorPagingReqFromParams(reqTest.Header, 20)
+
+	assert.Nil(err)
+	assert.Equal(&models.CursorPagingReq{Cursor: "", Limit: 20}, loaded)
+}
+
+func TestCursorPagingRespRoundTrip(test *testing.T) {
+	assert := assert.New(test)
+
+	pagingResp := &models.CursorPagingResp{
+		CursorPagingReq: &models.CursorPagingReq{
+			Cursor: "page2",
+			Limit:  50,
+		},
+		NextCursor: "page3",
+		PrevCursor: "page1",
+		HasMore:    true,
+	}
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	pagingResp.ToHeaders(reqTest.Header)
+	assert.Equal("true", reqTest.Header.Get("paging-has-more"))
+
+	loaded, err := models.CursorPagingRespFromHeaders(reqTest.Header, 20)
+
+	assert.Nil(err)
+	assert.Equal(pagingResp, loaded)
+}
+
+func TestCursorPagingRespLastPage(test *testing.T) {
+	assert := assert.New(test)
+
+	pagingResp := &models.CursorPagingResp{
+		CursorPagingReq: &models.CursorPagingReq{Cursor: "page3", Limit: 50},
+		PrevCursor:      "page2",
+	}
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	pagingResp.ToHeaders(reqTest.Header)
+	assert.Equal("false", reqTest.Header.Get("paging-has-more"))
+	assert.Equal("", reqTest.Header.Get("paging-next-cursor"))
+
+	loaded, err := models.CursorPagingRespFromHeaders(reqTest.Header, 20)
+
+	assert.Nil(err)
+	assert.Equal(pagingResp, loaded)
+}
+
+func TestCursorPagingNotBoolHasMore(test *testing.T) {
+	assert := assert.New(test)
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	reqTest.Header.Set("paging-has-more", "maybe")
+	_, err := models.CursorPagingRespFromHeaders(reqTest.Header, 50)
+
+	assert.EqualError(err, "paging-has-more is not bool")
+}
+
+func TestCursorPagingNotIntLimit(test *testing.T) {
+	assert := assert.New(test)
+
+	reqTest := http.Request{
+		Header: make(http.Header),
+	}
+
+	reqTest.Header.Set("paging-limit", "not an int")
+	_, err := models.CursorPagingRespFromHeaders(reqTest.Header, 50)
+
+	assert.EqualError(err, "paging-limit is not int")
+}
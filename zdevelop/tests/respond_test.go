@@ -0,0 +1,218 @@
+package tests
+
+//revive:disable:import-shadowing reason: Disabled for assert := assert.New(), which is
+// the preferred method of using multiple asserts in a test.
+
+import (
+	"encoding/json"
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spanerrors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/xerrors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptSpecificity(test *testing.T) {
+	assert := assert.New(test)
+
+	entries := mimetype.ParseAccept("application/json, application/*, */*, text/*")
+	assert.Equal(2, entries[0].Specificity(mimetype.JSON))
+	assert.Equal(1, entries[1].Specificity(mimetype.JSON))
+	assert.Equal(0, entries[2].Specificity(mimetype.JSON))
+	assert.Equal(-1, entries[3].Specificity(mimetype.JSON))
+	assert.Equal(1, entries[3].Specificity(mimetype.TEXT))
+	assert.Equal(-1, entries[0].Specificity(mimetype.NDJSON))
+}
+
+func TestNegotiateAccept(test *testing.T) {
+	testCases := []struct {
+		Name     string
+		Accept   string
+		Expected mimetype.MimeType
+	}{
+		{"Absent", "", mimetype.JSON},
+		{"AnyType", "*/*", mimetype.JSON},
+		{"Exact", "application/x-gob", mimetype.GOB},
+		{"Alias", "application/x-yaml", mimetype.YAML},
+		{"HighestQuality", "application/yaml;q=0.5, application/bson;q=0.9", mimetype.BSON},
+		{"TypeWildcard", "application/json;q=0.2, text/*", mimetype.TEXT},
+		{"WildcardExcludes", "application/json;q=0, */*;q=0.5", mimetype.BSON},
+		{"SkipsUnsupported", "image/png, application/yaml;q=0.1", mimetype.YAML},
+		{"ClientOrderOnTie", "application/yaml, application/bson", mimetype.YAML},
+		{"NoMatch", "image/png, text/html", mimetype.UNKNOWN},
+		{"AllRefused", "application/*;q=0, text/plain;q=0", mimetype.UNKNOWN},
+	}
+
+	for _, thisCase := range testCases {
+		test.Run(thisCase.Name, func(subTest *testing.T) {
+			engine := createSpanEngine(subTest)
+
+			mimeType, ok := engine.NegotiateAccept(mimetype.ParseAccept(thisCase.Accept))
+			assert.Equal(subTest, thisCase.Expected, mimeType)
+			assert.Equal(subTest, thisCase.Expected != mimetype.UNKNOWN, ok)
+		})
+	}
+}
+
+func TestNegotiateAcceptRemovedEncoder(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.RemoveEncoder(mimetype.JSON)
+	assert.NotContains(engine.EncoderMimeTypes(), mimetype.JSON)
+
+	mimeType, ok := engine.NegotiateAccept(nil)
+	assert.True(ok)
+	assert.Equal(mimetype.BSON, mimeType)
+
+	_, ok = engine.NegotiateAccept(mimetype.ParseAccept("application/json"))
+	assert.False(ok)
+}
+
+func TestNegotiateAcceptAllowedMimeTypes(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	engine.SetAllowedMimeTypes([]mimetype.MimeType{mimetype.TEXT, mimetype.JSON})
+	assert.NotContains(engine.EncoderMimeTypes(), mimetype.BSON)
+	assert.Contains(engine.EncoderMimeTypes(), mimetype.TEXT)
+
+	mimeType, ok := engine.NegotiateAccept(mimetype.ParseAccept("*/*"))
+	assert.True(ok)
+	assert.Equal(mimetype.JSON, mimeType)
+
+	_, ok = engine.NegotiateAccept(mimetype.ParseAccept("application/bson"))
+	assert.False(ok)
+
+	// The 406 does not list mimetypes which are not allowed.
+	recorder := httptest.NewRecorder()
+	_, err := spanerrors.RespondTo(
+		recorder,
+		createAcceptRequest("application/bson"),
+		engine,
+		http.StatusOK,
+		"hello",
+	)
+	assert.Error(err)
+	assert.Equal(http.StatusNotAcceptable, recorder.Code)
+
+	body := struct {
+		Data map[string][]string `json:"data"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		test.Fatal(err)
+	}
+	assert.Contains(body.Data["supported"], string(mimetype.JSON))
+	assert.NotContains(body.Data["supported"], string(mimetype.BSON))
+}
+
+// Returns a request with an Accept header of accept, unless it is blank.
+func createAcceptRequest(accept string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	return request
+}
+
+func TestRespondTo(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	recorder := httptest.NewRecorder()
+	request := createAcceptRequest("application/json;q=0.1, text/plain;q=0.9")
+
+	mimeType, err := spanerrors.RespondTo(
+		recorder, request, engine, http.StatusCreated, "hello",
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.TEXT, mimeType)
+	assert.Equal(http.StatusCreated, recorder.Code)
+	assert.Equal(string(mimetype.TEXT), recorder.Header().Get("Content-Type"))
+	assert.Equal([]string{"Accept"}, recorder.Header()["Vary"])
+	assert.Equal("hello", recorder.Body.String())
+}
+
+func TestRespondToVary(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	// Fields already listed by other middleware are kept, and Accept is not repeated.
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("Vary", "Origin")
+
+	_, err := spanerrors.RespondTo(
+		recorder, createAcceptRequest(""), engine, http.StatusOK, "hello",
+	)
+	assert.Nil(err)
+	assert.Equal([]string{"Origin", "Accept"}, recorder.Header()["Vary"])
+
+	recorder = httptest.NewRecorder()
+	recorder.Header().Set("Vary", "Origin, accept")
+
+	_, err = spanerrors.RespondTo(
+		recorder, createAcceptRequest(""), engine, http.StatusOK, "hello",
+	)
+	assert.Nil(err)
+	assert.Equal([]string{"Origin, accept"}, recorder.Header()["Vary"])
+}
+
+func TestRespondToNoAccept(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	recorder := httptest.NewRecorder()
+
+	mimeType, err := spanerrors.RespondTo(
+		recorder, createAcceptRequest(""), engine, http.StatusOK, "hello",
+	)
+	assert.Nil(err)
+	assert.Equal(mimetype.JSON, mimeType)
+	assert.Equal(http.StatusOK, recorder.Code)
+	assert.Equal(string(mimetype.JSON), recorder.Header().Get("Content-Type"))
+}
+
+func TestRespondToNotAcceptable(test *testing.T) {
+	assert := assert.New(test)
+	engine := createSpanEngine(test)
+
+	recorder := httptest.NewRecorder()
+	request := createAcceptRequest("image/png, application/json;q=0")
+
+	_, err := spanerrors.RespondTo(recorder, request, engine, http.StatusOK, "hello")
+
+	var spanErr *spanerrors.SpanError
+	if !assert.True(xerrors.As(err, &spanErr)) {
+		test.FailNow()
+	}
+	assert.True(spanErr.IsType(spanerrors.RequestValidationError))
+	assert.Equal(http.StatusNotAcceptable, spanErr.HttpCode())
+
+	assert.Equal(http.StatusNotAcceptable, recorder.Code)
+	assert.Equal(string(mimetype.JSON), recorder.Header().Get("Content-Type"))
+	assert.Equal("1003", recorder.Header().Get("error-code"))
+	assert.Equal("Accept", recorder.Header().Get("Vary"))
+
+	body := struct {
+		Code     int                 `json:"code"`
+		HTTPCode int                 `json:"http_code"`
+		Message  string              `json:"message"`
+		Data     map[string][]string `json:"data"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		test.Fatal(err)
+	}
+
+	supported := make([]string, 0)
+	for _, mimeType := range engine.EncoderMimeTypes() {
+		supported = append(supported, string(mimeType))
+	}
+
+	assert.Equal(1003, body.Code)
+	assert.Equal(http.StatusNotAcceptable, body.HTTPCode)
+	assert.Contains(body.Message, "image/png")
+	assert.Contains(body.Message, string(mimetype.JSON))
+	assert.Equal(supported, body.Data["supported"])
+}
@@ -0,0 +1,22 @@
+package tests
+
+import (
+	"github.com/illuscio-dev/spantools-go/mimetype"
+	"github.com/illuscio-dev/spantools-go/spantest"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAssertRoundTrip(test *testing.T) {
+	engine := createEngine(test)
+	name := Name{First: "Harry", Last: "Potter"}
+
+	for _, mimeType := range []mimetype.MimeType{mimetype.JSON, mimetype.BSON} {
+		test.Run(string(mimeType), func(subTest *testing.T) {
+			assert.True(subTest, spantest.AssertRoundTrip(subTest, engine, mimeType, name))
+			assert.True(
+				subTest, spantest.AssertRoundTrip(subTest, engine, mimeType, &name),
+			)
+		})
+	}
+}